@@ -0,0 +1,338 @@
+// Package adminv1 contains the messages and the service of proto/admin.proto, the gRPC admin API
+// of the autoscaler. The types are written by hand in the form protoc-gen-go generates for the
+// vendored github.com/golang/protobuf, so that the build does not need protoc. Keep them in sync
+// with proto/admin.proto.
+package adminv1
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"google.golang.org/grpc"
+)
+
+type ClusterRequest struct {
+	// Cluster defaults to the --name cluster
+	Cluster string `protobuf:"bytes,1,opt,name=cluster" json:"cluster,omitempty"`
+}
+
+func (m *ClusterRequest) Reset()         { *m = ClusterRequest{} }
+func (m *ClusterRequest) String() string { return proto.CompactTextString(m) }
+func (*ClusterRequest) ProtoMessage()    {}
+
+type ApproveRequest struct {
+	Cluster string `protobuf:"bytes,1,opt,name=cluster" json:"cluster,omitempty"`
+	// Id must match the id of the pending plan if set
+	Id string `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *ApproveRequest) Reset()         { *m = ApproveRequest{} }
+func (m *ApproveRequest) String() string { return proto.CompactTextString(m) }
+func (*ApproveRequest) ProtoMessage()    {}
+
+type Change struct {
+	Key  string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+	Type string `protobuf:"bytes,2,opt,name=type" json:"type,omitempty"`
+	Name string `protobuf:"bytes,3,opt,name=name" json:"name,omitempty"`
+	// Action is create, update or delete
+	Action string   `protobuf:"bytes,4,opt,name=action" json:"action,omitempty"`
+	Fields []string `protobuf:"bytes,5,rep,name=fields" json:"fields,omitempty"`
+	// Kind is scale-up, scale-down, replacement or drift
+	Kind string `protobuf:"bytes,6,opt,name=kind" json:"kind,omitempty"`
+}
+
+func (m *Change) Reset()         { *m = Change{} }
+func (m *Change) String() string { return proto.CompactTextString(m) }
+func (*Change) ProtoMessage()    {}
+
+type Plan struct {
+	Id         string               `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Cluster    string               `protobuf:"bytes,2,opt,name=cluster" json:"cluster,omitempty"`
+	Created    *timestamp.Timestamp `protobuf:"bytes,3,opt,name=created" json:"created,omitempty"`
+	Changes    []*Change            `protobuf:"bytes,4,rep,name=changes" json:"changes,omitempty"`
+	Approved   bool                 `protobuf:"varint,5,opt,name=approved" json:"approved,omitempty"`
+	ApprovedBy string               `protobuf:"bytes,6,opt,name=approved_by,json=approvedBy" json:"approved_by,omitempty"`
+	ApprovedAt *timestamp.Timestamp `protobuf:"bytes,7,opt,name=approved_at,json=approvedAt" json:"approved_at,omitempty"`
+}
+
+func (m *Plan) Reset()         { *m = Plan{} }
+func (m *Plan) String() string { return proto.CompactTextString(m) }
+func (*Plan) ProtoMessage()    {}
+
+type ClusterActionResponse struct {
+	Cluster string `protobuf:"bytes,1,opt,name=cluster" json:"cluster,omitempty"`
+	Result  string `protobuf:"bytes,2,opt,name=result" json:"result,omitempty"`
+}
+
+func (m *ClusterActionResponse) Reset()         { *m = ClusterActionResponse{} }
+func (m *ClusterActionResponse) String() string { return proto.CompactTextString(m) }
+func (*ClusterActionResponse) ProtoMessage()    {}
+
+type ReadyRequest struct {
+}
+
+func (m *ReadyRequest) Reset()         { *m = ReadyRequest{} }
+func (m *ReadyRequest) String() string { return proto.CompactTextString(m) }
+func (*ReadyRequest) ProtoMessage()    {}
+
+type ReadyResponse struct {
+	Ready bool `protobuf:"varint,1,opt,name=ready" json:"ready,omitempty"`
+}
+
+func (m *ReadyResponse) Reset()         { *m = ReadyResponse{} }
+func (m *ReadyResponse) String() string { return proto.CompactTextString(m) }
+func (*ReadyResponse) ProtoMessage()    {}
+
+type StatusRequest struct {
+	// Cluster is empty for every managed cluster
+	Cluster string `protobuf:"bytes,1,opt,name=cluster" json:"cluster,omitempty"`
+}
+
+func (m *StatusRequest) Reset()         { *m = StatusRequest{} }
+func (m *StatusRequest) String() string { return proto.CompactTextString(m) }
+func (*StatusRequest) ProtoMessage()    {}
+
+type StatusList struct {
+	Clusters []*ClusterStatus `protobuf:"bytes,1,rep,name=clusters" json:"clusters,omitempty"`
+}
+
+func (m *StatusList) Reset()         { *m = StatusList{} }
+func (m *StatusList) String() string { return proto.CompactTextString(m) }
+func (*StatusList) ProtoMessage()    {}
+
+type ClusterStatus struct {
+	Cluster                 string                         `protobuf:"bytes,1,opt,name=cluster" json:"cluster,omitempty"`
+	LastReconcile           *timestamp.Timestamp           `protobuf:"bytes,2,opt,name=last_reconcile,json=lastReconcile" json:"last_reconcile,omitempty"`
+	LastSuccessfulReconcile *timestamp.Timestamp           `protobuf:"bytes,3,opt,name=last_successful_reconcile,json=lastSuccessfulReconcile" json:"last_successful_reconcile,omitempty"`
+	LastApply               *timestamp.Timestamp           `protobuf:"bytes,4,opt,name=last_apply,json=lastApply" json:"last_apply,omitempty"`
+	Paused                  bool                           `protobuf:"varint,5,opt,name=paused" json:"paused,omitempty"`
+	Error                   string                         `protobuf:"bytes,6,opt,name=error" json:"error,omitempty"`
+	InstanceGroups          map[string]*InstanceGroupCount `protobuf:"bytes,7,rep,name=instance_groups,json=instanceGroups" json:"instance_groups,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Conditions              []*StatusCondition             `protobuf:"bytes,8,rep,name=conditions" json:"conditions,omitempty"`
+	// History are the latest executions
+	History []*Execution `protobuf:"bytes,9,rep,name=history" json:"history,omitempty"`
+}
+
+func (m *ClusterStatus) Reset()         { *m = ClusterStatus{} }
+func (m *ClusterStatus) String() string { return proto.CompactTextString(m) }
+func (*ClusterStatus) ProtoMessage()    {}
+
+type InstanceGroupCount struct {
+	MinSize int32 `protobuf:"varint,1,opt,name=min_size,json=minSize" json:"min_size,omitempty"`
+	MaxSize int32 `protobuf:"varint,2,opt,name=max_size,json=maxSize" json:"max_size,omitempty"`
+	Servers int32 `protobuf:"varint,3,opt,name=servers" json:"servers,omitempty"`
+}
+
+func (m *InstanceGroupCount) Reset()         { *m = InstanceGroupCount{} }
+func (m *InstanceGroupCount) String() string { return proto.CompactTextString(m) }
+func (*InstanceGroupCount) ProtoMessage()    {}
+
+type StatusCondition struct {
+	Type               string               `protobuf:"bytes,1,opt,name=type" json:"type,omitempty"`
+	Status             string               `protobuf:"bytes,2,opt,name=status" json:"status,omitempty"`
+	Reason             string               `protobuf:"bytes,3,opt,name=reason" json:"reason,omitempty"`
+	Message            string               `protobuf:"bytes,4,opt,name=message" json:"message,omitempty"`
+	LastTransitionTime *timestamp.Timestamp `protobuf:"bytes,5,opt,name=last_transition_time,json=lastTransitionTime" json:"last_transition_time,omitempty"`
+}
+
+func (m *StatusCondition) Reset()         { *m = StatusCondition{} }
+func (m *StatusCondition) String() string { return proto.CompactTextString(m) }
+func (*StatusCondition) ProtoMessage()    {}
+
+type Execution struct {
+	Started  *timestamp.Timestamp `protobuf:"bytes,1,opt,name=started" json:"started,omitempty"`
+	Duration string               `protobuf:"bytes,2,opt,name=duration" json:"duration,omitempty"`
+	PlanId   string               `protobuf:"bytes,3,opt,name=plan_id,json=planId" json:"plan_id,omitempty"`
+	Changes  int32                `protobuf:"varint,4,opt,name=changes" json:"changes,omitempty"`
+	Actions  []string             `protobuf:"bytes,5,rep,name=actions" json:"actions,omitempty"`
+	Error    string               `protobuf:"bytes,6,opt,name=error" json:"error,omitempty"`
+}
+
+func (m *Execution) Reset()         { *m = Execution{} }
+func (m *Execution) String() string { return proto.CompactTextString(m) }
+func (*Execution) ProtoMessage()    {}
+
+func init() {
+	proto.RegisterType((*ClusterRequest)(nil), "kopsautoscaler.admin.v1.ClusterRequest")
+	proto.RegisterType((*ApproveRequest)(nil), "kopsautoscaler.admin.v1.ApproveRequest")
+	proto.RegisterType((*Change)(nil), "kopsautoscaler.admin.v1.Change")
+	proto.RegisterType((*Plan)(nil), "kopsautoscaler.admin.v1.Plan")
+	proto.RegisterType((*ClusterActionResponse)(nil), "kopsautoscaler.admin.v1.ClusterActionResponse")
+	proto.RegisterType((*ReadyRequest)(nil), "kopsautoscaler.admin.v1.ReadyRequest")
+	proto.RegisterType((*ReadyResponse)(nil), "kopsautoscaler.admin.v1.ReadyResponse")
+	proto.RegisterType((*StatusRequest)(nil), "kopsautoscaler.admin.v1.StatusRequest")
+	proto.RegisterType((*StatusList)(nil), "kopsautoscaler.admin.v1.StatusList")
+	proto.RegisterType((*ClusterStatus)(nil), "kopsautoscaler.admin.v1.ClusterStatus")
+	proto.RegisterType((*InstanceGroupCount)(nil), "kopsautoscaler.admin.v1.InstanceGroupCount")
+	proto.RegisterType((*StatusCondition)(nil), "kopsautoscaler.admin.v1.StatusCondition")
+	proto.RegisterType((*Execution)(nil), "kopsautoscaler.admin.v1.Execution")
+}
+
+// This is a compile-time assertion to ensure that the vendored grpc package is compatible.
+const _ = grpc.SupportPackageIsVersion4
+
+// AdminClient is the client API for the Admin service
+type AdminClient interface {
+	GetPlan(ctx context.Context, in *ClusterRequest, opts ...grpc.CallOption) (*Plan, error)
+	Approve(ctx context.Context, in *ApproveRequest, opts ...grpc.CallOption) (*Plan, error)
+	Pause(ctx context.Context, in *ClusterRequest, opts ...grpc.CallOption) (*ClusterActionResponse, error)
+	Resume(ctx context.Context, in *ClusterRequest, opts ...grpc.CallOption) (*ClusterActionResponse, error)
+	Reconcile(ctx context.Context, in *ClusterRequest, opts ...grpc.CallOption) (*ClusterActionResponse, error)
+	Ready(ctx context.Context, in *ReadyRequest, opts ...grpc.CallOption) (*ReadyResponse, error)
+	GetStatus(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusList, error)
+}
+
+type adminClient struct {
+	cc *grpc.ClientConn
+}
+
+// NewAdminClient returns a client of the Admin service
+func NewAdminClient(cc *grpc.ClientConn) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) GetPlan(ctx context.Context, in *ClusterRequest, opts ...grpc.CallOption) (*Plan, error) {
+	out := new(Plan)
+	if err := grpc.Invoke(ctx, "/kopsautoscaler.admin.v1.Admin/GetPlan", in, out, c.cc, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Approve(ctx context.Context, in *ApproveRequest, opts ...grpc.CallOption) (*Plan, error) {
+	out := new(Plan)
+	if err := grpc.Invoke(ctx, "/kopsautoscaler.admin.v1.Admin/Approve", in, out, c.cc, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Pause(ctx context.Context, in *ClusterRequest, opts ...grpc.CallOption) (*ClusterActionResponse, error) {
+	out := new(ClusterActionResponse)
+	if err := grpc.Invoke(ctx, "/kopsautoscaler.admin.v1.Admin/Pause", in, out, c.cc, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Resume(ctx context.Context, in *ClusterRequest, opts ...grpc.CallOption) (*ClusterActionResponse, error) {
+	out := new(ClusterActionResponse)
+	if err := grpc.Invoke(ctx, "/kopsautoscaler.admin.v1.Admin/Resume", in, out, c.cc, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Reconcile(ctx context.Context, in *ClusterRequest, opts ...grpc.CallOption) (*ClusterActionResponse, error) {
+	out := new(ClusterActionResponse)
+	if err := grpc.Invoke(ctx, "/kopsautoscaler.admin.v1.Admin/Reconcile", in, out, c.cc, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Ready(ctx context.Context, in *ReadyRequest, opts ...grpc.CallOption) (*ReadyResponse, error) {
+	out := new(ReadyResponse)
+	if err := grpc.Invoke(ctx, "/kopsautoscaler.admin.v1.Admin/Ready", in, out, c.cc, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetStatus(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusList, error) {
+	out := new(StatusList)
+	if err := grpc.Invoke(ctx, "/kopsautoscaler.admin.v1.Admin/GetStatus", in, out, c.cc, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for the Admin service
+type AdminServer interface {
+	GetPlan(context.Context, *ClusterRequest) (*Plan, error)
+	Approve(context.Context, *ApproveRequest) (*Plan, error)
+	Pause(context.Context, *ClusterRequest) (*ClusterActionResponse, error)
+	Resume(context.Context, *ClusterRequest) (*ClusterActionResponse, error)
+	Reconcile(context.Context, *ClusterRequest) (*ClusterActionResponse, error)
+	Ready(context.Context, *ReadyRequest) (*ReadyResponse, error)
+	GetStatus(context.Context, *StatusRequest) (*StatusList, error)
+}
+
+// RegisterAdminServer registers the implementation of the Admin service on the server
+func RegisterAdminServer(s *grpc.Server, srv AdminServer) {
+	s.RegisterService(&adminServiceDesc, srv)
+}
+
+// unaryHandler returns the handler of a unary method, which decodes the request into a new
+// message and calls the method of the server
+func unaryHandler(method string, newRequest func() interface{}, call func(srv AdminServer, ctx context.Context, req interface{}) (interface{}, error)) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := newRequest()
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv.(AdminServer), ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: "/kopsautoscaler.admin.v1.Admin/" + method,
+		}
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(srv.(AdminServer), ctx, req)
+		}
+		return interceptor(ctx, in, info, handler)
+	}
+}
+
+var adminServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kopsautoscaler.admin.v1.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetPlan",
+			Handler: unaryHandler("GetPlan", func() interface{} { return new(ClusterRequest) }, func(srv AdminServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.GetPlan(ctx, req.(*ClusterRequest))
+			}),
+		},
+		{
+			MethodName: "Approve",
+			Handler: unaryHandler("Approve", func() interface{} { return new(ApproveRequest) }, func(srv AdminServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.Approve(ctx, req.(*ApproveRequest))
+			}),
+		},
+		{
+			MethodName: "Pause",
+			Handler: unaryHandler("Pause", func() interface{} { return new(ClusterRequest) }, func(srv AdminServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.Pause(ctx, req.(*ClusterRequest))
+			}),
+		},
+		{
+			MethodName: "Resume",
+			Handler: unaryHandler("Resume", func() interface{} { return new(ClusterRequest) }, func(srv AdminServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.Resume(ctx, req.(*ClusterRequest))
+			}),
+		},
+		{
+			MethodName: "Reconcile",
+			Handler: unaryHandler("Reconcile", func() interface{} { return new(ClusterRequest) }, func(srv AdminServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.Reconcile(ctx, req.(*ClusterRequest))
+			}),
+		},
+		{
+			MethodName: "Ready",
+			Handler: unaryHandler("Ready", func() interface{} { return new(ReadyRequest) }, func(srv AdminServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.Ready(ctx, req.(*ReadyRequest))
+			}),
+		},
+		{
+			MethodName: "GetStatus",
+			Handler: unaryHandler("GetStatus", func() interface{} { return new(StatusRequest) }, func(srv AdminServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.GetStatus(ctx, req.(*StatusRequest))
+			}),
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "admin.proto",
+}
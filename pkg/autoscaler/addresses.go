@@ -0,0 +1,61 @@
+package autoscaler
+
+import (
+	"net"
+	"sort"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+)
+
+// fixedAddresses returns the fixed addresses of the server in the network, IPv4 addresses first.
+// Servers on dual-stack subnets have an address of both versions, in no particular order.
+func fixedAddresses(s *servers.Server, network string) []string {
+	entries, _ := s.Addresses[network].([]interface{})
+	var addresses []string
+	for _, e := range entries {
+		m, ok := e.(map[string]interface{})
+		if !ok || m["OS-EXT-IPS:type"] != "fixed" {
+			continue
+		}
+		addr, _ := m["addr"].(string)
+		if ip := net.ParseIP(addr); ip != nil {
+			addresses = append(addresses, ip.String())
+		}
+	}
+	sort.SliceStable(addresses, func(i, j int) bool {
+		return ipVersion(addresses[i]) < ipVersion(addresses[j])
+	})
+	return addresses
+}
+
+// fixedAddress returns the fixed address of the server in the network of the IP version, 4 or 6,
+// or the IPv4 address if version is 0. Empty string if the server has no such address yet.
+func fixedAddress(s *servers.Server, network string, version int) string {
+	for _, address := range fixedAddresses(s, network) {
+		if version == 0 || ipVersion(address) == version {
+			return address
+		}
+	}
+	return ""
+}
+
+// ipVersion returns 4 or 6 for an IP address, or 0 if it is not an IP address
+func ipVersion(address string) int {
+	ip := net.ParseIP(address)
+	switch {
+	case ip == nil:
+		return 0
+	case ip.To4() != nil:
+		return 4
+	}
+	return 6
+}
+
+// canonicalIP returns the address in the canonical form, so that differently written IPv6
+// addresses compare equal
+func canonicalIP(address string) string {
+	if ip := net.ParseIP(address); ip != nil {
+		return ip.String()
+	}
+	return address
+}
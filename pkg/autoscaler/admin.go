@@ -0,0 +1,330 @@
+package autoscaler
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+)
+
+// adminServer serves the HTTP admin API, and the gRPC admin API of proto/admin.proto, of the autoscaler
+type adminServer struct {
+	opts    *Options
+	manager *manager
+	mux     *http.ServeMux
+	auth    *adminAuth
+	audit   *auditLog
+	// limits throttle the actions by verb
+	limits map[string]*triggerLimiter
+	server *http.Server
+	grpc   *grpc.Server
+}
+
+func newAdminServer(opts *Options, m *manager) (*adminServer, error) {
+	auth, err := newAdminAuth(opts, m.kubeClient)
+	if err != nil {
+		return nil, err
+	}
+	audit, err := newAuditLog(opts.AuditLog)
+	if err != nil {
+		return nil, err
+	}
+	// executions triggered by reconcile requests and by alerts count against the same global limit
+	global := newGlobalLimiter(opts.ReconcileGlobalInterval)
+	s := &adminServer{
+		opts:    opts,
+		manager: m,
+		mux:     http.NewServeMux(),
+		auth:    auth,
+		audit:   audit,
+		limits: map[string]*triggerLimiter{
+			"reconcile": newTriggerLimiter(opts.ReconcileCallerInterval, global),
+			"alerts":    newTriggerLimiter(opts.ReconcileCallerInterval, global),
+		},
+	}
+	s.mux.HandleFunc("/plan", s.handlePlan)
+	s.mux.HandleFunc("/approve", s.handleApprove)
+	s.mux.HandleFunc("/pause", s.handlePause)
+	s.mux.HandleFunc("/resume", s.handleResume)
+	s.mux.HandleFunc("/reconcile", s.handleReconcile)
+	s.mux.HandleFunc("/readyz", s.handleReady)
+	s.mux.HandleFunc("/config", s.handleConfig)
+	s.mux.HandleFunc("/status", s.handleStatus)
+	s.mux.HandleFunc("/alertmanager", s.handleAlerts)
+	s.mux.Handle("/metrics", prometheus.Handler())
+	return s, nil
+}
+
+// start serves the HTTP admin API on Options.AdminAddress and the gRPC admin API on
+// Options.AdminGRPCAddress, the ones which are set
+func (s *adminServer) start() error {
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
+	if s.opts.AdminGRPCAddress != "" {
+		if err := s.startGRPC(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if s.opts.AdminAddress == "" {
+		return nil
+	}
+
+	server := &http.Server{
+		Addr:      s.opts.AdminAddress,
+		Handler:   s.mux,
+		TLSConfig: tlsConfig,
+	}
+	s.server = server
+	if tlsConfig == nil {
+		glog.Infof("Starting admin API on %s\n", s.opts.AdminAddress)
+		go func() {
+			err := server.ListenAndServe()
+			if err != http.ErrServerClosed {
+				glog.Errorf("Admin API stopped %v", err)
+			}
+		}()
+		return nil
+	}
+	glog.Infof("Starting admin API with TLS on %s\n", s.opts.AdminAddress)
+	go func() {
+		err := server.ListenAndServeTLS("", "")
+		if err != http.ErrServerClosed {
+			glog.Errorf("Admin API stopped %v", err)
+		}
+	}()
+	return nil
+}
+
+// tlsConfig returns the TLS configuration shared by the HTTP and gRPC admin APIs, nil without
+// Options.AdminTLSCertFile
+func (s *adminServer) tlsConfig() (*tls.Config, error) {
+	if s.opts.AdminTLSCertFile == "" {
+		return nil, nil
+	}
+	reloader, err := newCertReloader(s.opts.AdminTLSCertFile, s.opts.AdminTLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.getCertificate,
+	}
+	if s.auth.clientCAs != nil {
+		config.ClientCAs = s.auth.clientCAs
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// stop closes the admin APIs
+func (s *adminServer) stop() {
+	if s.server != nil {
+		s.server.Close()
+	}
+	if s.grpc != nil {
+		s.grpc.Stop()
+	}
+}
+
+// handleReady returns 200 once a dry-run has succeeded, so that a misconfigured autoscaler
+// never becomes Ready
+func (s *adminServer) handleReady(w http.ResponseWriter, r *http.Request) {
+	if !s.manager.ready() {
+		http.Error(w, "no successful dry-run yet", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// handlePlan returns the plan waiting for approval
+func (s *adminServer) handlePlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	plan, err := PendingPlan(s.opts, s.clusterName(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if plan == nil {
+		http.Error(w, "no pending plan", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, plan)
+}
+
+// handleStatus returns the status and the latest executions of the cluster given as cluster
+// parameter, or of every managed cluster
+func (s *adminServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	statuses, err := s.manager.statuses(r.URL.Query().Get("cluster"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, StatusList{Clusters: statuses})
+}
+
+// handleApprove approves the pending plan, the optional id parameter must match the pending plan
+func (s *adminServer) handleApprove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := s.clusterName(r)
+	caller, ok := s.authorize(w, r, "approve", name)
+	if !ok {
+		return
+	}
+	plan, err := s.approve(r, caller, name, r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	writeJSON(w, http.StatusOK, plan)
+}
+
+// approve approves the pending plan of the cluster for the authorized caller
+func (s *adminServer) approve(r *http.Request, caller string, name string, id string) (*Plan, error) {
+	plan, err := Approve(s.opts, name, id, "admin-api "+caller+" "+r.RemoteAddr)
+	if err != nil {
+		s.audited(r, caller, "approve", name, err, "")
+		return nil, err
+	}
+	s.audited(r, caller, "approve", name, nil, "plan "+plan.ID)
+	glog.Infof("Plan %s approved by %s from %s\n", plan.ID, caller, r.RemoteAddr)
+	return plan, nil
+}
+
+// handlePause stops executions of the cluster until it is resumed or the autoscaler restarts
+func (s *adminServer) handlePause(w http.ResponseWriter, r *http.Request) {
+	s.clusterAction(w, r, "pause", "paused", func(name string) error {
+		return s.manager.setPaused(name, true)
+	})
+}
+
+// handleResume resumes the executions of paused cluster
+func (s *adminServer) handleResume(w http.ResponseWriter, r *http.Request) {
+	s.clusterAction(w, r, "resume", "resumed", func(name string) error {
+		return s.manager.setPaused(name, false)
+	})
+}
+
+// handleReconcile executes the cluster immediately
+func (s *adminServer) handleReconcile(w http.ResponseWriter, r *http.Request) {
+	s.clusterAction(w, r, "reconcile", "scheduled for execution", func(name string) error {
+		return s.manager.trigger(name)
+	})
+}
+
+func (s *adminServer) clusterAction(w http.ResponseWriter, r *http.Request, verb string, result string, action func(name string) error) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := s.clusterName(r)
+	caller, ok := s.authorize(w, r, verb, name)
+	if !ok {
+		return
+	}
+	if wait, status, err := s.runAction(r, caller, verb, name, result, action); err != nil {
+		if wait > 0 {
+			w.Header().Set("Retry-After", retryAfter(wait))
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"cluster": name, "result": result})
+}
+
+// runAction does the action to the cluster for the authorized caller, unless the caller is
+// throttled. On error the time to wait before retrying and the HTTP status are returned.
+func (s *adminServer) runAction(r *http.Request, caller string, verb string, name string, result string, action func(name string) error) (time.Duration, int, error) {
+	if l := s.limits[verb]; l != nil {
+		if wait := l.allow(limitKey(r, caller)); wait > 0 {
+			err := fmt.Errorf("too many %s requests, retry in %v", verb, wait.Round(time.Second))
+			s.audited(r, caller, verb, name, err, "")
+			return wait, http.StatusTooManyRequests, err
+		}
+	}
+	if err := action(name); err != nil {
+		s.audited(r, caller, verb, name, err, "")
+		return 0, http.StatusNotFound, err
+	}
+	s.audited(r, caller, verb, name, nil, "")
+	glog.Infof("Cluster %s %s by %s from %s\n", name, result, caller, r.RemoteAddr)
+	return 0, http.StatusOK, nil
+}
+
+// authorize returns the caller allowed to do verb to the cluster. Otherwise the error is written
+// to the response and false is returned.
+func (s *adminServer) authorize(w http.ResponseWriter, r *http.Request, verb string, cluster string) (string, bool) {
+	caller, status, err := s.checkCaller(r, verb, cluster)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return "", false
+	}
+	return caller, true
+}
+
+// checkCaller returns the caller allowed to do verb to the cluster. Denials are logged and
+// audited, and returned with their HTTP status.
+func (s *adminServer) checkCaller(r *http.Request, verb string, cluster string) (string, int, error) {
+	caller, status, err := s.auth.authorize(r, verb, cluster)
+	if err != nil {
+		glog.Warningf("Admin API %s of %s from %s denied: %v", verb, cluster, r.RemoteAddr, err)
+		s.audit.write(auditEntry{
+			RemoteAddr: r.RemoteAddr,
+			Action:     verb,
+			Cluster:    cluster,
+			Result:     "denied",
+			Detail:     err.Error(),
+		})
+		return "", status, err
+	}
+	return caller, http.StatusOK, nil
+}
+
+// audited writes the outcome of an authorized action to the audit log
+func (s *adminServer) audited(r *http.Request, caller string, verb string, cluster string, err error, detail string) {
+	entry := auditEntry{
+		Caller:     caller,
+		RemoteAddr: r.RemoteAddr,
+		Action:     verb,
+		Cluster:    cluster,
+		Result:     "ok",
+		Detail:     detail,
+	}
+	if err != nil {
+		entry.Result = "error"
+		entry.Detail = err.Error()
+	}
+	s.audit.write(entry)
+}
+
+// clusterName returns the cluster given as cluster parameter, defaults to the --name cluster
+func (s *adminServer) clusterName(r *http.Request) string {
+	if name := r.URL.Query().Get("cluster"); name != "" {
+		return name
+	}
+	return s.opts.ClusterName
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		glog.Errorf("Error writing response %v", err)
+	}
+}
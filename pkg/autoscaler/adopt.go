@@ -0,0 +1,271 @@
+package autoscaler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/images"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+// Adoption is a server created outside kops which matches a missing server of an instance group
+type Adoption struct {
+	ServerID      string `json:"serverID"`
+	Server        string `json:"server"`
+	InstanceGroup string `json:"instanceGroup"`
+	// Name is the name kops gives the missing server, the server and its port are renamed to it
+	Name    string `json:"name"`
+	PortID  string `json:"portID"`
+	Adopted bool   `json:"adopted"`
+}
+
+func (a *Adoption) String() string {
+	return fmt.Sprintf("%s (%s) as %s of instance group %s", a.Server, a.ServerID, a.Name, a.InstanceGroup)
+}
+
+// Adopt finds the servers which are not tagged to any cluster but match the image, flavor and
+// subnets of an instance group with less servers than its minSize, and unless dryRun is set, gives
+// them the names and the metadata kops expects, so that they are counted instead of created again.
+// The instance groups can be limited to instanceGroup.
+func Adopt(opts *Options, clusterName string, instanceGroup string, dryRun bool) ([]*Adoption, error) {
+	clientset, err := newClientset(opts)
+	if err != nil {
+		return nil, err
+	}
+	config, err := loadConfig(opts.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	osASG := &openstackASG{
+		opts:        opts,
+		clientset:   clientset,
+		clusterName: clusterName,
+		config:      config,
+	}
+	cluster, err := clientset.GetCluster(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cluster %q: %v", clusterName, err)
+	}
+	list, err := clientset.InstanceGroupsFor(cluster).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error reading instance groups of %s: %v", clusterName, err)
+	}
+	var instanceGroups []*kops.InstanceGroup
+	for i := range list.Items {
+		instanceGroups = append(instanceGroups, &list.Items[i])
+	}
+	cloud, err := osASG.cloudFor(cluster)
+	if err != nil {
+		return nil, err
+	}
+	adoptions, err := findAdoptions(cloud, clusterName, instanceGroups, instanceGroup)
+	if err != nil || dryRun {
+		return adoptions, err
+	}
+	for _, a := range adoptions {
+		if err := adopt(cloud, clusterName, instanceGroups, a); err != nil {
+			return adoptions, err
+		}
+	}
+	return adoptions, nil
+}
+
+// findAdoptions matches the untagged servers to the missing servers of the instance groups
+func findAdoptions(cloud openstack.OpenstackCloud, clusterName string, instanceGroups []*kops.InstanceGroup, instanceGroup string) ([]*Adoption, error) {
+	list, err := cloud.ListInstances(servers.ListOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing servers: %v", err)
+	}
+	taken := make(map[string]bool)
+	var candidates []servers.Server
+	for _, s := range list {
+		taken[s.Name] = true
+		if _, tagged := s.Metadata[openstack.TagClusterName]; tagged || s.Status != "ACTIVE" {
+			continue
+		}
+		if instanceGroupOf(clusterName, instanceGroups, s.Name) != "" {
+			continue
+		}
+		candidates = append(candidates, s)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Name < candidates[j].Name
+	})
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	flavorIDs, imageIDs, err := flavorAndImageIDs(cloud)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := append([]*kops.InstanceGroup{}, instanceGroups...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ObjectMeta.Name < sorted[j].ObjectMeta.Name
+	})
+	found := false
+	adopted := make(map[string]bool)
+	var adoptions []*Adoption
+	for _, ig := range sorted {
+		if instanceGroup != "" && ig.ObjectMeta.Name != instanceGroup {
+			continue
+		}
+		found = true
+		var missing []string
+		for i := 1; i <= int(fi.Int32Value(ig.Spec.MinSize)); i++ {
+			name := strings.ToLower(fmt.Sprintf("%s-%s-%d", clusterName, ig.ObjectMeta.Name, i))
+			if !taken[name] {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		subnetIDs, err := instanceGroupSubnetIDs(cloud, clusterName, ig)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range candidates {
+			if len(missing) == 0 {
+				break
+			}
+			if adopted[s.ID] || !matchesID(s.Image, ig.Spec.Image, imageIDs) || !matchesID(s.Flavor, ig.Spec.MachineType, flavorIDs) {
+				continue
+			}
+			portID, err := portInSubnets(cloud, s.ID, subnetIDs)
+			if err != nil {
+				return nil, err
+			}
+			if portID == "" {
+				continue
+			}
+			adopted[s.ID] = true
+			adoptions = append(adoptions, &Adoption{
+				ServerID:      s.ID,
+				Server:        s.Name,
+				InstanceGroup: ig.ObjectMeta.Name,
+				Name:          missing[0],
+				PortID:        portID,
+			})
+			missing = missing[1:]
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("instance group %q not found", instanceGroup)
+	}
+	return adoptions, nil
+}
+
+// flavorAndImageIDs returns the IDs of the flavors and images by name
+func flavorAndImageIDs(cloud openstack.OpenstackCloud) (map[string][]string, map[string][]string, error) {
+	page, err := flavors.ListDetail(cloud.ComputeClient(), flavors.ListOpts{}).AllPages()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing flavors: %v", err)
+	}
+	flavorList, err := flavors.ExtractFlavors(page)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing flavors: %v", err)
+	}
+	flavorIDs := make(map[string][]string)
+	for _, f := range flavorList {
+		flavorIDs[f.Name] = append(flavorIDs[f.Name], f.ID)
+	}
+	page, err = images.ListDetail(cloud.ComputeClient(), images.ListOpts{}).AllPages()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing images: %v", err)
+	}
+	imageList, err := images.ExtractImages(page)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing images: %v", err)
+	}
+	imageIDs := make(map[string][]string)
+	for _, i := range imageList {
+		imageIDs[i.Name] = append(imageIDs[i.Name], i.ID)
+	}
+	return flavorIDs, imageIDs, nil
+}
+
+// matchesID returns true if the image or flavor reference of the server is the named one. The
+// spec can also give the ID.
+func matchesID(ref map[string]interface{}, name string, ids map[string][]string) bool {
+	id, _ := ref["id"].(string)
+	if id == "" {
+		return false
+	}
+	if id == name {
+		return true
+	}
+	for _, candidate := range ids[name] {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// instanceGroupSubnetIDs returns the IDs of the subnets kops created for the instance group
+func instanceGroupSubnetIDs(cloud openstack.OpenstackCloud, clusterName string, ig *kops.InstanceGroup) (map[string]bool, error) {
+	ids := make(map[string]bool)
+	for _, subnet := range ig.Spec.Subnets {
+		name := subnet + "." + clusterName
+		list, err := cloud.ListSubnets(subnets.ListOpts{Name: name})
+		if err != nil {
+			return nil, fmt.Errorf("error finding subnet %s: %v", name, err)
+		}
+		for _, s := range list {
+			ids[s.ID] = true
+		}
+	}
+	return ids, nil
+}
+
+// portInSubnets returns the ID of the only port of the server, if it is in one of the subnets.
+// Servers with more ports do not look like kops servers and are not adopted.
+func portInSubnets(cloud openstack.OpenstackCloud, serverID string, subnetIDs map[string]bool) (string, error) {
+	list, err := cloud.ListPorts(ports.ListOpts{DeviceID: serverID})
+	if err != nil {
+		return "", fmt.Errorf("error listing ports of server %s: %v", serverID, err)
+	}
+	if len(list) != 1 {
+		return "", nil
+	}
+	for _, ip := range list[0].FixedIPs {
+		if subnetIDs[ip.SubnetID] {
+			return list[0].ID, nil
+		}
+	}
+	return "", nil
+}
+
+// adopt adds the metadata kops expects to the server and renames its port and the server. The
+// server is renamed last, as the name makes kops count it.
+func adopt(cloud openstack.OpenstackCloud, clusterName string, instanceGroups []*kops.InstanceGroup, a *Adoption) error {
+	var ig *kops.InstanceGroup
+	for _, g := range instanceGroups {
+		if g.ObjectMeta.Name == a.InstanceGroup {
+			ig = g
+		}
+	}
+	metadata := expectedMetadata(clusterName, ig)
+	if _, err := servers.UpdateMetadata(cloud.ComputeClient(), a.ServerID, servers.MetadataOpts(metadata)).Extract(); err != nil {
+		return fmt.Errorf("error updating metadata of server %s: %v", a.Server, err)
+	}
+	if _, err := ports.Update(cloud.NetworkingClient(), a.PortID, ports.UpdateOpts{Name: "port-" + a.Name}).Extract(); err != nil {
+		return fmt.Errorf("error renaming port %s of server %s: %v", a.PortID, a.Server, err)
+	}
+	if _, err := servers.Update(cloud.ComputeClient(), a.ServerID, servers.UpdateOpts{Name: a.Name}).Extract(); err != nil {
+		return fmt.Errorf("error renaming server %s: %v", a.Server, err)
+	}
+	a.Adopted = true
+	glog.Infof("Adopted server %s\n", a)
+	return nil
+}
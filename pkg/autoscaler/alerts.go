@@ -0,0 +1,223 @@
+package autoscaler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+// annotationAlertBaseSize is the minSize of the instance group before the alerts scaled it, so
+// that it can be restored when the alerts resolve
+const annotationAlertBaseSize = annotationPrefix + "alert-base-size"
+
+// AlertAction is the scaling action of an Alertmanager alert: while the alert is firing, Delta
+// nodes are added to the minSize of the instance group, up to its maxSize
+type AlertAction struct {
+	InstanceGroup string `json:"instanceGroup"`
+	Delta         int    `json:"delta"`
+}
+
+func validateAlerts(alerts map[string]AlertAction) error {
+	for name, a := range alerts {
+		if a.InstanceGroup == "" {
+			return fmt.Errorf("alert %s has no instanceGroup", name)
+		}
+		if a.Delta <= 0 {
+			return fmt.Errorf("delta of alert %s must be positive, not %d", name, a.Delta)
+		}
+	}
+	return nil
+}
+
+// alertmanagerPayload is the part of the Alertmanager webhook payload the autoscaler uses
+type alertmanagerPayload struct {
+	Alerts []struct {
+		Status string            `json:"status"`
+		Labels map[string]string `json:"labels"`
+	} `json:"alerts"`
+}
+
+// alertKey identifies an alert by its labels
+func alertKey(labels map[string]string) string {
+	var pairs []string
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// alertScaler tracks the firing alerts per instance group. The alerts are kept in memory only, and
+// Alertmanager repeats the firing ones after a restart.
+type alertScaler struct {
+	mu sync.Mutex
+	// firing contains the deltas of the firing alerts by cluster/instance group and alert
+	firing map[string]map[string]int
+}
+
+func newAlertScaler() *alertScaler {
+	return &alertScaler{firing: make(map[string]map[string]int)}
+}
+
+// AlertScaling is the minSize an instance group was scaled to by the alerts
+type AlertScaling struct {
+	Cluster       string `json:"cluster"`
+	InstanceGroup string `json:"instanceGroup"`
+	MinSize       int32  `json:"minSize"`
+}
+
+// handleAlerts receives Alertmanager webhooks. The alerts whose alertname has an action in the
+// config of a cluster scale its instance group. An alert with a cluster label applies to that
+// cluster only.
+func (s *adminServer) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	payload := &alertmanagerPayload{}
+	if err := json.NewDecoder(r.Body).Decode(payload); err != nil {
+		http.Error(w, fmt.Sprintf("error parsing payload: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	type target struct {
+		cluster string
+		action  AlertAction
+		key     string
+		firing  bool
+	}
+	var targets []target
+	callers := make(map[string]string)
+	for _, alert := range payload.Alerts {
+		name := alert.Labels["alertname"]
+		for cluster, c := range s.manager.config.Clusters {
+			action, ok := c.Alerts[name]
+			if !ok || (alert.Labels["cluster"] != "" && alert.Labels["cluster"] != cluster) {
+				continue
+			}
+			if _, ok := callers[cluster]; !ok {
+				caller, ok := s.authorize(w, r, "scale", cluster)
+				if !ok {
+					return
+				}
+				callers[cluster] = caller
+			}
+			targets = append(targets, target{cluster, action, alertKey(alert.Labels), alert.Status == "firing"})
+		}
+	}
+
+	a := s.manager.alerts
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	changed := make(map[string]bool)
+	for _, t := range targets {
+		group := t.cluster + "/" + t.action.InstanceGroup
+		if a.firing[group] == nil {
+			a.firing[group] = make(map[string]int)
+		}
+		if t.firing {
+			a.firing[group][t.key] = t.action.Delta
+		} else {
+			delete(a.firing[group], t.key)
+		}
+		changed[group] = true
+	}
+
+	var groups []string
+	for group := range changed {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	var scaled []AlertScaling
+	for _, group := range groups {
+		delta := 0
+		for _, d := range a.firing[group] {
+			delta += d
+		}
+		parts := strings.SplitN(group, "/", 2)
+		cluster, ig := parts[0], parts[1]
+		size, err := s.manager.scaleForAlerts(cluster, ig, delta)
+		s.audited(r, callers[cluster], "scale", cluster, err, fmt.Sprintf("instance group %s to minSize %d", ig, size))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		scaled = append(scaled, AlertScaling{Cluster: cluster, InstanceGroup: ig, MinSize: size})
+		// the new minSize is applied by the next scheduled execution when the trigger is throttled
+		if wait := s.limits["alerts"].allow(limitKey(r, callers[cluster])); wait > 0 {
+			glog.Infof("Not executing %s after alert scaling, throttled for %v\n", cluster, wait.Round(time.Second))
+			continue
+		}
+		if err := s.manager.trigger(cluster); err != nil {
+			glog.Warningf("Not executing %s after alert scaling: %v", cluster, err)
+		}
+	}
+	writeJSON(w, http.StatusOK, scaled)
+}
+
+// scaleForAlerts sets the minSize of the instance group to its size before the alerts plus
+// delta, within its maxSize. The size before the alerts is kept in an annotation while the
+// alerts fire, and restored when delta is 0.
+func (m *manager) scaleForAlerts(clusterName string, igName string, delta int) (int32, error) {
+	cluster, err := m.clientset.GetCluster(clusterName)
+	if err != nil {
+		return 0, fmt.Errorf("error reading cluster %q: %v", clusterName, err)
+	}
+	if cluster == nil {
+		return 0, fmt.Errorf("cluster %q not found", clusterName)
+	}
+	igs := m.clientset.InstanceGroupsFor(cluster)
+	ig, err := igs.Get(igName, metav1.GetOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("error reading instance group %s: %v", igName, err)
+	}
+	if ig == nil {
+		return 0, fmt.Errorf("instance group %s not found", igName)
+	}
+
+	current := fi.Int32Value(ig.Spec.MinSize)
+	base := current
+	v, scaled := ig.ObjectMeta.Annotations[annotationAlertBaseSize]
+	if scaled {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid annotation %s %q of instance group %s", annotationAlertBaseSize, v, igName)
+		}
+		base = int32(n)
+	}
+	size := base + int32(delta)
+	if ig.Spec.MaxSize != nil && size > *ig.Spec.MaxSize {
+		size = *ig.Spec.MaxSize
+	}
+	if size < base {
+		size = base
+	}
+	if size == current && scaled == (delta > 0) {
+		return size, nil
+	}
+
+	updated := ig.DeepCopy()
+	updated.Spec.MinSize = fi.Int32(size)
+	if delta > 0 {
+		if updated.ObjectMeta.Annotations == nil {
+			updated.ObjectMeta.Annotations = make(map[string]string)
+		}
+		updated.ObjectMeta.Annotations[annotationAlertBaseSize] = strconv.Itoa(int(base))
+	} else {
+		delete(updated.ObjectMeta.Annotations, annotationAlertBaseSize)
+	}
+	if _, err := igs.Update(updated); err != nil {
+		return 0, fmt.Errorf("error updating instance group %s: %v", igName, err)
+	}
+	glog.Infof("Alerts scaled instance group %s of %s from minSize %d to %d\n", igName, clusterName, current, size)
+	return size, nil
+}
@@ -0,0 +1,203 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	v2pools "github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+const (
+	// apiPoolPort is the port of the masters in the API load balancer pool
+	apiPoolPort = 443
+	// lbActiveTimeout is the maximum time to wait for the load balancer to provision a change
+	lbActiveTimeout = 2 * time.Minute
+)
+
+// poolDrift is the difference between the members of the API load balancer pool and the masters
+type poolDrift struct {
+	poolID string
+	lbID   string
+	// add are the members missing for master servers
+	add []v2pools.CreateMemberOpts
+	// remove are the members whose address is not of any master server
+	remove []v2pools.Member
+}
+
+// changes describes the drift as creates and deletes of the pool association tasks
+func (d *poolDrift) changes() []Change {
+	var changes []Change
+	for _, m := range d.add {
+		changes = append(changes, Change{
+			Key:    "PoolAssociation/" + m.Name + "/" + m.Address,
+			Type:   "PoolAssociation",
+			Name:   m.Name + "/" + m.Address,
+			Action: actionCreate,
+			Kind:   kindDrift,
+		})
+	}
+	for _, m := range d.remove {
+		changes = append(changes, Change{
+			Key:    "PoolAssociation/" + m.Name + "/" + m.Address,
+			Type:   "PoolAssociation",
+			Name:   m.Name + "/" + m.Address,
+			Action: actionDelete,
+			Kind:   kindDrift,
+		})
+	}
+	return changes
+}
+
+// apiPoolDrift compares the members of the API load balancer pool to the fixed addresses of the
+// master servers. Only members named after the master server groups, as created by kops, are
+// removed. Returns nil if the cluster has no API load balancer or there is nothing to do.
+func (osASG *openstackASG) apiPoolDrift(cloud openstack.OpenstackCloud, list []servers.Server) (*poolDrift, error) {
+	cluster := osASG.ApplyCmd.Cluster
+	if cluster.Spec.API == nil || cluster.Spec.API.LoadBalancer == nil {
+		return nil, nil
+	}
+	if caps := osASG.features(); caps != nil && caps.loadBalancers == "" {
+		return nil, nil
+	}
+	poolName := cluster.Spec.MasterPublicName + "-https"
+	pools, err := cloud.ListPools(v2pools.ListOpts{Name: poolName})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pools: %v", err)
+	}
+	if len(pools) == 0 {
+		// not created yet
+		return nil, nil
+	}
+	if len(pools) > 1 || len(pools[0].Loadbalancers) == 0 {
+		return nil, fmt.Errorf("found %d pools with name %s", len(pools), poolName)
+	}
+	pool := pools[0]
+	lb, err := cloud.GetLB(pool.Loadbalancers[0].ID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading load balancer of pool %s: %v", poolName, err)
+	}
+	if lb.ProvisioningStatus != "ACTIVE" {
+		glog.Infof("Load balancer %s is %s, not checking pool members\n", lb.Name, lb.ProvisioningStatus)
+		return nil, nil
+	}
+	page, err := v2pools.ListMembers(cloud.LoadBalancerClient(), pool.ID, v2pools.ListMembersOpts{}).AllPages()
+	if err != nil {
+		return nil, fmt.Errorf("error listing members of pool %s: %v", poolName, err)
+	}
+	members, err := v2pools.ExtractMembers(page)
+	if err != nil {
+		return nil, fmt.Errorf("error listing members of pool %s: %v", poolName, err)
+	}
+
+	masterGroups := make(map[string]bool)
+	for _, ig := range osASG.ApplyCmd.InstanceGroups {
+		if ig.Spec.Role == kops.InstanceGroupRoleMaster {
+			masterGroups[osASG.clusterName+"-"+ig.ObjectMeta.Name] = true
+		}
+	}
+	// expected members by address, of the IP version of the load balancer on dual-stack subnets
+	version := ipVersion(lb.VipAddress)
+	expected := make(map[string]string)
+	for _, s := range list {
+		ig := osASG.instanceGroupFor(s.Name)
+		group := osASG.clusterName + "-" + ig
+		if ig == "" || !masterGroups[group] {
+			continue
+		}
+		address := fixedAddress(&s, osASG.clusterName, version)
+		if address == "" {
+			// the server has no address yet
+			continue
+		}
+		expected[address] = group
+	}
+
+	d := &poolDrift{poolID: pool.ID, lbID: lb.ID}
+	found := make(map[string]bool)
+	for _, m := range members {
+		address := canonicalIP(m.Address)
+		if _, ok := expected[address]; ok && m.ProtocolPort == apiPoolPort {
+			found[address] = true
+			continue
+		}
+		// never empty the pool, e.g. when the servers could not be listed correctly
+		if masterGroups[m.Name] && len(expected) > 0 {
+			d.remove = append(d.remove, m)
+		}
+	}
+	for address, group := range expected {
+		if !found[address] {
+			d.add = append(d.add, v2pools.CreateMemberOpts{
+				Name:         group,
+				Address:      address,
+				ProtocolPort: apiPoolPort,
+				SubnetID:     lb.VipSubnetID,
+			})
+		}
+	}
+	if len(d.add) == 0 && len(d.remove) == 0 {
+		return nil, nil
+	}
+	sort.Slice(d.add, func(i, j int) bool {
+		return d.add[i].Address < d.add[j].Address
+	})
+	sort.Slice(d.remove, func(i, j int) bool {
+		return d.remove[i].Address < d.remove[j].Address
+	})
+	return d, nil
+}
+
+// fixAPIPool adds the missing masters to the API load balancer pool before removing the stale members
+func (osASG *openstackASG) fixAPIPool(d *poolDrift) error {
+	cloud, err := osASG.openstackCloud()
+	if err != nil {
+		return err
+	}
+	// the load balancer is immutable while the previous change is provisioned
+	for _, m := range d.add {
+		if err := waitLBActive(osASG.ctx(), cloud, d.lbID); err != nil {
+			return err
+		}
+		glog.Infof("Adding %s (%s) to API load balancer pool\n", m.Address, m.Name)
+		if _, err := v2pools.CreateMember(cloud.LoadBalancerClient(), d.poolID, m).Extract(); err != nil {
+			return fmt.Errorf("error adding %s to API load balancer pool: %v", m.Address, err)
+		}
+		osASG.record("added %s to API load balancer pool", m.Address)
+	}
+	for _, m := range d.remove {
+		if err := waitLBActive(osASG.ctx(), cloud, d.lbID); err != nil {
+			return err
+		}
+		glog.Infof("Removing %s (%s) from API load balancer pool\n", m.Address, m.Name)
+		if err := v2pools.DeleteMember(cloud.LoadBalancerClient(), d.poolID, m.ID).ExtractErr(); err != nil {
+			return fmt.Errorf("error removing %s from API load balancer pool: %v", m.Address, err)
+		}
+		osASG.record("removed %s from API load balancer pool", m.Address)
+	}
+	return nil
+}
+
+func waitLBActive(ctx context.Context, cloud openstack.OpenstackCloud, id string) error {
+	deadline := time.Now().Add(lbActiveTimeout)
+	for {
+		lb, err := cloud.GetLB(id)
+		if err != nil {
+			return fmt.Errorf("error reading load balancer %s: %v", id, err)
+		}
+		if lb.ProvisioningStatus == "ACTIVE" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("load balancer %s is still %s after %v", lb.Name, lb.ProvisioningStatus, lbActiveTimeout)
+		}
+		if err := sleepContext(ctx, 5*time.Second); err != nil {
+			return err
+		}
+	}
+}
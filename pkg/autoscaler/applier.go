@@ -0,0 +1,40 @@
+package autoscaler
+
+// Applier finds and applies the changes of a cluster. The reconcile loop decides whether and when
+// a plan is applied: confirmation, approval, deletion limits, quorum and capacity checks, delays
+// and the reporting happen outside of the Applier.
+type Applier interface {
+	// DryRun returns the plan with the changes needed to make the servers of the cluster match
+	// its specs in the state store
+	DryRun() (*Plan, error)
+	// Apply applies the plan returned by DryRun. Plan.CloudOnly is set when the API server of the
+	// cluster is not reachable, and the steps which need it must be skipped.
+	Apply(plan *Plan) error
+}
+
+// ApplierFunc returns the Applier for the cluster, or nil for the kops-backed default
+type ApplierFunc func(cluster string) Applier
+
+// kopsApplier is the default Applier, which runs the dry-run and the tasks of the embedded kops
+// ApplyClusterCmd
+type kopsApplier struct {
+	osASG *openstackASG
+}
+
+func (a *kopsApplier) DryRun() (*Plan, error) {
+	return a.osASG.dryRun()
+}
+
+func (a *kopsApplier) Apply(plan *Plan) error {
+	return a.osASG.update(plan, plan.CloudOnly)
+}
+
+// newApplier returns the Applier of the cluster
+func newApplier(osASG *openstackASG, f ApplierFunc) Applier {
+	if f != nil {
+		if a := f(osASG.clusterName); a != nil {
+			return a
+		}
+	}
+	return &kopsApplier{osASG: osASG}
+}
@@ -0,0 +1,282 @@
+package autoscaler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/apis/kops/registry"
+	"k8s.io/kops/pkg/client/simple/vfsclientset"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstacktasks"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// applyTasks executes the instance scope tasks built by the latest dry-run against OpenStack.
+// Tasks for which skip returns true, and all tasks depending on them, are not executed.
+func (osASG *openstackASG) applyTasks(skip func(key string, task fi.Task) bool) error {
+	c := osASG.ApplyCmd
+	cluster := c.Cluster
+
+	cloud, err := osASG.openstackCloud()
+	if err != nil {
+		return err
+	}
+	keyStore, secretStore, err := osASG.stores(cluster)
+	if err != nil {
+		return err
+	}
+	configBase, err := vfs.Context.BuildVfsPath(cluster.Spec.ConfigBase)
+	if err != nil {
+		return fmt.Errorf("error parsing config base %q: %v", cluster.Spec.ConfigBase, err)
+	}
+
+	// same as kops update cluster --yes, new instances read their configuration from these
+	start := time.Now()
+	err = registry.WriteConfigDeprecated(cluster, configBase.Join(registry.PathClusterCompleted), cluster)
+	observeStateStore(backendOf(configBase), "write_cluster_completed", start, err)
+	if err != nil {
+		return fmt.Errorf("error writing completed cluster spec: %v", err)
+	}
+	vfsMirror := vfsclientset.NewInstanceGroupMirror(cluster, configBase)
+	// temporary changes in ApplyCmd are never written to the state store. The instance groups are
+	// not written back either: alerts and metric targets may have changed their minSize during the
+	// execution, so they are read again and only mirrored.
+	for _, read := range osASG.instanceGroups {
+		g, err := c.Clientset.InstanceGroupsFor(cluster).Get(read.ObjectMeta.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error reading InstanceGroup %q from registry: %v", read.ObjectMeta.Name, err)
+		}
+		start := time.Now()
+		err = vfsMirror.WriteMirror(g)
+		observeStateStore(backendOf(configBase), "write_instancegroup_mirror", start, err)
+		if err != nil {
+			return fmt.Errorf("error writing instance group spec to mirror: %v", err)
+		}
+	}
+
+	infraLifecycle := fi.LifecycleExistsAndWarnIfChanges
+	if osASG.opts.ManageInfrastructure {
+		infraLifecycle = fi.LifecycleSync
+	}
+	unmanaged := instanceTasks(c.TaskMap, func(i *openstacktasks.Instance) bool {
+		name := taskName(i)
+		return !osASG.managedInstance(name) || osASG.foreign[name] != "" || osASG.deferred[name] || osASG.postponed[name]
+	})
+	skipTask := func(key string, task fi.Task) bool {
+		return unmanaged[task] || osASG.providerFloatingIP(task) || osASG.skippedTask(task) || (skip != nil && skip(key, task))
+	}
+	restore := setLifecycles(c.TaskMap, scopeTasks(c.TaskMap, infraLifecycle, skipTask))
+	defer restore()
+
+	userData, err := loadUserData(osASG.opts.ExtraUserData)
+	if err != nil {
+		return err
+	}
+	createCloud := newInstanceCloud(cloud, osASG.clusterName, c.InstanceGroups, userData, osASG.providerNetworks, osASG.opts)
+	createCloud.zones = osASG.capacityZones
+	createCloud.ctx = osASG.ctx()
+	target := openstack.NewOpenstackAPITarget(createCloud)
+	context, err := fi.NewContext(target, cluster, createCloud, keyStore, secretStore, configBase, true, c.TaskMap)
+	if err != nil {
+		return fmt.Errorf("error building context: %v", err)
+	}
+	defer context.Close()
+
+	var options fi.RunTasksOptions
+	options.InitDefaults()
+	if osASG.opts.MaxTaskDuration > 0 {
+		options.MaxTaskDuration = osASG.opts.MaxTaskDuration
+	}
+	if osASG.opts.TaskRetryInterval > 0 {
+		options.WaitAfterAllTasksFailed = osASG.opts.TaskRetryInterval
+	}
+	err = context.RunTasks(options)
+	rejection := createCloud.quotaRejection()
+	if rejection != "" {
+		osASG.quotaError = rejection
+	}
+	if err != nil {
+		err = fmt.Errorf("error running tasks: %v", err)
+		if rejection != "" {
+			return &ErrQuotaExceeded{Message: rejection, Err: err}
+		}
+		return err
+	}
+	return target.Finish(c.TaskMap)
+}
+
+// instanceScope contains the task types which are fully managed in direct applies. By default other
+// tasks are only checked for existence and changes, so the autoscaler can never rewrite cluster networking.
+var instanceScope = map[string]bool{
+	"Instance":   true,
+	"Port":       true,
+	"FloatingIP": true,
+}
+
+// scopeTasks returns the lifecycles to set for the direct apply. Tasks outside of instance scope
+// get infraLifecycle. Tasks selected by skip are ignored together with the tasks depending on them.
+func scopeTasks(taskMap map[string]fi.Task, infraLifecycle fi.Lifecycle, skip func(key string, task fi.Task) bool) map[string]fi.Lifecycle {
+	skipped := make(map[string]bool)
+	for k, t := range taskMap {
+		if skip != nil && skip(k, t) {
+			skipped[k] = true
+		}
+		// the server group is not created by the autoscaler, kops update cluster must be used for new groups
+		if i, ok := t.(*openstacktasks.Instance); ok && (i.ServerGroup == nil || i.ServerGroup.ID == nil) {
+			glog.Warningf("Server group of instance %s does not exist, skipping it", k)
+			skipped[k] = true
+		}
+	}
+
+	dependencies := fi.FindTaskDependencies(taskMap)
+	for changed := true; changed; {
+		changed = false
+		for k, deps := range dependencies {
+			if skipped[k] {
+				continue
+			}
+			for _, dep := range deps {
+				if skipped[dep] {
+					skipped[k] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	lifecycles := make(map[string]fi.Lifecycle)
+	for k, t := range taskMap {
+		if skipped[k] {
+			lifecycles[k] = fi.LifecycleIgnore
+		} else if !instanceScope[fi.TypeNameForTask(t)] {
+			lifecycles[k] = infraLifecycle
+		}
+	}
+	return lifecycles
+}
+
+// instanceTasks returns the instance tasks selected by match together with their ports
+func instanceTasks(taskMap map[string]fi.Task, match func(i *openstacktasks.Instance) bool) map[fi.Task]bool {
+	tasks := make(map[fi.Task]bool)
+	for _, t := range taskMap {
+		if i, ok := t.(*openstacktasks.Instance); ok && match(i) {
+			tasks[i] = true
+			if i.Port != nil {
+				tasks[i.Port] = true
+			}
+		}
+	}
+	return tasks
+}
+
+// managedInstance returns false if the server belongs to instance group excluded by the cluster settings
+func (osASG *openstackASG) managedInstance(server string) bool {
+	if osASG.settings == nil || osASG.settings.instanceGroups == nil {
+		return true
+	}
+	ig := osASG.instanceGroupFor(server)
+	return ig == "" || osASG.settings.instanceGroups[ig]
+}
+
+// managedChange returns false for changes of servers, ports and floating ips in instance
+// groups excluded by the cluster settings
+func (osASG *openstackASG) managedChange(c Change) bool {
+	if server := changeInstance(c); server != "" {
+		return osASG.managedInstance(server)
+	}
+	return true
+}
+
+// changeInstance returns the name of the server the change belongs to, or empty string
+// if the change is not in instance scope
+func changeInstance(c Change) string {
+	switch c.Type {
+	case "Instance":
+		return c.Name
+	case "Port":
+		return strings.TrimPrefix(c.Name, "port-")
+	case "FloatingIP":
+		return strings.TrimPrefix(c.Name, "fip-")
+	}
+	return ""
+}
+
+// setLifecycles overrides the lifecycles of the tasks. The returned function restores the original lifecycles.
+func setLifecycles(taskMap map[string]fi.Task, lifecycles map[string]fi.Lifecycle) func() {
+	original := make(map[fi.HasLifecycle]*fi.Lifecycle)
+	for k, lifecycle := range lifecycles {
+		hl, ok := taskMap[k].(fi.HasLifecycle)
+		if !ok {
+			glog.Warningf("task %s does not have lifecycle, it can not be changed to %s", k, lifecycle)
+			continue
+		}
+		glog.V(2).Infof("Setting lifecycle of task %s to %s", k, lifecycle)
+		original[hl] = hl.GetLifecycle()
+		hl.SetLifecycle(lifecycle)
+	}
+	return func() {
+		for hl, lifecycle := range original {
+			if lifecycle == nil {
+				hl.SetLifecycle(fi.LifecycleSync)
+				continue
+			}
+			hl.SetLifecycle(*lifecycle)
+		}
+	}
+}
+
+func (osASG *openstackASG) openstackCloud() (openstack.OpenstackCloud, error) {
+	return osASG.cloudFor(osASG.ApplyCmd.Cluster)
+}
+
+// buildOpenstackCloud builds the cloud of the cluster, using the API microversions set in the options
+func buildOpenstackCloud(cluster *kops.Cluster, opts *Options, scope keystoneScope) (openstack.OpenstackCloud, error) {
+	authURL, err := identityEndpoint(opts, scope)
+	if err != nil {
+		return nil, err
+	}
+	var cloud fi.Cloud
+	err = withCredentials(scope, authURL, func() error {
+		var err error
+		cloud, err = cloudup.BuildCloud(cluster)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error building cloud: %v", err)
+	}
+	osCloud, ok := cloud.(openstack.OpenstackCloud)
+	if !ok {
+		return nil, fmt.Errorf("cluster %q is not an openstack cluster", cluster.ObjectMeta.Name)
+	}
+	// the service clients share the provider client
+	provider := osCloud.ComputeClient().ProviderClient
+	enableReauth(provider, scope, authURL)
+	if err := selectLBService(osCloud, opts.LBProvider); err != nil {
+		return nil, err
+	}
+	failoverEndpoints(osCloud, splitList(opts.EndpointFallbacks))
+	if opts.Chaos > 0 {
+		provider.HTTPClient.Transport = newChaosTransport(provider.HTTPClient.Transport, opts.Chaos)
+	}
+	if opts.APIRetries > 0 {
+		provider.HTTPClient.Transport = newThrottleTransport(provider.HTTPClient.Transport, opts)
+	}
+	if opts.ComputeMicroversion != "" {
+		osCloud.ComputeClient().Microversion = opts.ComputeMicroversion
+	}
+	if opts.NetworkMicroversion != "" {
+		osCloud.NetworkingClient().Microversion = opts.NetworkMicroversion
+	}
+	return osCloud, nil
+}
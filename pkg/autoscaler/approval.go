@@ -0,0 +1,149 @@
+package autoscaler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/kops/pkg/client/simple"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// planFile is the location of the pending plan, relative to the cluster config base
+const planFile = "autoscaler/plan.json"
+
+func planPath(clientset simple.Clientset, clusterName string) (vfs.Path, error) {
+	cluster, err := clientset.GetCluster(clusterName)
+	if err != nil {
+		return nil, &ErrStateStoreUnavailable{Err: fmt.Errorf("error reading cluster %q: %v", clusterName, err)}
+	}
+	configBase, err := clientset.ConfigBaseFor(cluster)
+	if err != nil {
+		return nil, err
+	}
+	return configBase.Join(planFile), nil
+}
+
+func readPlan(p vfs.Path) (*Plan, error) {
+	start := time.Now()
+	data, err := p.ReadFile()
+	if err != nil && os.IsNotExist(err) {
+		observeStateStore(backendOf(p), "read_plan", start, nil)
+		return nil, nil
+	}
+	observeStateStore(backendOf(p), "read_plan", start, err)
+	if err != nil {
+		return nil, &ErrStateStoreUnavailable{Err: fmt.Errorf("error reading plan %s: %v", p.Path(), err)}
+	}
+	plan := &Plan{}
+	if err := json.Unmarshal(data, plan); err != nil {
+		return nil, fmt.Errorf("error parsing plan %s: %v", p.Path(), err)
+	}
+	return plan, nil
+}
+
+func writePlan(p vfs.Path, plan *Plan) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = p.WriteFile(bytes.NewReader(data), nil)
+	observeStateStore(backendOf(p), "write_plan", start, err)
+	if err != nil {
+		return &ErrStateStoreUnavailable{Err: fmt.Errorf("error writing plan %s: %v", p.Path(), err)}
+	}
+	return nil
+}
+
+// approved checks the plan against the pending plan in state store. If the pending plan
+// does not match the given plan, the given plan is stored as the new pending plan.
+func (osASG *openstackASG) approved(plan *Plan) (bool, error) {
+	p, err := planPath(osASG.clientset, osASG.clusterName)
+	if err != nil {
+		return false, err
+	}
+	pending, err := readPlan(p)
+	if err != nil {
+		return false, err
+	}
+	if pending != nil && pending.ID == plan.ID {
+		if pending.Approved {
+			glog.Infof("Plan %s approved by %s\n", pending.ID, pending.ApprovedBy)
+			return true, nil
+		}
+		glog.Infof("Plan %s is waiting for approval\n", pending.ID)
+		return false, nil
+	}
+
+	if err := writePlan(p, plan); err != nil {
+		return false, err
+	}
+	glog.Infof("Wrote pending plan to %s, waiting for approval\n%s", p.Path(), plan)
+	return false, nil
+}
+
+// clearPlan removes the pending plan after it has been applied
+func (osASG *openstackASG) clearPlan() error {
+	p, err := planPath(osASG.clientset, osASG.clusterName)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = p.Remove()
+	if err != nil && os.IsNotExist(err) {
+		err = nil
+	}
+	observeStateStore(backendOf(p), "remove_plan", start, err)
+	if err != nil {
+		return &ErrStateStoreUnavailable{Err: fmt.Errorf("error removing plan %s: %v", p.Path(), err)}
+	}
+	return nil
+}
+
+// PendingPlan returns the plan of the cluster waiting for approval, or nil if there is none
+func PendingPlan(opts *Options, clusterName string) (*Plan, error) {
+	clientset, err := newClientset(opts)
+	if err != nil {
+		return nil, err
+	}
+	p, err := planPath(clientset, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	return readPlan(p)
+}
+
+// Approve marks the pending plan of the cluster approved. If id is given, it must match
+// the id of the pending plan so that a plan which changed after review is not approved.
+func Approve(opts *Options, clusterName string, id string, approver string) (*Plan, error) {
+	clientset, err := newClientset(opts)
+	if err != nil {
+		return nil, err
+	}
+	p, err := planPath(clientset, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := readPlan(p)
+	if err != nil {
+		return nil, err
+	}
+	if plan == nil {
+		return nil, fmt.Errorf("no pending plan for cluster %q", clusterName)
+	}
+	if id != "" && id != plan.ID {
+		return nil, fmt.Errorf("pending plan is %s, not %s", plan.ID, id)
+	}
+	now := time.Now().UTC()
+	plan.Approved = true
+	plan.ApprovedBy = approver
+	plan.ApprovedAt = &now
+	if err := writePlan(p, plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
@@ -0,0 +1,28 @@
+package autoscaler
+
+import (
+	"github.com/golang/glog"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+// applyAssets overrides the asset locations of the cluster with the mirrors set in the options,
+// so that servers created in air-gapped clouds pull nodeup and images from internal mirrors.
+// The spec in state store is not changed.
+func applyAssets(cluster *kops.Cluster, opts *Options) {
+	if opts.AssetsContainerRegistry == "" && opts.AssetsFileRepository == "" {
+		return
+	}
+	if cluster.Spec.Assets == nil {
+		cluster.Spec.Assets = &kops.Assets{}
+	}
+	assets := cluster.Spec.Assets
+	if opts.AssetsContainerRegistry != "" && fi.StringValue(assets.ContainerRegistry) != opts.AssetsContainerRegistry {
+		glog.V(2).Infof("Using container registry %s for %s\n", opts.AssetsContainerRegistry, cluster.ObjectMeta.Name)
+		assets.ContainerRegistry = fi.String(opts.AssetsContainerRegistry)
+	}
+	if opts.AssetsFileRepository != "" && fi.StringValue(assets.FileRepository) != opts.AssetsFileRepository {
+		glog.V(2).Infof("Using file repository %s for %s\n", opts.AssetsFileRepository, cluster.ObjectMeta.Name)
+		assets.FileRepository = fi.String(opts.AssetsFileRepository)
+	}
+}
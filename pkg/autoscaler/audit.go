@@ -0,0 +1,93 @@
+package autoscaler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// auditEntry is a single admin API mutation in the audit log. Each entry contains the hash of
+// the previous entry, so that removed or modified entries break the chain.
+type auditEntry struct {
+	Time       time.Time `json:"time"`
+	Caller     string    `json:"caller"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Action     string    `json:"action"`
+	Cluster    string    `json:"cluster"`
+	Result     string    `json:"result"`
+	Detail     string    `json:"detail,omitempty"`
+	PrevHash   string    `json:"prevHash"`
+	Hash       string    `json:"hash,omitempty"`
+}
+
+// auditLog appends admin API mutations as JSON lines to a file separate from the normal logs
+type auditLog struct {
+	mu   sync.Mutex
+	file *os.File
+	last string
+}
+
+// newAuditLog opens the audit log for appending and continues the hash chain of the existing entries
+func newAuditLog(path string) (*auditLog, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading audit log: %v", err)
+	}
+	a := &auditLog{}
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	if last := lines[len(lines)-1]; len(last) > 0 {
+		entry := auditEntry{}
+		if err := json.Unmarshal(last, &entry); err != nil {
+			return nil, fmt.Errorf("error parsing last entry of audit log %s: %v", path, err)
+		}
+		a.last = entry.Hash
+	}
+	a.file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log: %v", err)
+	}
+	return a, nil
+}
+
+// write appends the entry to the log. Failures are logged, the action itself has already happened.
+func (a *auditLog) write(entry auditEntry) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry.Time = time.Now().UTC()
+	entry.PrevHash = a.last
+	entry.Hash = ""
+	data, err := json.Marshal(entry)
+	if err != nil {
+		glog.Errorf("Error encoding audit entry %v", err)
+		return
+	}
+	h := sha256.Sum256(data)
+	entry.Hash = hex.EncodeToString(h[:])
+	data, err = json.Marshal(entry)
+	if err != nil {
+		glog.Errorf("Error encoding audit entry %v", err)
+		return
+	}
+	if _, err := a.file.Write(append(data, '\n')); err != nil {
+		glog.Errorf("Error writing audit log %v", err)
+		return
+	}
+	if err := a.file.Sync(); err != nil {
+		glog.Errorf("Error syncing audit log %v", err)
+	}
+	a.last = entry.Hash
+}
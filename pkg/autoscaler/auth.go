@@ -0,0 +1,122 @@
+package autoscaler
+
+import (
+	"crypto/subtle"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// adminResourceGroup is the API group of the SubjectAccessReviews for the admin API, e.g. RBAC rule
+// apiGroups: [kops-autoscaler-openstack], resources: [clusters], verbs: [approve, pause, resume, reconcile, scale]
+const adminResourceGroup = "kops-autoscaler-openstack"
+
+// adminAuth authenticates and authorizes the callers of the mutating admin API endpoints.
+// Callers are accepted with a client certificate signed by the client CA, with the static
+// bearer token or with a kubernetes token allowed by SubjectAccessReview.
+type adminAuth struct {
+	token      string
+	clientCAs  *x509.CertPool
+	kubeClient kubernetes.Interface
+}
+
+func newAdminAuth(opts *Options, kubeClient kubernetes.Interface) (*adminAuth, error) {
+	a := &adminAuth{}
+	if opts.AdminTokenFile != "" {
+		data, err := ioutil.ReadFile(opts.AdminTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading admin token: %v", err)
+		}
+		a.token = strings.TrimSpace(string(data))
+		if a.token == "" {
+			return nil, fmt.Errorf("admin token file %s is empty", opts.AdminTokenFile)
+		}
+		registerSecret(a.token)
+	}
+	if opts.AdminClientCAFile != "" {
+		data, err := ioutil.ReadFile(opts.AdminClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading admin client CA: %v", err)
+		}
+		a.clientCAs = x509.NewCertPool()
+		if !a.clientCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.AdminClientCAFile)
+		}
+	}
+	if opts.AdminKubeAuth {
+		a.kubeClient = kubeClient
+	}
+	return a, nil
+}
+
+// enabled returns true if any authentication method is configured
+func (a *adminAuth) enabled() bool {
+	return a.token != "" || a.clientCAs != nil || a.kubeClient != nil
+}
+
+// authorize returns the identity of the caller allowed to do verb to the cluster. If the caller
+// is not allowed, the HTTP status and the reason are returned.
+func (a *adminAuth) authorize(r *http.Request, verb string, cluster string) (string, int, error) {
+	if !a.enabled() {
+		return "anonymous", http.StatusOK, nil
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return "cert:" + r.TLS.VerifiedChains[0][0].Subject.CommonName, http.StatusOK, nil
+	}
+
+	token := ""
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	}
+	if token == "" {
+		return "", http.StatusUnauthorized, fmt.Errorf("authentication required")
+	}
+	if a.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1 {
+		return "token", http.StatusOK, nil
+	}
+	if a.kubeClient == nil {
+		return "", http.StatusUnauthorized, fmt.Errorf("invalid token")
+	}
+
+	review, err := a.kubeClient.AuthenticationV1().TokenReviews().Create(&authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	})
+	if err != nil {
+		return "", http.StatusInternalServerError, fmt.Errorf("error reviewing token: %v", err)
+	}
+	if !review.Status.Authenticated {
+		return "", http.StatusUnauthorized, fmt.Errorf("invalid token")
+	}
+	user := review.Status.User
+	extra := make(map[string]authorizationv1.ExtraValue)
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	sar, err := a.kubeClient.AuthorizationV1().SubjectAccessReviews().Create(&authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Group:    adminResourceGroup,
+				Resource: "clusters",
+				Name:     cluster,
+				Verb:     verb,
+			},
+		},
+	})
+	if err != nil {
+		return "", http.StatusInternalServerError, fmt.Errorf("error reviewing access: %v", err)
+	}
+	if !sar.Status.Allowed {
+		return "", http.StatusForbidden, fmt.Errorf("%s is not allowed to %s cluster %s", user.Username, verb, cluster)
+	}
+	return "kube:" + user.Username, http.StatusOK, nil
+}
@@ -1,89 +1,710 @@
 package autoscaler
 
 import (
+	"context"
 	"fmt"
-	//"strings"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/pkg/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/kops/pkg/apis/kops"
 	"k8s.io/kops/pkg/client/simple"
 	"k8s.io/kops/pkg/client/simple/vfsclientset"
 	"k8s.io/kops/upup/pkg/fi"
 	"k8s.io/kops/upup/pkg/fi/cloudup"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstacktasks"
 	"k8s.io/kops/util/pkg/vfs"
 )
 
 // Options contains startup variables from cobra cmd
 type Options struct {
-	Sleep          int
-	StateStore     string
-	AccessKey      string
-	SecretKey      string
+	Sleep      int
+	StateStore string
+	AccessKey  string
+	SecretKey  string
+	// AccessKeyFile and SecretKeyFile are mounted secret files the S3 credentials are read from
+	AccessKeyFile  string
+	SecretKeyFile  string
 	CustomEndpoint string
 	ClusterName    string
+	// RequireApproval stores detected changes as a pending plan which must be approved before applying
+	RequireApproval bool
+	// ConfirmDrift requires the same changes to be found in two consecutive executions before applying
+	ConfirmDrift bool
+	// Canary creates first one of the new instances and waits until it is Ready before creating the rest
+	Canary        bool
+	CanaryTimeout time.Duration
+	NotifyWebhook string
+	// DiscoverAll manages all openstack clusters in the state store matching ClusterSelector
+	DiscoverAll     bool
+	ClusterSelector string
+	// ManageInfrastructure allows applies to modify other resources than instances
+	ManageInfrastructure bool
+	// MaxDeletions is the number or percentage of servers in an instance group which can be
+	// deleted without approval
+	MaxDeletions string
+	AdminAddress string
+	// Interactive prints the changes and asks for confirmation before applying them
+	Interactive bool
+	// ConfigFile contains per cluster settings
+	ConfigFile string
+	// SpecCacheDir is a local directory where last known specs are stored for state store outages
+	SpecCacheDir    string
+	SpecCacheMaxAge time.Duration
+	// AllowVersionSkew operates on clusters newer than the embedded kops, only logging a warning
+	AllowVersionSkew bool
+	// ScaleDown deletes servers which are over the instance group size after draining their nodes
+	ScaleDown bool
+	// DrainGracePeriod overrides the termination grace period of evicted pods, negative uses the pod's own
+	DrainGracePeriod int
+	DrainTimeout     time.Duration
+	// DrainForce deletes pods without grace period when they have not terminated in DrainTimeout
+	DrainForce bool
+	// CordonOnly only cordons and annotates the nodes of the servers to remove in scale down
+	CordonOnly bool
+	// ScaleUpOnly only creates missing instances, existing servers are never deleted or replaced
+	ScaleUpOnly bool
+	// Once executes the clusters once and exits
+	Once bool
+	// Output is the format of the results printed in Once mode, json or yaml
+	Output string
+	// ForeignMetadataKeys is comma separated list of server metadata keys set by other orchestration
+	ForeignMetadataKeys string
+	// ZoneRebalance replaces the servers of unavailable availability zones in the surviving zones.
+	// It needs ScaleDown to remove the replacements after the zone recovers.
+	ZoneRebalance bool
+	// SlowActiveThreshold and SlowReadyThreshold flag servers which take longer to become ACTIVE or Ready
+	SlowActiveThreshold time.Duration
+	SlowReadyThreshold  time.Duration
+	// ComputeMicroversion and NetworkMicroversion pin the API microversions of the OpenStack clients
+	ComputeMicroversion string
+	NetworkMicroversion string
+	// ReplaceVolumeDrift replaces servers whose root volume differs from the instance group one by one
+	ReplaceVolumeDrift bool
+	// ReconcileSecurityGroups attaches the security groups implied by kops to server ports missing them
+	ReconcileSecurityGroups bool
+	// ReplaceSSHKeyDrift replaces servers whose keypair differs from the cluster SSH key one by one
+	ReplaceSSHKeyDrift bool
+	// ExtraUserData is comma separated list of files appended as cloud-init parts to created servers
+	ExtraUserData string
+	// SkipUnchanged skips the dry-run while the specs and servers are unchanged since the latest clean execution
+	SkipUnchanged bool
+	// FullInterval is the time between full executions while the specs in state store are unchanged,
+	// 0 runs full execution every time
+	FullInterval time.Duration
+	// InitialDelay and InitialSplay hold back the first applies after startup, the splay is random per cluster
+	InitialDelay time.Duration
+	InitialSplay time.Duration
+	// AssetsContainerRegistry and AssetsFileRepository override assets.containerRegistry and
+	// assets.fileRepository of the clusters
+	AssetsContainerRegistry string
+	AssetsFileRepository    string
+	// HTTPProxy, HTTPSProxy and NoProxy override the proxy environment variables
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    string
+	// AdminTLSCertFile and AdminTLSKeyFile serve the admin API over TLS, reloaded when the files change
+	AdminTLSCertFile string
+	AdminTLSKeyFile  string
+	// AdminTokenFile, AdminClientCAFile and AdminKubeAuth protect the mutating admin API endpoints
+	// with a static bearer token, client certificates or kubernetes TokenReview and SubjectAccessReview
+	AdminTokenFile    string
+	AdminClientCAFile string
+	AdminKubeAuth     bool
+	// AuditLog is the file the admin API mutations are appended to
+	AuditLog string
+	// ReconcileCallerInterval and ReconcileGlobalInterval are the minimum times between executions
+	// triggered from the admin API by the same caller and by anyone, 0 disables
+	ReconcileCallerInterval time.Duration
+	ReconcileGlobalInterval time.Duration
+	// CredentialsSecrets is comma separated list of namespace/name of kubernetes secrets whose
+	// S3_ and OS_ keys are used as credentials
+	CredentialsSecrets string
+	// VaultAddress, VaultRole and VaultSecrets fetch the credentials from the comma separated
+	// Vault paths, logging in with the kubernetes auth method when the role is set
+	VaultAddress string
+	VaultRole    string
+	VaultSecrets string
+	// ResolveDuplicates deletes the servers which have the same name as the server registered as Ready node
+	ResolveDuplicates bool
+	// ReconcileTags adds missing cluster and role metadata to the servers in the server groups of the cluster
+	ReconcileTags bool
+	// ReconcileAPIPool adds the masters missing from the API load balancer pool and removes the
+	// members of replaced masters
+	ReconcileAPIPool bool
+	// UnreachableAPI is what to do when the API server does not respond before an apply: apply,
+	// cloud-only to apply without the steps which need the API server, or abort
+	UnreachableAPI string
+	// AllowUnsafeMasterCount applies plans which would leave fewer masters than etcd quorum needs
+	// or an even number of masters
+	AllowUnsafeMasterCount bool
+	// MaxTaskDuration is how long a failing task is retried in direct applies before giving up,
+	// TaskRetryInterval the wait before retrying when none of the tasks succeeded
+	MaxTaskDuration   time.Duration
+	TaskRetryInterval time.Duration
+	// TaskBuildInterval is the time between kops task builds while the server counts match the
+	// instance group sizes, 0 builds the tasks every execution
+	TaskBuildInterval time.Duration
+	// IncrementalTaskBuild builds the tasks only for the instance group whose server count differs,
+	// when it is the only one
+	IncrementalTaskBuild bool
+	// CacheStores keeps the keystore and secretstore files in memory between executions until their
+	// ETags in state store change
+	CacheStores bool
+	// CreateConcurrency is the maximum number of server create requests in flight, 0 is unlimited.
+	// CreateRetries is how many times a create request rejected by rate limits or unavailability is retried.
+	CreateConcurrency int
+	CreateRetries     int
+	// CreateBatchSize creates the new instances in batches of this size, waiting for each batch to
+	// become ACTIVE, and Ready with CreateBatchWaitReady, before the next. 0 creates all at once.
+	CreateBatchSize      int
+	CreateBatchWaitReady bool
+	// ServerActiveTimeout is how long a created server may take to become ACTIVE before it is deleted
+	ServerActiveTimeout time.Duration
+	// APIRetries is how many times OpenStack API requests answered with 429 or 409 are retried,
+	// waiting for Retry-After or a jittered backoff per service of at most APIRetryMaxWait
+	APIRetries      int
+	APIRetryMaxWait time.Duration
+	// UserDomain, Project and ProjectDomain override the keystone domain of the user and the project
+	// of the OpenStack credentials. The project domain defaults to the user domain.
+	UserDomain    string
+	Project       string
+	ProjectDomain string
+	// AuthURLFallbacks are the keystone URLs used when the one of the credentials is unreachable, and
+	// EndpointFallbacks the catalog interfaces used for unreachable compute, network and volume endpoints
+	AuthURLFallbacks  string
+	EndpointFallbacks string
+	// LBProvider is the load balancer service: octavia, neutron (LBaaS v2) or auto to use octavia if the catalog has it
+	LBProvider string
+	// SpreadSubnets creates the ports of new instances round-robin in the subnets of their instance group,
+	// weighted by the subnet-weights annotation, instead of letting Neutron fill one subnet first
+	SpreadSubnets bool
+	// CheckCapacity projects whether scale-ups of at least CapacityMinCreates servers fit the free capacity
+	// of the hypervisors, with the allocation ratios of Nova. CapacityPolicy is warn or split.
+	CheckCapacity      bool
+	CapacityMinCreates int
+	CapacityPolicy     string
+	CPUAllocationRatio float64
+	RAMAllocationRatio float64
+	// Chaos is the probability of failing an OpenStack request or a state store call on purpose, to test
+	// the backoff and the recovery from partial applies. Hidden, for test environments only.
+	Chaos float64
+	// RecordDir is a local directory where the sanitized OpenStack API calls of failed executions are
+	// written to, keeping the latest RecordKeep recordings per cluster
+	RecordDir  string
+	RecordKeep int
+	// ReplaceUserDataDrift replaces servers whose user data differs from the one rendered for their
+	// instance group one by one
+	ReplaceUserDataDrift bool
+	// IgnoreFields is comma separated list of task fields ignored in change detection, e.g. metadata
+	// keys changed by other tools. Overridden by the ignore-fields annotation and the config.
+	IgnoreFields string
+	// StatusNamespace is the kubernetes namespace where the status of each cluster is written to a
+	// config map kops-autoscaler-status-<cluster>
+	StatusNamespace string
+	// CloudEventsSink is the URL the scaling events, failures and alerts are posted to as CloudEvents,
+	// with CloudEventsSource as their source
+	CloudEventsSink   string
+	CloudEventsSource string
+	// EventBus is the NATS server or Kafka REST proxy the events are also published to, on the
+	// subject or topic EventBusTopic
+	EventBus      string
+	EventBusTopic string
+	// BlueGreenTimeout is the time the servers of the green instance group of a blue/green rollout
+	// have to become ready before the rollout is rolled back
+	BlueGreenTimeout time.Duration
+	// SkipLBReconcile, SkipFIPReconcile and SkipGC opt out of the API load balancer, the floating IPs
+	// and the removal of the ports and floating IPs of deleted servers, for environments where other
+	// controllers manage them
+	SkipLBReconcile  bool
+	SkipFIPReconcile bool
+	SkipGC           bool
+	// PolicyPlugins is comma separated list of executables and http(s) URLs consulted before each
+	// apply, which allow, deny or modify the plan. PolicyTimeout limits each call.
+	PolicyPlugins string
+	PolicyTimeout time.Duration
+	// PrometheusURL is the Prometheus the metric targets of the instance groups are queried from
+	// every MetricsInterval. Lower sizes are set after MetricsScaleDownDelay.
+	PrometheusURL         string
+	MetricsInterval       time.Duration
+	MetricsScaleDownDelay time.Duration
+	// SizeOverrides is the namespace/name of the config map with the desired sizes of instance
+	// groups, which override their minSize without changing the state store
+	SizeOverrides string
+	// AdminGRPCAddress is the address of the gRPC admin API of proto/admin.proto, which shares
+	// the TLS, authentication, audit log and limits of the admin API
+	AdminGRPCAddress string
 }
 
 type openstackASG struct {
-	ApplyCmd  *cloudup.ApplyClusterCmd
-	clientset simple.Clientset
-	opts      *Options
+	ApplyCmd    *cloudup.ApplyClusterCmd
+	clientset   simple.Clientset
+	opts        *Options
+	clusterName string
+	// lastPlanID is the id of the plan found in previous execution
+	lastPlanID string
+	// failedCanary is the name of the canary instance which did not become Ready
+	failedCanary string
+	kubeClient   kubernetes.Interface
+	notifier     *notifier
+	maxDeletions *limit
+	// guardrailPlanID is the id of the latest plan which was over the deletion limit
+	guardrailPlanID string
+	config          *Config
+	settings        *clusterSettings
+	// next is the time of next execution
+	next time.Time
+	// runCtx is the context of the executions
+	runCtx *runContext
+	// applier finds and applies the changes
+	applier Applier
+	// sizeOverrides are the desired sizes overriding the minSize of the instance groups
+	sizeOverrides *sizeOverrides
+	// paused is set from the admin API
+	paused bool
+	// driftID identifies the unremediated drift which has been notified
+	driftID string
+	// result collects the outcome of the execution in --once mode
+	result *Result
+	// foreign contains the servers managed by other orchestration, found in the latest dry-run
+	foreign map[string]string
+	// serverCounts are the number of servers per instance group, found in the latest dry-run
+	serverCounts map[string]int
+	// instanceGroups are the instance groups as stored in the state store. ApplyCmd may contain
+	// temporarily resized copies of them.
+	instanceGroups []*kops.InstanceGroup
+	// rebalanced describes the instance groups resized because of unavailable zones
+	rebalanced string
+	// boots tracks the servers created after bootsSince by server ID
+	boots      map[string]*bootState
+	bootsSince time.Time
+	// clients are reused between executions until an execution fails
+	clients *clients
+	// cleanFingerprint is the fingerprint of the latest execution which found nothing to do,
+	// executed at cleanAt
+	cleanFingerprint string
+	cleanAt          time.Time
+	// etags are the ETags of the specs in state store polled before the latest full execution at fullAt
+	etags  string
+	fullAt time.Time
+	// dryRunDone is set after the first successful dry-run
+	dryRunDone bool
+	// applyAfter is the end of the initial delay, changes are not applied before it
+	applyAfter time.Time
+	// invalidGroups are the notified validation errors of the instance groups by name
+	invalidGroups map[string]string
+	// providerNetworks are the provider networks of the instance groups not in the cluster network
+	providerNetworks map[string]*providerNetwork
+	// capacityZones are the availability zones of the new servers projected by the capacity check,
+	// and deferred the new servers which do not fit and are left to the next execution
+	capacityZones map[string]string
+	deferred      map[string]bool
+	// groupChecked is when the changes of the instance groups with an interval were last acted on,
+	// and groupChanged when the servers of the instance groups were last changed
+	groupChecked map[string]time.Time
+	groupChanged map[string]time.Time
+	// postponed are the servers whose changes are postponed in the current execution
+	postponed map[string]bool
+	// churn are the times servers of the instance groups were created or replaced during the last
+	// hour, and replaced the servers deleted for replacement which are not created again yet
+	churn    map[string][]time.Time
+	replaced map[string]bool
+	// surges are the create-first replacements in progress by instance group
+	surges map[string]*surge
+	// rollouts are the blue/green rollouts by blue instance group, persisted in the state store, and
+	// rolloutRequests the servers whose drift starts a rollout of their instance group
+	rollouts        map[string]*Rollout
+	rolloutRequests map[string]string
+	// statusTimes and conditions are written to the status config map with --status-namespace
+	statusTimes statusTimes
+	conditions  []StatusCondition
+	// lastStatus and history are returned by the status endpoint of the admin API, guarded by
+	// the mutex of the manager
+	lastStatus *ClusterStatus
+	history    []Execution
+	// quotaError is the latest create rejected by quota in the latest apply
+	quotaError string
+	// userDataHashes are the hashes of the user data of the servers by server ID
+	userDataHashes map[string]string
+	// apiCalls records the OpenStack API calls of the current execution with --record-dir
+	apiCalls *recorder
+	// unsupportedSpec is the notified unsupported spec version of the cluster and loggedError the
+	// latest one logged
+	unsupportedSpec string
+	loggedError     string
+	// applyFailures is the number of consecutive failed applies. requeued are the changes of the
+	// latest failed plan, which are retried without confirmation or approval.
+	applyFailures  int
+	requeued       map[string]bool
+	requeuedPlanID string
+	// builtAt is the time of the latest task build which found no instances to change
+	builtAt time.Time
 }
 
-// Run will execute cluster check in loop periodically
-func Run(opts *Options) error {
-	registryBase, err := vfs.Context.BuildVfsPath(opts.StateStore)
+// Run will execute cluster check in loop periodically, or once with --once
+func Run(ctx context.Context, opts *Options) error {
+	r, err := New(opts)
 	if err != nil {
-		return fmt.Errorf("error parsing registry path %q: %v", opts.StateStore, err)
+		return err
+	}
+	if opts.Once {
+		r.m.ctx.set(ctx)
+		return r.m.once(ctx)
 	}
+	return r.Run(ctx)
+}
 
-	clientset := vfsclientset.NewVFSClientset(registryBase, true)
-	osASG := &openstackASG{
-		opts:      opts,
-		clientset: clientset,
+// fullReconcile runs single check of the cluster and applies the changes when needed
+func (osASG *openstackASG) fullReconcile() error {
+	opts := osASG.opts
+	err := osASG.updateApplyCmd()
+	if _, ok := err.(*unsupportedSpecError); ok {
+		osASG.record("unsupported spec version")
+		return err
+	}
+	if err != nil {
+		err = errors.WithMessage(err, "error updating applycmd")
+		if opts.SpecCacheDir != "" {
+			osASG.record("state store not available, checked cached spec")
+			return osASG.checkCachedSpec(err)
+		}
+		return err
 	}
-	for {
-		time.Sleep(time.Duration(opts.Sleep) * time.Second)
-		glog.Infof("Executing...\n")
 
-		err := osASG.updateApplyCmd()
+	osASG.settings, err = resolveSettings(opts, osASG.config, osASG.ApplyCmd.Cluster)
+	if err != nil {
+		return err
+	}
+	if osASG.settings.paused {
+		glog.Infof("Cluster %s is paused\n", osASG.clusterName)
+		osASG.record("paused")
+		return nil
+	}
+
+	skip, drifted := osASG.fastPath()
+	if skip {
+		glog.Infof("Server counts of %s match the instance groups, skipping task build\n", osASG.clusterName)
+		osASG.record("skipped, server counts match")
+		return nil
+	}
+	scoped := ""
+	if opts.IncrementalTaskBuild && len(drifted) == 1 {
+		scoped = drifted[0]
+		osASG.ApplyCmd.InstanceGroups = scopedInstanceGroups(osASG.ApplyCmd.InstanceGroups, scoped)
+		glog.Infof("Building tasks of %s for instance group %s\n", osASG.clusterName, scoped)
+	}
+
+	fingerprint := ""
+	if opts.SkipUnchanged && scoped == "" {
+		fingerprint, err = osASG.fingerprint()
 		if err != nil {
-			glog.Errorf("Error updating applycmd %v", err)
-			continue
+			glog.Warningf("Error fingerprinting %s: %v", osASG.clusterName, err)
+		} else if osASG.unchanged(fingerprint) {
+			glog.Infof("Cluster %s is unchanged since the latest clean execution, skipping dry-run\n", osASG.clusterName)
+			osASG.record("skipped, nothing changed")
+			return nil
+		}
+	}
+
+	plan, err := osASG.applier.DryRun()
+	if err != nil {
+		return fmt.Errorf("error running dryrun: %v", err)
+	}
+	osASG.dryRunDone = true
+	osASG.markClean(fingerprint, plan)
+	osASG.markBuilt(plan, scoped)
+
+	// drift of the other instance groups is not known after a scoped build
+	if scoped == "" {
+		osASG.reportDrift(plan)
+	}
+	osASG.recordPlan(plan)
+
+	if len(plan.portFixes) > 0 {
+		if reason := externallyManaged(osASG.ApplyCmd.Cluster); reason != "" {
+			glog.Infof("Not attaching missing security groups, %s\n", reason)
+		} else if reason := osASG.delayed(); reason != "" {
+			glog.Infof("Not attaching missing security groups, %s\n", reason)
+		} else if err := osASG.fixSecurityGroups(plan.portFixes); err != nil {
+			return err
+		}
+	}
+	if len(plan.tagFixes) > 0 {
+		if reason := externallyManaged(osASG.ApplyCmd.Cluster); reason != "" {
+			glog.Infof("Not adding missing server metadata, %s\n", reason)
+		} else if reason := osASG.delayed(); reason != "" {
+			glog.Infof("Not adding missing server metadata, %s\n", reason)
+		} else if err := osASG.fixMetadata(plan.tagFixes); err != nil {
+			return err
+		}
+	}
+	if plan.poolFix != nil {
+		if reason := externallyManaged(osASG.ApplyCmd.Cluster); reason != "" {
+			glog.Infof("Not updating API load balancer pool, %s\n", reason)
+		} else if reason := osASG.delayed(); reason != "" {
+			glog.Infof("Not updating API load balancer pool, %s\n", reason)
+		} else if err := osASG.fixAPIPool(plan.poolFix); err != nil {
+			return err
+		}
+	}
+	if len(plan.rolloutSteps) > 0 {
+		if reason := externallyManaged(osASG.ApplyCmd.Cluster); reason != "" {
+			glog.Infof("Not moving blue/green rollouts forward, %s\n", reason)
+		} else if reason := osASG.delayed(); reason != "" {
+			glog.Infof("Not moving blue/green rollouts forward, %s\n", reason)
+		} else if err := osASG.applyRollouts(plan.rolloutSteps); err != nil {
+			return err
 		}
+	}
+
+	if !plan.needsUpdate() {
+		osASG.lastPlanID = ""
+		osASG.clearRequeue()
+		return nil
+	}
 
-		needsUpdate, err := osASG.dryRun()
+	if err := osASG.ctx().Err(); err != nil {
+		return errors.WithMessage(err, "not applying plan "+plan.ID)
+	}
+
+	if reason := externallyManaged(osASG.ApplyCmd.Cluster); reason != "" {
+		osASG.report(plan, reason)
+		osASG.record("not applied, %s", reason)
+		return nil
+	}
+
+	if !opts.AllowUnsafeMasterCount {
+		violation, err := osASG.quorumViolation(plan)
 		if err != nil {
-			glog.Errorf("Error running dryrun %v", err)
-			continue
+			return fmt.Errorf("error checking number of masters: %v", err)
+		}
+		if violation != "" {
+			osASG.notifier.notify(osASG.clusterName, "EtcdQuorum", fmt.Sprintf("%s, plan %s: %s", violation, plan.ID, osASG.summary(plan.Changes)), plan.Changes...)
+			osASG.record("not applied, %s", violation)
+			return fmt.Errorf("refusing to apply, %s", violation)
 		}
+	}
 
-		if needsUpdate {
-			err = osASG.update()
-			if err != nil {
-				glog.Errorf("Error updating cluster %v", err)
-			}
+	requeued := osASG.requeuedRemainder(plan)
+	if opts.ConfirmDrift && !requeued && !osASG.confirmed(plan) {
+		osASG.record("waiting for confirmation of plan %s", plan.ID)
+		return nil
+	}
+
+	requireApproval := opts.RequireApproval
+	if over := osASG.deletionsOverLimit(plan); over != "" && osASG.guardrailPlanID != plan.ID {
+		osASG.guardrailPlanID = plan.ID
+		osASG.notifier.notify(osASG.clusterName, "DeletionGuardrail", fmt.Sprintf("plan %s would delete %s, over the limit of %s, approval is required: %s", plan.ID, over, osASG.maxDeletions, osASG.summary(plan.Changes)), plan.Changes...)
+	}
+	if osASG.guardrailPlanID == plan.ID {
+		requireApproval = true
+	}
+
+	if requireApproval && !requeued {
+		approved, err := osASG.approved(plan)
+		if err != nil {
+			return errors.WithMessage(err, "error checking plan approval")
+		}
+		if !approved {
+			osASG.record("waiting for approval of plan %s", plan.ID)
+			return nil
+		}
+	}
+
+	if reason := osASG.delayed(); reason != "" {
+		osASG.report(plan, reason)
+		osASG.record("not applied, %s", reason)
+		return nil
+	}
+
+	denied, err := osASG.checkPolicies(plan)
+	if err != nil {
+		return err
+	}
+	if denied != "" {
+		osASG.notifier.notify(osASG.clusterName, "PolicyDenied", fmt.Sprintf("plan %s %s: %s", plan.ID, denied, osASG.summary(plan.Changes)), plan.Changes...)
+		osASG.record("not applied, %s", denied)
+		return nil
+	}
+	if !plan.needsUpdate() {
+		osASG.record("not applied, policy plugins dropped all changes of plan %s", plan.ID)
+		return nil
+	}
+
+	// the confirmation shows the plan as modified by the policy plugins, as it will be applied
+	if opts.Interactive && !confirmInteractive(plan) {
+		osASG.record("plan %s declined", plan.ID)
+		return nil
+	}
+
+	plan.CloudOnly, err = osASG.checkAPI(plan)
+	if err != nil {
+		return err
+	}
+	err = osASG.applier.Apply(plan)
+	if err != nil {
+		cause := err
+		err = osASG.applyFailed(plan, err)
+		osASG.notifier.event(eventApplyFailed, osASG.clusterName, &eventData{
+			PlanID:  plan.ID,
+			Kinds:   kinds(plan.Changes),
+			Changes: plan.Changes,
+			Error:   scrubSecrets(err.Error()),
+		})
+		return &ErrApplyFailed{
+			PlanID:  plan.ID,
+			Tasks:   failedTasks(plan),
+			Err:     cause,
+			message: fmt.Sprintf("error updating cluster: %v", err),
+		}
+	}
+	osASG.clearRequeue()
+	osASG.countApplied(plan)
+	osASG.markChanged(plan)
+	osASG.recordChurn(plan)
+	osASG.record("applied plan %s", plan.ID)
+	osASG.notifier.event(eventPlanApplied, osASG.clusterName, &eventData{
+		PlanID:  plan.ID,
+		Kinds:   kinds(plan.Changes),
+		Changes: plan.Changes,
+	})
+	lastSuccessfulApply.WithLabelValues(osASG.clusterName).SetToCurrentTime()
+	osASG.statusTimes.applied = time.Now().UTC()
+
+	osASG.lastPlanID = ""
+	if requireApproval {
+		err = osASG.clearPlan()
+		if err != nil {
+			return fmt.Errorf("error clearing plan: %v", err)
 		}
 	}
 	return nil
 }
 
+// interval returns the time between executions of the cluster
+func (osASG *openstackASG) interval() time.Duration {
+	interval := time.Duration(osASG.opts.Sleep) * time.Second
+	if osASG.settings != nil && osASG.settings.interval > 0 {
+		interval = osASG.settings.interval
+	}
+	if shortest := osASG.shortestGroupInterval(); shortest > 0 && shortest < interval {
+		return shortest
+	}
+	return interval
+}
+
+// externallyManaged returns the reason why the cluster must not be modified by the autoscaler,
+// or empty string if the cluster is managed by kops
+func externallyManaged(cluster *kops.Cluster) string {
+	if fi.StringValue(cluster.Spec.UpdatePolicy) == kops.UpdatePolicyExternal {
+		return "cluster has updatePolicy external"
+	}
+	if cluster.ObjectMeta.Annotations[kops.AnnotationNameManagement] == kops.AnnotationValueManagementImported {
+		return "cluster is imported to kops"
+	}
+	return ""
+}
+
+// delayed returns the reason why changes are not applied yet after startup, or empty string
+// if the initial delay has passed
+func (osASG *openstackASG) delayed() string {
+	if time.Now().Before(osASG.applyAfter) {
+		return fmt.Sprintf("initial delay until %s", osASG.applyAfter.Format(time.RFC3339))
+	}
+	return ""
+}
+
+// report logs the plan which is not applied
+func (osASG *openstackASG) report(plan *Plan, reason string) {
+	glog.Infof("Not applying changes, %s\n%s", reason, plan)
+}
+
+// confirmed returns true if the same plan was found in previous execution
+func (osASG *openstackASG) confirmed(plan *Plan) bool {
+	if osASG.lastPlanID == plan.ID {
+		return true
+	}
+	glog.Infof("Found plan %s, waiting for next execution to confirm it\n", plan.ID)
+	osASG.lastPlanID = plan.ID
+	return false
+}
+
+func newClientset(opts *Options) (simple.Clientset, error) {
+	if err := setSwiftClient(opts.StateStore); err != nil {
+		return nil, err
+	}
+	registryBase, err := vfs.Context.BuildVfsPath(opts.StateStore)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing registry path %q: %v", opts.StateStore, err)
+	}
+	var clientset simple.Clientset = &instrumentedClientset{
+		Clientset: vfsclientset.NewVFSClientset(registryBase, true),
+		backend:   backendOf(registryBase),
+	}
+	if opts.Chaos > 0 {
+		clientset = &chaosClientset{
+			Clientset: clientset,
+			chaos:     newChaos(opts.Chaos),
+		}
+	}
+	if opts.CacheStores {
+		clientset = &cachingClientset{
+			Clientset: clientset,
+			allowList: true,
+			caches:    make(map[string]*fileCache),
+		}
+	}
+	return clientset, nil
+}
+
 func (osASG *openstackASG) updateApplyCmd() error {
-	cluster, err := osASG.clientset.GetCluster(osASG.opts.ClusterName)
+	cluster, err := osASG.clientset.GetCluster(osASG.clusterName)
 	if err != nil {
-		return fmt.Errorf("error initializing cluster %v", err)
+		return osASG.specError(&ErrStateStoreUnavailable{Err: fmt.Errorf("error initializing cluster %v", err)})
+	}
+	if err := osASG.checkVersionSkew(cluster); err != nil {
+		return err
 	}
 
 	list, err := osASG.clientset.InstanceGroupsFor(cluster).List(metav1.ListOptions{})
 	if err != nil {
-		return err
+		return osASG.specError(&ErrStateStoreUnavailable{Err: err})
 	}
+	osASG.specSupported()
 	var instanceGroups []*kops.InstanceGroup
 	for i := range list.Items {
 		instanceGroups = append(instanceGroups, &list.Items[i])
 	}
 
+	if osASG.opts.SpecCacheDir != "" {
+		err = saveSpec(osASG.opts.SpecCacheDir, cluster, instanceGroups)
+		if err != nil {
+			glog.Warningf("Error caching spec of %s: %v", osASG.clusterName, err)
+		}
+	}
+
+	applyAssets(cluster, osASG.opts)
+
+	if err := osASG.validateInstanceGroups(cluster, instanceGroups); err != nil {
+		return err
+	}
+
+	osASG.instanceGroups = instanceGroups
+	if err := osASG.loadRollouts(cluster, instanceGroups); err != nil {
+		return err
+	}
+	instanceGroups = osASG.overrideSizes(instanceGroups)
+	if osASG.opts.ZoneRebalance {
+		instanceGroups, err = osASG.rebalanceZones(cluster, instanceGroups)
+		if err != nil {
+			return fmt.Errorf("error checking availability zones: %v", err)
+		}
+	}
+	instanceGroups = osASG.surgeGroups(instanceGroups)
+
 	osASG.ApplyCmd = &cloudup.ApplyClusterCmd{
 		Clientset:      osASG.clientset,
 		Cluster:        cluster,
@@ -96,34 +717,228 @@ func (osASG *openstackASG) updateApplyCmd() error {
 	return nil
 }
 
-func (osASG *openstackASG) dryRun() (bool, error) {
+func (osASG *openstackASG) dryRun() (*Plan, error) {
+	opts := osASG.opts
 	osASG.ApplyCmd.TargetName = cloudup.TargetDryRun
 	osASG.ApplyCmd.DryRun = true
 
+	cloud, err := osASG.openstackCloud()
+	if err != nil {
+		return nil, err
+	}
+	if err := osASG.checkNameCollisions(cloud); err != nil {
+		osASG.notifier.notify(osASG.clusterName, "NameCollision", err.Error())
+		return nil, err
+	}
+	if err := osASG.resolveDuplicates(cloud); err != nil {
+		return nil, err
+	}
 	if err := osASG.ApplyCmd.Run(); err != nil {
-		return false, err
+		return nil, err
+	}
+	list, err := clusterServers(cloud, osASG.clusterName)
+	if err != nil {
+		return nil, err
+	}
+	osASG.foreign = osASG.foreignServers(list)
+	osASG.serverCounts = osASG.countServers(list)
+	if err := osASG.trackBoots(cloud); err != nil {
+		glog.Warningf("Error tracking server boot times: %v", err)
 	}
+
+	var changes, ignored, keyDrift, userDataDrift []Change
 	target := osASG.ApplyCmd.Target.(*fi.DryRunTarget)
 	if target.HasChanges() {
-		// This does not work yet, waiting for PR to be approved
-		/*for _, r := range target.Changes() {
-			if strings.HasPrefix(r, "Instance") {
-				glog.Infof("Found instance in tasks running update --yes\n")
-				return true, nil
+		found, err := dryRunChanges(target, osASG.ApplyCmd.TaskMap)
+		if err != nil {
+			return nil, fmt.Errorf("error reading dry-run changes: %v", err)
+		}
+		for _, c := range found {
+			c, ignore := osASG.dropIgnoredFields(c)
+			if ignore || opts.skippedType(c.Type) {
+				continue
+			}
+			c, drift := checkSSHKey(c, list)
+			if drift {
+				keyDrift = append(keyDrift, c)
+				continue
 			}
-		}*/
+			c, drift = osASG.checkUserData(cloud, c, list)
+			if drift {
+				userDataDrift = append(userDataDrift, c)
+				continue
+			}
+			if c.Action == actionUpdate && len(c.Fields) == 0 {
+				continue
+			}
+			if osASG.providerNetworkChange(c) {
+				glog.V(2).Infof("Ignoring %s, server is in a provider network\n", c)
+				continue
+			}
+			if !osASG.managedChange(c) {
+				ignored = append(ignored, c)
+				continue
+			}
+			if key := osASG.foreignChange(c); key != "" {
+				glog.Warningf("Ignoring %s, server has metadata %s and is managed by other orchestration", c, key)
+				ignored = append(ignored, c)
+				continue
+			}
+			if opts.ScaleUpOnly && c.Action != actionCreate {
+				glog.Infof("Ignoring %s, only creating missing instances\n", c)
+				ignored = append(ignored, c)
+				continue
+			}
+			changes = append(changes, c)
+		}
 	}
-	return false, nil
+	if opts.ScaleDown {
+		excess, err := osASG.excessServers(list)
+		if err != nil {
+			return nil, fmt.Errorf("error finding servers to scale down: %v", err)
+		}
+		for _, c := range excess {
+			if key := osASG.foreignChange(c); key != "" {
+				glog.Warningf("Not scaling down %s, server has metadata %s and is managed by other orchestration", c.Name, key)
+				ignored = append(ignored, c)
+				continue
+			}
+			changes = append(changes, c)
+		}
+	}
+	osASG.checkSurges(list)
+	volumeDrift, err := osASG.rootVolumeDrift(cloud, list)
+	if err != nil {
+		return nil, fmt.Errorf("error checking root volumes: %v", err)
+	}
+	for _, c := range volumeDrift {
+		c, ignore := osASG.dropIgnoredFields(c)
+		if ignore {
+			continue
+		}
+		changes, ignored = osASG.replaceOrReport(c, opts.ReplaceVolumeDrift, "root volume differs from instance group ("+strings.Join(c.Fields, ", ")+")", changes, ignored)
+	}
+	for _, c := range keyDrift {
+		if osASG.managedChange(c) {
+			changes, ignored = osASG.replaceOrReport(c, opts.ReplaceSSHKeyDrift, "keypair differs from cluster SSH key", changes, ignored)
+		}
+	}
+	for _, c := range userDataDrift {
+		if osASG.managedChange(c) {
+			changes, ignored = osASG.replaceOrReport(c, opts.ReplaceUserDataDrift, "user data differs from instance group", changes, ignored)
+		}
+	}
+	changes = append(changes, osASG.surgeDeletes(list)...)
+	rolloutDeletes, rolloutSteps := osASG.rolloutChanges(list)
+	changes = append(changes, rolloutDeletes...)
+	osASG.pruneUserDataHashes(list)
+
+	sgDrift, err := osASG.securityGroupDrift(cloud)
+	if err != nil {
+		return nil, fmt.Errorf("error checking security groups: %v", err)
+	}
+	var portFixes []*portDrift
+	for _, d := range sgDrift {
+		if osASG.fieldIgnored("Port", "SecurityGroups", "") {
+			continue
+		}
+		if opts.ReconcileSecurityGroups {
+			portFixes = append(portFixes, d)
+		} else {
+			glog.Warningf("Port %s of %s is missing security groups %s", d.port.Name, d.server, strings.Join(d.missingNames, ", "))
+			ignored = append(ignored, d.change())
+		}
+	}
+
+	tagDrift, err := osASG.metadataDrift(cloud)
+	if err != nil {
+		return nil, fmt.Errorf("error checking server metadata: %v", err)
+	}
+	var tagFixes []*metadataDrift
+	for _, d := range tagDrift {
+		if opts.ReconcileTags {
+			tagFixes = append(tagFixes, d)
+		} else {
+			glog.Warningf("Server %s is missing metadata %s", d.server.Name, strings.Join(d.keys(), ", "))
+			ignored = append(ignored, d.change())
+		}
+	}
+
+	var apiDrift *poolDrift
+	if !opts.SkipLBReconcile {
+		apiDrift, err = osASG.apiPoolDrift(cloud, list)
+		if err != nil {
+			return nil, fmt.Errorf("error checking API load balancer pool: %v", err)
+		}
+	}
+	var poolFix *poolDrift
+	if apiDrift != nil {
+		if opts.ReconcileAPIPool {
+			poolFix = apiDrift
+		} else {
+			for _, c := range apiDrift.changes() {
+				glog.Warningf("API load balancer pool differs from masters: %s", c)
+				ignored = append(ignored, c)
+			}
+		}
+	}
+
+	changes, postponed := osASG.dueChanges(changes)
+	changes, limited := osASG.churnLimited(changes)
+	postponed = append(postponed, limited...)
+	osASG.postponed = make(map[string]bool)
+	for _, c := range postponed {
+		if server := changeInstance(c); server != "" {
+			osASG.postponed[server] = true
+		}
+	}
+	plan := newPlan(osASG.clusterName, changes)
+	plan.postponed = postponed
+	plan.ignored = ignored
+	plan.portFixes = portFixes
+	plan.tagFixes = tagFixes
+	plan.poolFix = poolFix
+	plan.rolloutSteps = rolloutSteps
+	if plan.needsUpdate() {
+		glog.Infof("Found instance in tasks running update --yes\n")
+	}
+	return plan, nil
 }
 
-func (osASG *openstackASG) update() error {
-	osASG.ApplyCmd.TargetName = cloudup.TargetDirect
-	osASG.ApplyCmd.DryRun = false
-	var options fi.RunTasksOptions
-	options.InitDefaults()
-	osASG.ApplyCmd.RunTasksOptions = &options
-	if err := osASG.ApplyCmd.Run(); err != nil {
+// update applies the plan. With cloudOnly the steps which need the API server are skipped:
+// instances are created without canary and servers are not deleted, as their nodes can not be drained.
+func (osASG *openstackASG) update(plan *Plan, cloudOnly bool) error {
+	osASG.quotaError = ""
+	if err := osASG.checkCapacity(plan); err != nil {
 		return err
 	}
-	return nil
+	if osASG.opts.Canary && !cloudOnly {
+		if err := osASG.canary(plan); err != nil {
+			return err
+		}
+	}
+	if err := osASG.createBatches(plan, cloudOnly); err != nil {
+		return err
+	}
+	var skip func(key string, task fi.Task) bool
+	if osASG.opts.ScaleUpOnly || cloudOnly {
+		// existing instances are left as they are even if their spec has changed
+		existing := instanceTasks(osASG.ApplyCmd.TaskMap, func(i *openstacktasks.Instance) bool {
+			return !plan.creates(taskName(i))
+		})
+		skip = func(key string, task fi.Task) bool {
+			return existing[task]
+		}
+	}
+	if err := osASG.applyTasks(skip); err != nil {
+		return err
+	}
+	if cloudOnly {
+		if deletes := plan.instanceDeletes(); len(deletes) > 0 {
+			glog.Infof("Not deleting %d servers while the API server is unreachable\n", len(deletes))
+			osASG.record("deferred deletion of %d servers, API server unreachable", len(deletes))
+		}
+		return nil
+	}
+	return osASG.scaleDown(plan)
 }
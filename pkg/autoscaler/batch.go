@@ -0,0 +1,107 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstacktasks"
+)
+
+// createBatches creates the new instances of the plan in batches of --create-batch-size, waiting
+// for each batch to become ACTIVE, and Ready with --create-batch-wait-ready, before starting the
+// next. The last batch is left to the apply of the rest of the plan.
+func (osASG *openstackASG) createBatches(plan *Plan, cloudOnly bool) error {
+	size := osASG.opts.CreateBatchSize
+	if size <= 0 {
+		return nil
+	}
+	// the canary has been created already
+	var pending []*openstacktasks.Instance
+	var pendingChanges []Change
+	for _, c := range plan.instanceCreates() {
+		if i, ok := c.task.(*openstacktasks.Instance); ok && i.ID == nil && !osASG.deferred[c.Name] {
+			pending = append(pending, i)
+			pendingChanges = append(pendingChanges, c)
+		}
+	}
+
+	for len(pending) > size {
+		batch := make(map[*openstacktasks.Instance]bool)
+		for _, i := range pending[:size] {
+			batch[i] = true
+		}
+		skip := instanceTasks(osASG.ApplyCmd.TaskMap, func(i *openstacktasks.Instance) bool {
+			return !batch[i]
+		})
+		glog.Infof("Creating batch of %d instances, %d more after it\n", size, len(pending)-size)
+		err := osASG.applyTasks(func(key string, task fi.Task) bool {
+			return skip[task]
+		})
+		if err == nil {
+			err = osASG.waitBatch(pending[:size], cloudOnly)
+		}
+		if err != nil {
+			osASG.notifier.notify(osASG.clusterName, "CreateBatchFailed",
+				fmt.Sprintf("batch of %d instances failed, not creating %d other instances: %v", size, len(pending)-size, err),
+				pendingChanges...)
+			return fmt.Errorf("batch of %d instances failed: %v", size, err)
+		}
+		pending = pending[size:]
+		pendingChanges = pendingChanges[size:]
+	}
+	return nil
+}
+
+// waitBatch waits until the servers of the batch are ACTIVE, and with --create-batch-wait-ready
+// until their nodes are Ready
+func (osASG *openstackASG) waitBatch(batch []*openstacktasks.Instance, cloudOnly bool) error {
+	cloud, err := osASG.openstackCloud()
+	if err != nil {
+		return err
+	}
+	for _, i := range batch {
+		name := taskName(i)
+		if i.ID == nil {
+			return fmt.Errorf("server %s was not created", name)
+		}
+		if err := waitActive(osASG.ctx(), cloud.ComputeClient(), name, fi.StringValue(i.ID), osASG.opts.ServerActiveTimeout); err != nil {
+			return err
+		}
+	}
+	if !osASG.opts.CreateBatchWaitReady || cloudOnly {
+		return nil
+	}
+	for _, i := range batch {
+		if err := osASG.waitForNode(taskName(i), i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitActive waits until the server is ACTIVE. A server in ERROR state fails immediately, and so
+// does the wait when ctx is done.
+func waitActive(ctx context.Context, client *gophercloud.ServiceClient, name string, id string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		server, err := servers.Get(client, id).Extract()
+		if err != nil {
+			glog.Warningf("Error reading server %s: %v", name, err)
+		} else if server.Status == "ACTIVE" {
+			return nil
+		} else if server.Status == "ERROR" {
+			return fmt.Errorf("server %s is in ERROR state", name)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("server %s did not become ACTIVE in %v", name, timeout)
+		}
+		if err := sleepContext(ctx, 5*time.Second); err != nil {
+			return err
+		}
+	}
+}
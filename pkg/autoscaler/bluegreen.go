@@ -0,0 +1,399 @@
+package autoscaler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// rolloutFile is the location of the progress of the blue/green rollouts, relative to the cluster
+// config base
+const rolloutFile = "autoscaler/bluegreen.json"
+
+// greenSuffix is added to the name of the instance group for its green copy. The green copy of
+// an instance group with the suffix is named without it.
+const greenSuffix = "-green"
+
+// phases of a blue/green rollout
+const (
+	// phaseGreen waits for the servers of the green instance group to be ready
+	phaseGreen = "green"
+	// phaseDrain deletes the servers of the blue instance group, which has been removed
+	phaseDrain = "drain"
+	// phaseRollback deletes the servers of the green instance group, which has been removed
+	phaseRollback = "rollback"
+	// phaseFailed is a rolled back rollout, not started again until the blue instance group changes
+	phaseFailed = "failed"
+)
+
+// Rollout is the progress of a blue/green replacement of an instance group. The servers of the
+// blue instance group are replaced by a parallel set of servers in its green copy.
+type Rollout struct {
+	Blue  string `json:"blue"`
+	Green string `json:"green"`
+	Phase string `json:"phase"`
+	// Reason is the drift which started the rollout, or why it was rolled back
+	Reason string `json:"reason"`
+	// SpecHash identifies the spec of the blue instance group when the rollout started
+	SpecHash string    `json:"specHash"`
+	Started  time.Time `json:"started"`
+	Updated  time.Time `json:"updated"`
+}
+
+// rolloutStep moves a rollout to its next phase after the dry-run
+type rolloutStep struct {
+	rollout *Rollout
+	// action is start, promote, rollback or finish
+	action string
+	reason string
+}
+
+func greenName(blue string) string {
+	if strings.HasSuffix(blue, greenSuffix) {
+		return strings.TrimSuffix(blue, greenSuffix)
+	}
+	return blue + greenSuffix
+}
+
+func specHash(ig *kops.InstanceGroup) string {
+	data, err := json.Marshal(ig.Spec)
+	if err != nil {
+		return ""
+	}
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])[:12]
+}
+
+// groupServer returns true if the server is one kops builds for the instance group
+func groupServer(clusterName string, ig string, server string) bool {
+	prefix := strings.ToLower(fmt.Sprintf("%s-%s-", clusterName, ig))
+	if !strings.HasPrefix(server, prefix) {
+		return false
+	}
+	_, err := strconv.Atoi(strings.TrimPrefix(server, prefix))
+	return err == nil
+}
+
+func (osASG *openstackASG) rolloutPath(cluster *kops.Cluster) (vfs.Path, error) {
+	configBase, err := osASG.clientset.ConfigBaseFor(cluster)
+	if err != nil {
+		return nil, err
+	}
+	return configBase.Join(rolloutFile), nil
+}
+
+// loadRollouts reads the progress of the blue/green rollouts from the state store, when an
+// instance group has the blue-green replacement policy or a rollout is in progress
+func (osASG *openstackASG) loadRollouts(cluster *kops.Cluster, instanceGroups []*kops.InstanceGroup) error {
+	needed := len(osASG.rollouts) > 0
+	for _, ig := range instanceGroups {
+		if policy, _ := replacementPolicy(ig); policy == replaceBlueGreen {
+			needed = true
+		}
+	}
+	osASG.rolloutRequests = nil
+	if !needed {
+		return nil
+	}
+	p, err := osASG.rolloutPath(cluster)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	data, err := p.ReadFile()
+	if err != nil && os.IsNotExist(err) {
+		observeStateStore(backendOf(p), "read_rollouts", start, nil)
+		osASG.rollouts = nil
+		return nil
+	}
+	observeStateStore(backendOf(p), "read_rollouts", start, err)
+	if err != nil {
+		return fmt.Errorf("error reading rollouts %s: %v", p.Path(), err)
+	}
+	var list []*Rollout
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("error parsing rollouts %s: %v", p.Path(), err)
+	}
+	osASG.rollouts = make(map[string]*Rollout)
+	for _, r := range list {
+		osASG.rollouts[r.Blue] = r
+	}
+	return nil
+}
+
+func (osASG *openstackASG) writeRollouts() error {
+	p, err := osASG.rolloutPath(osASG.ApplyCmd.Cluster)
+	if err != nil {
+		return err
+	}
+	list := []*Rollout{}
+	for _, r := range osASG.rollouts {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Blue < list[j].Blue
+	})
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = p.WriteFile(bytes.NewReader(data), nil)
+	observeStateStore(backendOf(p), "write_rollouts", start, err)
+	if err != nil {
+		return fmt.Errorf("error writing rollouts %s: %v", p.Path(), err)
+	}
+	return nil
+}
+
+// rolloutActive returns true if a rollout is creating or deleting servers
+func (osASG *openstackASG) rolloutActive() bool {
+	for _, r := range osASG.rollouts {
+		if r.Phase != phaseFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// storedGroup returns the instance group as stored in the state store, or nil
+func (osASG *openstackASG) storedGroup(name string) *kops.InstanceGroup {
+	for _, ig := range osASG.instanceGroups {
+		if ig.ObjectMeta.Name == name {
+			return ig
+		}
+	}
+	return nil
+}
+
+// removeGroup removes the instance group from the state store. It is also forgotten from the
+// instance groups of the execution, so that the apply does not write it back.
+func (osASG *openstackASG) removeGroup(name string) error {
+	if osASG.storedGroup(name) == nil {
+		return nil
+	}
+	if err := osASG.clientset.InstanceGroupsFor(osASG.ApplyCmd.Cluster).Delete(name, &metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("error removing instance group %s: %v", name, err)
+	}
+	var kept []*kops.InstanceGroup
+	for _, ig := range osASG.instanceGroups {
+		if ig.ObjectMeta.Name != name {
+			kept = append(kept, ig)
+		}
+	}
+	osASG.instanceGroups = kept
+	return nil
+}
+
+// requestRollout records the drift of a server of an instance group with the blue-green policy.
+// A rollout is started after the dry-run unless the instance group is already part of one, or
+// its previous rollout failed and the instance group has not changed since.
+func (osASG *openstackASG) requestRollout(c Change, group *kops.InstanceGroup) {
+	name := group.ObjectMeta.Name
+	for _, r := range osASG.rollouts {
+		if r.Green == name {
+			return
+		}
+		if r.Blue == name && (r.Phase != phaseFailed || r.SpecHash == specHash(group)) {
+			return
+		}
+	}
+	if osASG.rolloutRequests == nil {
+		osASG.rolloutRequests = make(map[string]string)
+	}
+	if _, ok := osASG.rolloutRequests[name]; !ok {
+		osASG.rolloutRequests[name] = c.Name
+	}
+}
+
+// rolloutChanges returns the deletions of the servers of the instance groups removed by the
+// rollouts, and the steps which move the rollouts forward
+func (osASG *openstackASG) rolloutChanges(list []servers.Server) ([]Change, []*rolloutStep) {
+	var changes []Change
+	var steps []*rolloutStep
+
+	var requested []string
+	for name := range osASG.rolloutRequests {
+		requested = append(requested, name)
+	}
+	sort.Strings(requested)
+	for _, name := range requested {
+		green := greenName(name)
+		if osASG.storedGroup(green) != nil {
+			glog.Warningf("Not starting blue/green rollout of %s, instance group %s exists already", name, green)
+			continue
+		}
+		steps = append(steps, &rolloutStep{
+			rollout: &Rollout{Blue: name, Green: green},
+			action:  "start",
+			reason:  fmt.Sprintf("server %s drifted", osASG.rolloutRequests[name]),
+		})
+	}
+
+	for _, r := range osASG.rollouts {
+		switch r.Phase {
+		case phaseGreen:
+			green := osASG.storedGroup(r.Green)
+			if green == nil {
+				steps = append(steps, &rolloutStep{rollout: r, action: "rollback", reason: fmt.Sprintf("instance group %s was removed", r.Green)})
+				continue
+			}
+			ready := 0
+			for _, s := range list {
+				if groupServer(osASG.clusterName, r.Green, s.Name) && osASG.serverReady(s) {
+					ready++
+				}
+			}
+			if ready >= int(fi.Int32Value(green.Spec.MinSize)) {
+				steps = append(steps, &rolloutStep{rollout: r, action: "promote"})
+			} else if time.Since(r.Updated) > osASG.opts.BlueGreenTimeout {
+				steps = append(steps, &rolloutStep{rollout: r, action: "rollback", reason: fmt.Sprintf("%d servers of %s ready in %v", ready, r.Green, osASG.opts.BlueGreenTimeout)})
+			} else {
+				glog.Infof("Blue/green rollout of %s: %d servers of %s ready\n", r.Blue, ready, r.Green)
+			}
+		case phaseDrain, phaseRollback:
+			removed := r.Blue
+			if r.Phase == phaseRollback {
+				removed = r.Green
+			}
+			found := false
+			for _, s := range list {
+				if !groupServer(osASG.clusterName, removed, s.Name) {
+					continue
+				}
+				found = true
+				changes = append(changes, Change{
+					Key:      "Instance/" + s.Name,
+					Type:     "Instance",
+					Name:     s.Name,
+					Action:   actionDelete,
+					Kind:     kindScaleDown,
+					serverID: s.ID,
+				})
+			}
+			if !found {
+				steps = append(steps, &rolloutStep{rollout: r, action: "finish"})
+			}
+		case phaseFailed:
+			blue := osASG.storedGroup(r.Blue)
+			if blue == nil || specHash(blue) != r.SpecHash {
+				steps = append(steps, &rolloutStep{rollout: r, action: "finish"})
+			}
+		}
+	}
+	return changes, steps
+}
+
+// createServerGroup creates the server group of the green instance group with the policies of the
+// server group of the blue one. Kops creates server groups only with --manage-infrastructure, and
+// skips the servers of instance groups without one. A server group left by an earlier rollout is
+// reused.
+func (osASG *openstackASG) createServerGroup(blue string, green string) error {
+	cloud, err := osASG.openstackCloud()
+	if err != nil {
+		return err
+	}
+	groups, err := cloud.ListServerGroups()
+	if err != nil {
+		return fmt.Errorf("error listing server groups: %v", err)
+	}
+	name := osASG.clusterName + "-" + green
+	policies := []string{"anti-affinity"}
+	for _, g := range groups {
+		if g.Name == name {
+			return nil
+		}
+		if g.Name == osASG.clusterName+"-"+blue {
+			policies = g.Policies
+		}
+	}
+	if _, err := cloud.CreateServerGroup(&servergroups.CreateOpts{Name: name, Policies: policies}); err != nil {
+		return fmt.Errorf("error creating server group %s: %v", name, err)
+	}
+	glog.Infof("Created server group %s\n", name)
+	return nil
+}
+
+// applyRollouts moves the rollouts to their next phase and writes their progress to the state
+// store. Starting a rollout creates the green instance group, promoting it removes the blue one
+// and rolling it back removes the green one.
+func (osASG *openstackASG) applyRollouts(steps []*rolloutStep) error {
+	now := time.Now().UTC()
+	if osASG.rollouts == nil {
+		osASG.rollouts = make(map[string]*Rollout)
+	}
+	for _, step := range steps {
+		r := step.rollout
+		switch step.action {
+		case "start":
+			blue := osASG.storedGroup(r.Blue)
+			if blue == nil {
+				continue
+			}
+			if err := osASG.createServerGroup(r.Blue, r.Green); err != nil {
+				return err
+			}
+			green := &kops.InstanceGroup{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        r.Green,
+					Labels:      blue.ObjectMeta.Labels,
+					Annotations: blue.ObjectMeta.Annotations,
+				},
+				Spec: *blue.Spec.DeepCopy(),
+			}
+			if _, err := osASG.clientset.InstanceGroupsFor(osASG.ApplyCmd.Cluster).Create(green); err != nil {
+				return fmt.Errorf("error creating instance group %s: %v", r.Green, err)
+			}
+			r.Phase = phaseGreen
+			r.Reason = step.reason
+			r.SpecHash = specHash(blue)
+			r.Started = now
+			osASG.rollouts[r.Blue] = r
+			glog.Infof("Started blue/green rollout of %s to %s, %s\n", r.Blue, r.Green, r.Reason)
+			osASG.record("started blue/green rollout of %s", r.Blue)
+		case "promote":
+			if err := osASG.removeGroup(r.Blue); err != nil {
+				return err
+			}
+			r.Phase = phaseDrain
+			glog.Infof("Servers of %s are ready, removed instance group %s\n", r.Green, r.Blue)
+			osASG.record("promoted %s, removing %s", r.Green, r.Blue)
+		case "rollback":
+			if err := osASG.removeGroup(r.Green); err != nil {
+				return err
+			}
+			r.Phase = phaseRollback
+			r.Reason = step.reason
+			osASG.notifier.notify(osASG.clusterName, "BlueGreenRollback", fmt.Sprintf("rolling back blue/green rollout of %s: %s", r.Blue, r.Reason))
+			osASG.record("rolling back blue/green rollout of %s", r.Blue)
+		case "finish":
+			switch r.Phase {
+			case phaseRollback:
+				r.Phase = phaseFailed
+			case phaseDrain:
+				glog.Infof("Blue/green rollout of %s to %s completed\n", r.Blue, r.Green)
+				osASG.record("completed blue/green rollout of %s", r.Blue)
+				delete(osASG.rollouts, r.Blue)
+			default:
+				delete(osASG.rollouts, r.Blue)
+			}
+		}
+		r.Updated = now
+	}
+	return osASG.writeRollouts()
+}
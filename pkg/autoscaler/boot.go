@@ -0,0 +1,156 @@
+package autoscaler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+var bootBuckets = []float64{30, 60, 90, 120, 180, 240, 300, 450, 600, 900, 1200, 1800}
+
+var (
+	bootActiveDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "kops_autoscaler",
+		Name:      "server_active_seconds",
+		Help:      "Time from server creation to ACTIVE.",
+		Buckets:   bootBuckets,
+	}, []string{"cluster"})
+	bootReadyDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "kops_autoscaler",
+		Name:      "node_ready_seconds",
+		Help:      "Time from server creation to kubernetes node Ready.",
+		Buckets:   bootBuckets,
+	}, []string{"cluster"})
+	slowBoots = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kops_autoscaler",
+		Name:      "slow_boots_total",
+		Help:      "Number of servers which exceeded the boot time thresholds.",
+	}, []string{"cluster", "phase"})
+)
+
+func init() {
+	prometheus.MustRegister(bootActiveDuration)
+	prometheus.MustRegister(bootReadyDuration)
+	prometheus.MustRegister(slowBoots)
+}
+
+// launchedServer is a server together with its launch time from the server usage extension
+type launchedServer struct {
+	servers.Server
+	LaunchedAt string `json:"OS-SRV-USG:launched_at"`
+}
+
+// bootState tracks the boot of a server created while the autoscaler is running
+type bootState struct {
+	name    string
+	created time.Time
+	active  bool
+	ready   bool
+	slow    map[string]bool
+}
+
+// trackBoots measures the time new servers take to become ACTIVE and their nodes Ready, and
+// flags the servers exceeding the thresholds
+func (osASG *openstackASG) trackBoots(cloud openstack.OpenstackCloud) error {
+	now := time.Now()
+	if osASG.boots == nil {
+		osASG.boots = make(map[string]*bootState)
+		osASG.bootsSince = now
+	}
+	pages, err := servers.List(cloud.ComputeClient(), servers.ListOpts{}).AllPages()
+	if err != nil {
+		return fmt.Errorf("error listing servers: %v", err)
+	}
+	var list []launchedServer
+	if err := servers.ExtractServersInto(pages, &list); err != nil {
+		return fmt.Errorf("error listing servers: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, s := range list {
+		if s.Metadata[openstack.TagClusterName] != osASG.clusterName || s.Created.Before(osASG.bootsSince) {
+			continue
+		}
+		seen[s.ID] = true
+		state := osASG.boots[s.ID]
+		if state == nil {
+			state = &bootState{name: s.Name, created: s.Created, slow: make(map[string]bool)}
+			osASG.boots[s.ID] = state
+		}
+
+		if !state.active {
+			if launched, ok := parseLaunchedAt(s.LaunchedAt); ok {
+				state.active = true
+				d := launched.Sub(state.created)
+				bootActiveDuration.WithLabelValues(osASG.clusterName).Observe(d.Seconds())
+				osASG.checkBoot(state, "ACTIVE", d, osASG.opts.SlowActiveThreshold)
+			} else {
+				osASG.checkBoot(state, "ACTIVE", now.Sub(state.created), osASG.opts.SlowActiveThreshold)
+			}
+		}
+
+		if osASG.kubeClient != nil && !state.ready {
+			readyAt, err := osASG.nodeReadyAt(s.Name)
+			if err != nil {
+				glog.Warningf("Error reading node %s: %v", s.Name, err)
+			} else if !readyAt.IsZero() {
+				state.ready = true
+				d := readyAt.Sub(state.created)
+				bootReadyDuration.WithLabelValues(osASG.clusterName).Observe(d.Seconds())
+				osASG.checkBoot(state, "Ready", d, osASG.opts.SlowReadyThreshold)
+			} else {
+				osASG.checkBoot(state, "Ready", now.Sub(state.created), osASG.opts.SlowReadyThreshold)
+			}
+		}
+	}
+
+	for id, state := range osASG.boots {
+		if !seen[id] || (state.active && (state.ready || osASG.kubeClient == nil)) {
+			delete(osASG.boots, id)
+		}
+	}
+	return nil
+}
+
+// checkBoot flags the server once per phase if it has taken longer than threshold
+func (osASG *openstackASG) checkBoot(state *bootState, phase string, d time.Duration, threshold time.Duration) {
+	if threshold <= 0 || d <= threshold || state.slow[phase] {
+		return
+	}
+	state.slow[phase] = true
+	slowBoots.WithLabelValues(osASG.clusterName, phase).Inc()
+	osASG.notifier.notify(osASG.clusterName, "SlowBoot", fmt.Sprintf("server %s took over %v to become %s", state.name, threshold, phase))
+}
+
+// nodeReadyAt returns the time the node became Ready, or zero time if it is not Ready
+func (osASG *openstackASG) nodeReadyAt(name string) (time.Time, error) {
+	node, err := osASG.kubeClient.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, c := range node.Status.Conditions {
+		if c.Type == v1.NodeReady && c.Status == v1.ConditionTrue {
+			return c.LastTransitionTime.Time, nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+func parseLaunchedAt(s string) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02T15:04:05.000000", "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,276 @@
+package autoscaler
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var eventBusMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "kops_autoscaler",
+	Name:      "event_bus_messages_total",
+	Help:      "Events published to the event bus by type and result, ok or error.",
+}, []string{"type", "result"})
+
+func init() {
+	prometheus.MustRegister(eventBusMessages)
+}
+
+// publisher publishes messages to a topic of a message bus
+type publisher interface {
+	publish(topic string, key string, message []byte) error
+}
+
+// eventBus publishes the events as CloudEvents in the structured JSON format to --event-bus
+type eventBus struct {
+	topic     string
+	publisher publisher
+}
+
+// newEventBus returns the bus of the address, or nil if address is empty. Supported are
+// nats://[user:password@]host:port and the Kafka REST proxy kafka+http(s)://[user:password@]host:port.
+func newEventBus(address string, topic string) (*eventBus, error) {
+	if address == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --event-bus %q: %v", address, err)
+	}
+	if topic == "" {
+		return nil, fmt.Errorf("--event-bus needs --event-bus-topic")
+	}
+	bus := &eventBus{topic: topic}
+	switch u.Scheme {
+	case "nats":
+		bus.publisher = &natsPublisher{url: u}
+	case "kafka+http", "kafka+https":
+		bus.publisher = &kafkaRESTPublisher{
+			url:    u,
+			client: &http.Client{Timeout: 10 * time.Second},
+		}
+	default:
+		return nil, fmt.Errorf("invalid --event-bus %q, scheme must be nats, kafka+http or kafka+https", address)
+	}
+	return bus, nil
+}
+
+// publish publishes the event of the cluster, keyed by the cluster so that the events of a
+// cluster stay in order. Errors are only logged.
+func (b *eventBus) publish(eventType string, cluster string, event []byte) {
+	if b == nil {
+		return
+	}
+	if err := b.publisher.publish(b.topic, cluster, event); err != nil {
+		eventBusMessages.WithLabelValues(eventType, "error").Inc()
+		glog.Errorf("Error publishing event %s of %s: %v", eventType, cluster, err)
+		return
+	}
+	eventBusMessages.WithLabelValues(eventType, "ok").Inc()
+}
+
+// natsPublisher publishes with the NATS client protocol over a connection kept between messages
+type natsPublisher struct {
+	url *url.URL
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// natsInfo is the part of the INFO message of the NATS server used by the publisher
+type natsInfo struct {
+	TLSRequired  bool `json:"tls_required"`
+	AuthRequired bool `json:"auth_required"`
+}
+
+func (p *natsPublisher) publish(subject string, key string, message []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+	err := p.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if err == nil {
+		_, err = fmt.Fprintf(p.conn, "PUB %s %d\r\n%s\r\nPING\r\n", subject, len(message), message)
+	}
+	if err == nil {
+		err = p.waitPong()
+	}
+	if err != nil {
+		p.conn.Close()
+		p.conn = nil
+		return err
+	}
+	return nil
+}
+
+// connect opens the connection and authenticates with the credentials of the url
+func (p *natsPublisher) connect() error {
+	host := p.url.Host
+	if p.url.Port() == "" {
+		host = net.JoinHostPort(p.url.Hostname(), "4222")
+	}
+	conn, err := net.DialTimeout("tcp", host, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("error connecting to NATS %s: %v", host, err)
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("error connecting to NATS %s: no INFO from server: %v", host, err)
+	}
+	info := natsInfo{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(line), "INFO ")), &info); err != nil {
+		conn.Close()
+		return fmt.Errorf("error parsing INFO of NATS %s: %v", host, err)
+	}
+	if info.TLSRequired {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: p.url.Hostname(), MinVersion: tls.VersionTLS12})
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return fmt.Errorf("error connecting to NATS %s with TLS: %v", host, err)
+		}
+		conn = tlsConn
+		reader = bufio.NewReader(conn)
+	}
+
+	options := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "kops-autoscaler-openstack",
+		"lang":     "go",
+		"version":  "1.0.0",
+	}
+	if user := p.url.User; user != nil {
+		if password, ok := user.Password(); ok {
+			options["user"] = user.Username()
+			options["pass"] = password
+		} else {
+			options["auth_token"] = user.Username()
+		}
+	}
+	data, err := json.Marshal(options)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	p.conn = conn
+	p.reader = reader
+	_, err = fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", data)
+	if err == nil {
+		err = p.waitPong()
+	}
+	if err != nil {
+		conn.Close()
+		p.conn = nil
+		return fmt.Errorf("error connecting to NATS %s: %v", host, err)
+	}
+	return nil
+}
+
+// waitPong reads the messages of the server until the PONG to the latest PING. Errors sent by
+// the server are returned.
+func (p *natsPublisher) waitPong() error {
+	for {
+		line, err := p.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := fmt.Fprint(p.conn, "PONG\r\n"); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS server returned %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+// kafkaRESTPublisher publishes to Kafka through the Confluent REST proxy, as no Kafka client
+// is vendored
+type kafkaRESTPublisher struct {
+	url    *url.URL
+	client *http.Client
+}
+
+// kafkaRecords is the v2 produce request of the REST proxy
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// kafkaOffsets is the v2 produce response of the REST proxy
+type kafkaOffsets struct {
+	Offsets []struct {
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+func (p *kafkaRESTPublisher) publish(topic string, key string, message []byte) error {
+	u := *p.url
+	u.Scheme = strings.TrimPrefix(u.Scheme, "kafka+")
+	u.User = nil
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/topics/" + url.PathEscape(topic)
+	body, err := json.Marshal(kafkaRecords{Records: []kafkaRecord{{Key: key, Value: message}}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	if user := p.url.User; user != nil {
+		password, _ := user.Password()
+		req.SetBasicAuth(user.Username(), password)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Kafka REST proxy returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	offsets := kafkaOffsets{}
+	if err := json.Unmarshal(data, &offsets); err != nil {
+		return fmt.Errorf("error parsing response of Kafka REST proxy: %v", err)
+	}
+	for _, o := range offsets.Offsets {
+		if o.ErrorCode != nil {
+			return fmt.Errorf("Kafka REST proxy returned error %d: %s", *o.ErrorCode, o.Error)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package autoscaler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/kops/pkg/apis/kops"
+)
+
+// cachedSpec is the last known cluster and instance group specs, stored on local disk
+type cachedSpec struct {
+	Saved          time.Time             `json:"saved"`
+	Cluster        *kops.Cluster         `json:"cluster"`
+	InstanceGroups []*kops.InstanceGroup `json:"instanceGroups"`
+}
+
+func cachePath(dir string, clusterName string) string {
+	return filepath.Join(dir, clusterName+".json")
+}
+
+func saveSpec(dir string, cluster *kops.Cluster, instanceGroups []*kops.InstanceGroup) error {
+	data, err := json.Marshal(&cachedSpec{
+		Saved:          time.Now().UTC(),
+		Cluster:        cluster,
+		InstanceGroups: instanceGroups,
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	p := cachePath(dir, cluster.ObjectMeta.Name)
+	// write through temporary file so that a crash never leaves partial cache
+	tmp := p + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func loadSpec(dir string, clusterName string) (*cachedSpec, error) {
+	data, err := ioutil.ReadFile(cachePath(dir, clusterName))
+	if err != nil {
+		return nil, err
+	}
+	spec := &cachedSpec{}
+	if err := json.Unmarshal(data, spec); err != nil {
+		return nil, fmt.Errorf("error parsing cached spec: %v", err)
+	}
+	return spec, nil
+}
+
+// checkCachedSpec compares the cached specs against the servers in OpenStack when the state store
+// is not available. The differences are only reported.
+func (osASG *openstackASG) checkCachedSpec(stateStoreErr error) error {
+	spec, err := loadSpec(osASG.opts.SpecCacheDir, osASG.clusterName)
+	if err != nil {
+		glog.Warningf("No usable cached spec for %s: %v", osASG.clusterName, err)
+		return stateStoreErr
+	}
+	age := time.Since(spec.Saved)
+	if osASG.opts.SpecCacheMaxAge > 0 && age > osASG.opts.SpecCacheMaxAge {
+		glog.Warningf("Cached spec for %s is %v old, not using it", osASG.clusterName, age.Round(time.Second))
+		return stateStoreErr
+	}
+
+	glog.Warningf("State store is not available (%v), checking %s against spec cached %v ago", stateStoreErr, osASG.clusterName, age.Round(time.Second))
+	drift, err := osASG.inventoryDrift(spec.Cluster, spec.InstanceGroups)
+	if err != nil {
+		return fmt.Errorf("error checking cached spec: %v", err)
+	}
+	for _, d := range drift {
+		glog.Warningf("Not applying changes, state store is not available: %s", d)
+	}
+	return nil
+}
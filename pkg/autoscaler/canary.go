@@ -0,0 +1,129 @@
+package autoscaler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstacktasks"
+)
+
+// instanceCreates returns the instances which the plan would create
+func (p *Plan) instanceCreates() []Change {
+	var creates []Change
+	for _, c := range p.Changes {
+		if c.Type == "Instance" && c.Action == actionCreate {
+			creates = append(creates, c)
+		}
+	}
+	return creates
+}
+
+func (p *Plan) creates(name string) bool {
+	for _, c := range p.instanceCreates() {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// canary creates the first of the new instances alone and waits until it has joined the
+// cluster as Ready node. Nothing else is created while the canary is failing.
+func (osASG *openstackASG) canary(plan *Plan) error {
+	if osASG.failedCanary != "" {
+		// the failed canary is recreated as new canary once someone has deleted it
+		if !plan.creates(osASG.failedCanary) {
+			ready, err := osASG.nodeReady(osASG.failedCanary)
+			if err != nil {
+				return err
+			}
+			if !ready {
+				return fmt.Errorf("canary instance %s is not Ready, not creating more instances", osASG.failedCanary)
+			}
+			glog.Infof("Canary instance %s has become Ready\n", osASG.failedCanary)
+		}
+		osASG.failedCanary = ""
+	}
+
+	// the servers deferred by the capacity check are not created in this execution
+	var creates []Change
+	for _, c := range plan.instanceCreates() {
+		if !osASG.deferred[c.Name] {
+			creates = append(creates, c)
+		}
+	}
+	if len(creates) < 2 {
+		return nil
+	}
+	canary := creates[0]
+	instance, ok := canary.task.(*openstacktasks.Instance)
+	if !ok {
+		return fmt.Errorf("unexpected task %T for %s", canary.task, canary.Key)
+	}
+
+	// skip the other instances and their ports
+	skip := instanceTasks(osASG.ApplyCmd.TaskMap, func(i *openstacktasks.Instance) bool {
+		return i != instance
+	})
+
+	glog.Infof("Creating canary instance %s before %d other instances\n", canary.Name, len(creates)-1)
+	err := osASG.applyTasks(func(key string, task fi.Task) bool {
+		return skip[task]
+	})
+	if err == nil {
+		err = osASG.waitForNode(canary.Name, instance)
+	}
+	if err != nil {
+		osASG.failedCanary = canary.Name
+		osASG.notifier.notify(osASG.clusterName, "CanaryFailed", fmt.Sprintf("canary instance %s failed, not creating %d other instances: %v", canary.Name, len(creates)-1, err), creates...)
+		return fmt.Errorf("canary instance %s failed: %v", canary.Name, err)
+	}
+	glog.Infof("Canary instance %s is Ready\n", canary.Name)
+	return nil
+}
+
+// waitForNode waits until the node of the instance is Ready or the server has failed
+func (osASG *openstackASG) waitForNode(name string, instance *openstacktasks.Instance) error {
+	cloud, err := osASG.openstackCloud()
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(osASG.opts.CanaryTimeout)
+	for time.Now().Before(deadline) {
+		if instance.ID != nil {
+			server, err := servers.Get(cloud.ComputeClient(), fi.StringValue(instance.ID)).Extract()
+			if err != nil {
+				glog.Warningf("Error reading server %s: %v", name, err)
+			} else if server.Status == "ERROR" {
+				return fmt.Errorf("server %s is in ERROR state", name)
+			}
+		}
+		ready, err := osASG.nodeReady(name)
+		if err != nil {
+			glog.Warningf("Error reading node %s: %v", name, err)
+		}
+		if ready {
+			return nil
+		}
+		if err := sleepContext(osASG.ctx(), 10*time.Second); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("node %s did not become Ready in %v", name, osASG.opts.CanaryTimeout)
+}
+
+func (osASG *openstackASG) nodeReady(name string) (bool, error) {
+	node, err := osASG.kubeClient.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return nodeReady(node), nil
+}
@@ -0,0 +1,313 @@
+package autoscaler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	az "github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/availabilityzones"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstacktasks"
+)
+
+// capacity policies, selected with --capacity-policy
+const (
+	capacityWarn  = "warn"
+	capacitySplit = "split"
+)
+
+// hypervisor is a compute host from the hypervisors API, which needs admin access by default
+type hypervisor struct {
+	Hostname string `json:"hypervisor_hostname"`
+	Service  struct {
+		Host string `json:"host"`
+	} `json:"service"`
+	State        string `json:"state"`
+	Status       string `json:"status"`
+	VCPUs        int    `json:"vcpus"`
+	VCPUsUsed    int    `json:"vcpus_used"`
+	MemoryMB     int    `json:"memory_mb"`
+	MemoryMBUsed int    `json:"memory_mb_used"`
+
+	zone     string
+	freeCPU  float64
+	freeRAM  float64
+	assigned int
+}
+
+// hostServer is a server together with the hypervisor it runs on, visible to admins only
+type hostServer struct {
+	servers.Server
+	Hypervisor string `json:"OS-EXT-SRV-ATTR:hypervisor_hostname"`
+}
+
+// capacityRequest is a new server to place
+type capacityRequest struct {
+	server string
+	group  string
+	vcpus  int
+	ram    int
+}
+
+// checkCapacity projects whether the new servers of a large scale-up fit the free capacity of the
+// hypervisors. Kops puts the servers of an instance group to an anti-affinity server group, so each
+// hypervisor takes at most one of them. When they do not fit, the scale-up is notified and with the
+// split policy the servers which fit are spread over the zones and the rest are left to the next
+// execution. Nothing is checked when the hypervisors can not be listed, e.g. without admin access.
+func (osASG *openstackASG) checkCapacity(plan *Plan) error {
+	osASG.capacityZones = nil
+	osASG.deferred = nil
+	creates := plan.instanceCreates()
+	if !osASG.opts.CheckCapacity || len(creates) < osASG.opts.CapacityMinCreates {
+		return nil
+	}
+	if caps := osASG.features(); caps != nil && !caps.hypervisors {
+		return nil
+	}
+	cloud, err := osASG.openstackCloud()
+	if err != nil {
+		return err
+	}
+	hypervisors, err := listHypervisors(cloud.ComputeClient())
+	if err != nil {
+		if _, ok := err.(gophercloud.ErrDefault403); ok {
+			glog.V(2).Infof("Not checking capacity, listing hypervisors is not allowed\n")
+			return nil
+		}
+		glog.Warningf("Not checking capacity: %v", err)
+		return nil
+	}
+	requests, err := capacityRequests(cloud, creates)
+	if err != nil {
+		glog.Warningf("Not checking capacity: %v", err)
+		return nil
+	}
+	zones := hostZones(cloud)
+	used, err := osASG.groupHosts(cloud)
+	if err != nil {
+		glog.Warningf("Not checking capacity: %v", err)
+		return nil
+	}
+	for _, h := range hypervisors {
+		h.zone = zones[h.Service.Host]
+		h.freeCPU = float64(h.VCPUs)*osASG.opts.CPUAllocationRatio - float64(h.VCPUsUsed)
+		h.freeRAM = float64(h.MemoryMB)*osASG.opts.RAMAllocationRatio - float64(h.MemoryMBUsed)
+	}
+
+	placed, unplaced := placeServers(hypervisors, requests, used)
+	if len(unplaced) == 0 {
+		glog.V(2).Infof("Projected capacity fits the %d new servers of %s\n", len(requests), osASG.clusterName)
+		if osASG.opts.CapacityPolicy == capacitySplit {
+			osASG.capacityZones = placed
+		}
+		return nil
+	}
+
+	perZone := make(map[string]int)
+	for _, zone := range placed {
+		perZone[zone]++
+	}
+	var counts []string
+	for zone, n := range perZone {
+		if zone == "" {
+			zone = "unknown zone"
+		}
+		counts = append(counts, fmt.Sprintf("%s: %d", zone, n))
+	}
+	sort.Strings(counts)
+	message := fmt.Sprintf("projected capacity fits %d of %d new servers (%s)", len(placed), len(requests), strings.Join(counts, ", "))
+	var deferred []Change
+	for _, c := range creates {
+		for _, name := range unplaced {
+			if c.Name == name {
+				deferred = append(deferred, c)
+			}
+		}
+	}
+	if osASG.opts.CapacityPolicy != capacitySplit {
+		osASG.notifier.notify(osASG.clusterName, "InsufficientCapacity", message, deferred...)
+		return nil
+	}
+	if len(placed) == 0 {
+		osASG.notifier.notify(osASG.clusterName, "InsufficientCapacity", message+", not creating any", deferred...)
+		return fmt.Errorf("no capacity for the %d new servers", len(requests))
+	}
+	osASG.notifier.notify(osASG.clusterName, "InsufficientCapacity", message+", creating the ones which fit", deferred...)
+	osASG.capacityZones = placed
+	osASG.deferred = make(map[string]bool)
+	for _, name := range unplaced {
+		osASG.deferred[name] = true
+	}
+	osASG.record("deferred creation of %d servers, insufficient capacity", len(unplaced))
+	return nil
+}
+
+// placeServers projects the hypervisors the new servers would be scheduled to. A hypervisor takes at
+// most one server of an instance group, the servers are spread over the zones and otherwise go to
+// the hypervisor with the most free memory. Returns the zone of each placed server and the servers
+// which do not fit.
+func placeServers(hypervisors []*hypervisor, requests []capacityRequest, used map[string]map[string]bool) (map[string]string, []string) {
+	placed := make(map[string]string)
+	var unplaced []string
+	groupZones := make(map[string]map[string]int)
+	for _, r := range requests {
+		if groupZones[r.group] == nil {
+			groupZones[r.group] = make(map[string]int)
+		}
+		if used[r.group] == nil {
+			used[r.group] = make(map[string]bool)
+		}
+		var best *hypervisor
+		for _, h := range hypervisors {
+			if h.State != "up" || h.Status != "enabled" || used[r.group][h.Hostname] {
+				continue
+			}
+			if h.freeCPU < float64(r.vcpus) || h.freeRAM < float64(r.ram) {
+				continue
+			}
+			if best == nil || groupZones[r.group][h.zone] < groupZones[r.group][best.zone] ||
+				(groupZones[r.group][h.zone] == groupZones[r.group][best.zone] && h.freeRAM > best.freeRAM) {
+				best = h
+			}
+		}
+		if best == nil {
+			unplaced = append(unplaced, r.server)
+			continue
+		}
+		best.freeCPU -= float64(r.vcpus)
+		best.freeRAM -= float64(r.ram)
+		used[r.group][best.Hostname] = true
+		groupZones[r.group][best.zone]++
+		placed[r.server] = best.zone
+	}
+	return placed, unplaced
+}
+
+func listHypervisors(client *gophercloud.ServiceClient) ([]*hypervisor, error) {
+	var body struct {
+		Hypervisors []*hypervisor `json:"hypervisors"`
+	}
+	if _, err := client.Get(client.ServiceURL("os-hypervisors", "detail"), &body, nil); err != nil {
+		return nil, err
+	}
+	for _, h := range body.Hypervisors {
+		// newer microversions do not report the resources
+		if h.MemoryMB == 0 {
+			return nil, fmt.Errorf("hypervisors do not report their resources")
+		}
+	}
+	return body.Hypervisors, nil
+}
+
+// capacityRequests returns the flavor resources of the new servers, in the order of the plan
+func capacityRequests(cloud openstack.OpenstackCloud, creates []Change) ([]capacityRequest, error) {
+	page, err := flavors.ListDetail(cloud.ComputeClient(), flavors.ListOpts{}).AllPages()
+	if err != nil {
+		return nil, fmt.Errorf("error listing flavors: %v", err)
+	}
+	list, err := flavors.ExtractFlavors(page)
+	if err != nil {
+		return nil, fmt.Errorf("error listing flavors: %v", err)
+	}
+	byName := make(map[string]flavors.Flavor)
+	for _, f := range list {
+		byName[f.Name] = f
+	}
+	var requests []capacityRequest
+	for _, c := range creates {
+		instance, ok := c.task.(*openstacktasks.Instance)
+		if !ok {
+			continue
+		}
+		flavor, ok := byName[fi.StringValue(instance.Flavor)]
+		if !ok {
+			return nil, fmt.Errorf("flavor %q of %s not found", fi.StringValue(instance.Flavor), c.Name)
+		}
+		group := ""
+		if instance.ServerGroup != nil {
+			group = fi.StringValue(instance.ServerGroup.Name)
+		}
+		requests = append(requests, capacityRequest{server: c.Name, group: group, vcpus: flavor.VCPUs, ram: flavor.RAM})
+	}
+	return requests, nil
+}
+
+// hostZones returns the availability zones of the compute hosts. The zones of the hosts are only
+// visible to admins, without them all hosts are in the same unknown zone.
+func hostZones(cloud openstack.OpenstackCloud) map[string]string {
+	zones := make(map[string]string)
+	page, err := az.ListDetail(cloud.ComputeClient()).AllPages()
+	if err != nil {
+		glog.V(2).Infof("Error listing hosts of availability zones: %v\n", err)
+		return zones
+	}
+	list, err := az.ExtractAvailabilityZones(page)
+	if err != nil {
+		glog.V(2).Infof("Error listing hosts of availability zones: %v\n", err)
+		return zones
+	}
+	for _, zone := range list {
+		for host, services := range zone.Hosts {
+			if _, ok := services["nova-compute"]; ok {
+				zones[host] = zone.ZoneName
+			}
+		}
+	}
+	return zones
+}
+
+// groupHosts returns the hypervisors of the existing servers of the cluster by server group
+func (osASG *openstackASG) groupHosts(cloud openstack.OpenstackCloud) (map[string]map[string]bool, error) {
+	pages, err := servers.List(cloud.ComputeClient(), servers.ListOpts{}).AllPages()
+	if err != nil {
+		return nil, fmt.Errorf("error listing servers: %v", err)
+	}
+	var list []hostServer
+	if err := servers.ExtractServersInto(pages, &list); err != nil {
+		return nil, fmt.Errorf("error listing servers: %v", err)
+	}
+	used := make(map[string]map[string]bool)
+	for _, s := range list {
+		if s.Metadata[openstack.TagClusterName] != osASG.clusterName || s.Hypervisor == "" {
+			continue
+		}
+		ig := osASG.instanceGroupFor(s.Name)
+		if ig == "" {
+			continue
+		}
+		group := osASG.clusterName + "-" + ig
+		if used[group] == nil {
+			used[group] = make(map[string]bool)
+		}
+		used[group][s.Hypervisor] = true
+	}
+	return used, nil
+}
+
+// zoneOpts sets the availability zone of the server create request
+type zoneOpts struct {
+	servers.CreateOptsBuilder
+	zone string
+}
+
+func (opts *zoneOpts) ToServerCreateMap() (map[string]interface{}, error) {
+	m, err := opts.CreateOptsBuilder.ToServerCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	m["server"].(map[string]interface{})["availability_zone"] = opts.zone
+	return m, nil
+}
+
+func validateCapacityPolicy(policy string) error {
+	switch policy {
+	case capacityWarn, capacitySplit:
+		return nil
+	}
+	return fmt.Errorf("unknown capacity policy %q, must be warn or split", policy)
+}
@@ -0,0 +1,167 @@
+package autoscaler
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/client/clientset_generated/clientset/typed/kops/internalversion"
+	"k8s.io/kops/pkg/client/simple"
+)
+
+var chaosInjections = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "kops_autoscaler",
+	Name:      "chaos_injected_failures_total",
+	Help:      "Number of simulated failures injected by --chaos.",
+}, []string{"target", "failure"})
+
+func init() {
+	prometheus.MustRegister(chaosInjections)
+}
+
+// chaosFailures are the simulated failures of the OpenStack API. 429 goes through the throttling
+// retries, 5xx and connection errors fail the task and exercise the partial apply recovery.
+var chaosFailures = []string{"connection", "429", "500", "503"}
+
+// chaos decides randomly which calls fail. It is meant for test environments only.
+type chaos struct {
+	rate float64
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func newChaos(rate float64) *chaos {
+	return &chaos{
+		rate: rate,
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// inject returns the failure to simulate, or an empty string if the call should go through
+func (c *chaos) inject(target string, failures []string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rand.Float64() >= c.rate {
+		return ""
+	}
+	failure := failures[c.rand.Intn(len(failures))]
+	chaosInjections.WithLabelValues(target, failure).Inc()
+	return failure
+}
+
+// chaosTransport fails OpenStack API requests at random without sending them
+type chaosTransport struct {
+	next  http.RoundTripper
+	chaos *chaos
+}
+
+func newChaosTransport(next http.RoundTripper, rate float64) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &chaosTransport{
+		next:  next,
+		chaos: newChaos(rate),
+	}
+}
+
+func (t *chaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	failure := t.chaos.inject("openstack", chaosFailures)
+	if failure == "" {
+		return t.next.RoundTrip(req)
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	glog.Warningf("chaos: injecting %s failure into %s %s", failure, req.Method, req.URL)
+	if failure == "connection" {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("chaos: connection refused")}
+	}
+	var code int
+	fmt.Sscanf(failure, "%d", &code)
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode: code,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(`{"message": "injected by --chaos"}`)),
+		Request:    req,
+	}, nil
+}
+
+// chaosClientset fails the reads and writes of the cluster and the instance groups at random
+type chaosClientset struct {
+	simple.Clientset
+	chaos *chaos
+}
+
+func (c *chaosClientset) fail(op string) error {
+	if c.chaos.inject("statestore", []string{op}) == "" {
+		return nil
+	}
+	glog.Warningf("chaos: injecting state store failure into %s", op)
+	return fmt.Errorf("chaos: simulated state store failure in %s", op)
+}
+
+func (c *chaosClientset) GetCluster(name string) (*kops.Cluster, error) {
+	if err := c.fail("get_cluster"); err != nil {
+		return nil, err
+	}
+	return c.Clientset.GetCluster(name)
+}
+
+func (c *chaosClientset) InstanceGroupsFor(cluster *kops.Cluster) internalversion.InstanceGroupInterface {
+	return &chaosInstanceGroups{
+		InstanceGroupInterface: c.Clientset.InstanceGroupsFor(cluster),
+		clientset:              c,
+	}
+}
+
+type chaosInstanceGroups struct {
+	internalversion.InstanceGroupInterface
+	clientset *chaosClientset
+}
+
+func (c *chaosInstanceGroups) Get(name string, options v1.GetOptions) (*kops.InstanceGroup, error) {
+	if err := c.clientset.fail("get_instancegroup"); err != nil {
+		return nil, err
+	}
+	return c.InstanceGroupInterface.Get(name, options)
+}
+
+func (c *chaosInstanceGroups) List(options v1.ListOptions) (*kops.InstanceGroupList, error) {
+	if err := c.clientset.fail("list_instancegroups"); err != nil {
+		return nil, err
+	}
+	return c.InstanceGroupInterface.List(options)
+}
+
+func (c *chaosInstanceGroups) Update(ig *kops.InstanceGroup) (*kops.InstanceGroup, error) {
+	if err := c.clientset.fail("update_instancegroup"); err != nil {
+		return nil, err
+	}
+	return c.InstanceGroupInterface.Update(ig)
+}
+
+func validateChaos(rate float64) error {
+	if rate < 0 || rate > 1 {
+		return fmt.Errorf("invalid chaos rate %v, must be between 0 and 1", rate)
+	}
+	if rate > 0 {
+		glog.Warningf("Chaos mode: %.0f%% of the OpenStack requests and state store calls fail on purpose, never use this in production", rate*100)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package autoscaler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstacktasks"
+)
+
+// annotationChurnBudget limits the servers of an instance group created or replaced per hour
+const annotationChurnBudget = annotationPrefix + "max-churn-per-hour"
+
+// churnWindow is the period of the churn budget
+const churnWindow = time.Hour
+
+// churnBudget returns the churn budget set in the annotation of the instance group, or -1 if it has none
+func churnBudget(ig *kops.InstanceGroup) (int, error) {
+	v, ok := ig.ObjectMeta.Annotations[annotationChurnBudget]
+	if !ok {
+		return -1, nil
+	}
+	budget, err := strconv.Atoi(v)
+	if err != nil || budget < 0 {
+		return -1, fmt.Errorf("invalid annotation %s %q", annotationChurnBudget, v)
+	}
+	return budget, nil
+}
+
+// churnUsed returns the servers of the instance group created or replaced during the last hour
+func (osASG *openstackASG) churnUsed(ig string) int {
+	cutoff := time.Now().Add(-churnWindow)
+	var recent []time.Time
+	for _, t := range osASG.churn[ig] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	osASG.churn[ig] = recent
+	return len(recent)
+}
+
+// churnLimited splits the changes of the servers over the churn budget of their instance group from
+// the changes within it. A server counts once, when it is created or when it is deleted for replacement.
+// Creating the server again after the replacement does not count.
+func (osASG *openstackASG) churnLimited(changes []Change) ([]Change, []Change) {
+	budgets := make(map[string]int)
+	for _, ig := range osASG.instanceGroups {
+		if budget, err := churnBudget(ig); err == nil && budget >= 0 {
+			budgets[ig.ObjectMeta.Name] = budget
+		}
+	}
+	if len(budgets) == 0 {
+		return changes, nil
+	}
+	if osASG.churn == nil {
+		osASG.churn = make(map[string][]time.Time)
+	}
+
+	var churning []Change
+	for _, c := range changes {
+		if c.Type == "Instance" && ((c.Action == actionCreate && !osASG.replaced[c.Name]) || c.Kind == kindReplacement) {
+			churning = append(churning, c)
+		}
+	}
+	sort.Slice(churning, func(i, j int) bool {
+		return churning[i].Name < churning[j].Name
+	})
+	used := make(map[string]int)
+	limited := make(map[string]bool)
+	for _, c := range churning {
+		ig := osASG.instanceGroupFor(c.Name)
+		budget, ok := budgets[ig]
+		if !ok {
+			continue
+		}
+		if _, ok := used[ig]; !ok {
+			used[ig] = osASG.churnUsed(ig)
+		}
+		if used[ig] >= budget {
+			limited[c.Name] = true
+			continue
+		}
+		used[ig]++
+	}
+	if len(limited) == 0 {
+		return changes, nil
+	}
+
+	var result, postponed []Change
+	for _, c := range changes {
+		if server := changeInstance(c); server != "" && limited[server] {
+			postponed = append(postponed, c)
+			continue
+		}
+		result = append(result, c)
+	}
+	glog.Infof("Postponing %d servers over the churn budget of their instance groups\n", len(limited))
+	osASG.record("postponed %d servers, churn budget used", len(limited))
+	return result, postponed
+}
+
+// recordChurn counts the servers created and deleted for replacement by the applied plan in the
+// churn budgets of their instance groups
+func (osASG *openstackASG) recordChurn(plan *Plan) {
+	now := time.Now()
+	for _, c := range plan.Changes {
+		if c.Type != "Instance" {
+			continue
+		}
+		switch {
+		case c.Kind == kindReplacement:
+			if osASG.replaced == nil {
+				osASG.replaced = make(map[string]bool)
+			}
+			osASG.replaced[c.Name] = true
+		case c.Action == actionCreate:
+			if i, ok := c.task.(*openstacktasks.Instance); !ok || i.ID == nil {
+				continue
+			}
+			if osASG.replaced[c.Name] {
+				delete(osASG.replaced, c.Name)
+				continue
+			}
+		default:
+			continue
+		}
+		if osASG.churn == nil {
+			osASG.churn = make(map[string][]time.Time)
+		}
+		ig := osASG.instanceGroupFor(c.Name)
+		osASG.churn[ig] = append(osASG.churn[ig], now)
+	}
+}
@@ -0,0 +1,277 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	v2pools "github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/pools"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+// types of the resources found by cleanup
+const (
+	resourceServer     = "Server"
+	resourcePort       = "Port"
+	resourceFloatingIP = "FloatingIP"
+	resourcePoolMember = "PoolMember"
+)
+
+// CleanupResource is a resource created for the servers of a cluster
+type CleanupResource struct {
+	Type    string `json:"type"`
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Deleted bool   `json:"deleted"`
+
+	// server is the server the port or floating IP belongs to, and pool the pool of a member
+	server string
+	pool   string
+}
+
+func (r *CleanupResource) String() string {
+	return fmt.Sprintf("%s %s (%s)", r.Type, r.Name, r.ID)
+}
+
+// Cleanup finds the servers of the instance groups of the cluster, or of one instance group if
+// instanceGroup is set, with their floating IPs, ports and API load balancer pool members, and the
+// ports of the servers left behind. The resources are deleted if confirm returns true for them.
+// Only servers tagged to the cluster or in the server group of their instance group are included.
+func Cleanup(opts *Options, clusterName string, instanceGroup string, confirm func([]*CleanupResource) bool) ([]*CleanupResource, error) {
+	clientset, err := newClientset(opts)
+	if err != nil {
+		return nil, err
+	}
+	config, err := loadConfig(opts.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	osASG := &openstackASG{
+		opts:        opts,
+		clientset:   clientset,
+		clusterName: clusterName,
+		config:      config,
+	}
+	cluster, err := clientset.GetCluster(clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cluster %q: %v", clusterName, err)
+	}
+	groups := []string{instanceGroup}
+	if instanceGroup == "" {
+		list, err := clientset.InstanceGroupsFor(cluster).List(metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error reading instance groups of %s: %v", clusterName, err)
+		}
+		groups = nil
+		for _, ig := range list.Items {
+			groups = append(groups, ig.ObjectMeta.Name)
+		}
+	}
+	cloud, err := osASG.cloudFor(cluster)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := cleanupResources(cloud, clusterName, groups)
+	if err != nil || len(resources) == 0 || !confirm(resources) {
+		return resources, err
+	}
+	return resources, deleteResources(cloud, resources)
+}
+
+// cleanupResources lists the resources of the servers kops builds for the instance groups, named
+// <cluster>-<instance group>-<number>
+func cleanupResources(cloud openstack.OpenstackCloud, clusterName string, groups []string) ([]*CleanupResource, error) {
+	groupOf := func(server string) string {
+		for _, ig := range groups {
+			if groupServer(clusterName, ig, server) {
+				return ig
+			}
+		}
+		return ""
+	}
+	members, err := cleanupGroupMembers(cloud, clusterName, groups)
+	if err != nil {
+		return nil, err
+	}
+	list, err := cloud.ListInstances(servers.ListOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing servers: %v", err)
+	}
+	var resources []*CleanupResource
+	serverIDs := make(map[string]string)
+	addresses := make(map[string]bool)
+	for _, s := range list {
+		ig := groupOf(s.Name)
+		tag, tagged := s.Metadata[openstack.TagClusterName]
+		if ig == "" || (tagged && tag != clusterName) {
+			continue
+		}
+		// untagged servers, e.g. bastions, must be in the server group of the instance group
+		if !tagged && members[s.ID] != ig {
+			continue
+		}
+		serverIDs[s.ID] = s.Name
+		for _, address := range fixedAddresses(&s, clusterName) {
+			addresses[address] = true
+		}
+		resources = append(resources, &CleanupResource{Type: resourceServer, ID: s.ID, Name: s.Name})
+	}
+
+	fips, err := cloud.ListFloatingIPs()
+	if err != nil {
+		return nil, fmt.Errorf("error listing floating IPs: %v", err)
+	}
+	for _, fip := range fips {
+		if name, ok := serverIDs[fip.InstanceID]; ok {
+			resources = append(resources, &CleanupResource{Type: resourceFloatingIP, ID: fip.ID, Name: fip.IP, server: name})
+		}
+	}
+
+	portList, err := cloud.ListPorts(ports.ListOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing ports: %v", err)
+	}
+	for _, p := range portList {
+		server := strings.TrimSuffix(strings.TrimPrefix(p.Name, "port-"), providerPortSuffix)
+		if !strings.HasPrefix(p.Name, "port-") || groupOf(server) == "" {
+			continue
+		}
+		// ports attached to other servers, e.g. renamed ones, are left alone
+		name, ok := serverIDs[p.DeviceID]
+		if !ok && p.DeviceID != "" {
+			continue
+		}
+		resources = append(resources, &CleanupResource{Type: resourcePort, ID: p.ID, Name: p.Name, server: name})
+	}
+
+	poolResources, err := poolMembers(cloud, clusterName, groups, addresses)
+	if err != nil {
+		return nil, err
+	}
+	resources = append(resources, poolResources...)
+	sort.SliceStable(resources, func(i, j int) bool {
+		if resources[i].Type != resources[j].Type {
+			return resources[i].Type < resources[j].Type
+		}
+		return resources[i].Name < resources[j].Name
+	})
+	return resources, nil
+}
+
+// cleanupGroupMembers returns the instance groups of the servers in the server groups of the
+// instance groups by server ID
+func cleanupGroupMembers(cloud openstack.OpenstackCloud, clusterName string, groups []string) (map[string]string, error) {
+	serverGroups, err := cloud.ListServerGroups()
+	if err != nil {
+		return nil, fmt.Errorf("error listing server groups: %v", err)
+	}
+	members := make(map[string]string)
+	for _, g := range serverGroups {
+		for _, ig := range groups {
+			if g.Name != clusterName+"-"+ig {
+				continue
+			}
+			for _, id := range g.Members {
+				members[id] = ig
+			}
+		}
+	}
+	return members, nil
+}
+
+// poolMembers returns the load balancer pool members of the servers, which kops and the
+// autoscaler name after the server group of the instance group
+func poolMembers(cloud openstack.OpenstackCloud, clusterName string, groups []string, addresses map[string]bool) ([]*CleanupResource, error) {
+	if cloud.LoadBalancerClient() == nil || len(addresses) == 0 {
+		return nil, nil
+	}
+	names := make(map[string]bool)
+	for _, ig := range groups {
+		names[strings.ToLower(clusterName+"-"+ig)] = true
+	}
+	pools, err := cloud.ListPools(v2pools.ListOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pools: %v", err)
+	}
+	var resources []*CleanupResource
+	for _, pool := range pools {
+		page, err := v2pools.ListMembers(cloud.LoadBalancerClient(), pool.ID, v2pools.ListMembersOpts{}).AllPages()
+		if err != nil {
+			return nil, fmt.Errorf("error listing members of pool %s: %v", pool.Name, err)
+		}
+		members, err := v2pools.ExtractMembers(page)
+		if err != nil {
+			return nil, fmt.Errorf("error listing members of pool %s: %v", pool.Name, err)
+		}
+		for _, m := range members {
+			if addresses[canonicalIP(m.Address)] && names[strings.ToLower(m.Name)] {
+				resources = append(resources, &CleanupResource{
+					Type: resourcePoolMember,
+					ID:   m.ID,
+					Name: pool.Name + "/" + m.Address,
+					pool: pool.ID,
+				})
+			}
+		}
+	}
+	return resources, nil
+}
+
+// deleteResources removes the pool members first, so that the API load balancer does not send
+// requests to servers being deleted, then the servers with their floating IPs and ports, and
+// last the ports left without a server
+func deleteResources(cloud openstack.OpenstackCloud, resources []*CleanupResource) error {
+	for _, r := range resources {
+		if r.Type != resourcePoolMember {
+			continue
+		}
+		pool, err := v2pools.Get(cloud.LoadBalancerClient(), r.pool).Extract()
+		if err != nil {
+			return fmt.Errorf("error reading pool of %s: %v", r, err)
+		}
+		for _, lb := range pool.Loadbalancers {
+			if err := waitLBActive(context.Background(), cloud, lb.ID); err != nil {
+				return err
+			}
+		}
+		glog.Infof("Deleting %s\n", r)
+		if err := v2pools.DeleteMember(cloud.LoadBalancerClient(), r.pool, r.ID).ExtractErr(); err != nil {
+			return fmt.Errorf("error deleting %s: %v", r, err)
+		}
+		r.Deleted = true
+	}
+	for _, r := range resources {
+		if r.Type != resourceServer {
+			continue
+		}
+		if err := deleteServer(cloud, r.ID, r.Name, gcAll); err != nil {
+			return err
+		}
+		r.Deleted = true
+		// deleteServer removes the floating IPs and the ports named after the server
+		for _, dependent := range resources {
+			switch {
+			case dependent.server != r.Name:
+			case dependent.Type == resourceFloatingIP,
+				dependent.Type == resourcePort && (dependent.Name == "port-"+r.Name || dependent.Name == "port-"+r.Name+providerPortSuffix):
+				dependent.Deleted = true
+			}
+		}
+	}
+	for _, r := range resources {
+		if r.Type != resourcePort || r.Deleted {
+			continue
+		}
+		glog.Infof("Deleting %s\n", r)
+		if err := cloud.DeletePort(r.ID); err != nil {
+			return fmt.Errorf("error deleting %s: %v", r, err)
+		}
+		r.Deleted = true
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package autoscaler
+
+import (
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+// cloudMaxAge is how long the OpenStack clients are reused. The clients authenticate again when
+// their token has expired, rebuilding them also refreshes the service catalog.
+const cloudMaxAge = 30 * time.Minute
+
+// clients are the OpenStack cloud and the kops stores of a cluster, reused between executions
+type clients struct {
+	cloud       openstack.OpenstackCloud
+	cloudConfig *kops.CloudConfiguration
+	configBase  string
+	created     time.Time
+	generation  int64
+	scope       keystoneScope
+	keyStore    fi.CAStore
+	secretStore fi.SecretStore
+	// capabilities are the probed features of the cloud
+	capabilities *capabilities
+}
+
+// cloudFor returns the OpenStack cloud of the cluster. The cloud is built again when the
+// cloud config or the keystone scope of the cluster has changed, when it is older than
+// cloudMaxAge, when the credentials have been rotated or after resetClients.
+func (osASG *openstackASG) cloudFor(cluster *kops.Cluster) (openstack.OpenstackCloud, error) {
+	c := osASG.clients
+	generation := atomic.LoadInt64(&credentialsGeneration)
+	settings, err := resolveSettings(osASG.opts, osASG.config, cluster)
+	if err != nil {
+		return nil, err
+	}
+	scope := keystoneScopeFor(osASG.opts, settings)
+	if c != nil && c.cloud != nil && time.Since(c.created) < cloudMaxAge && c.generation == generation &&
+		c.scope == scope && reflect.DeepEqual(c.cloudConfig, cluster.Spec.CloudConfig) {
+		return c.cloud, nil
+	}
+	cloud, err := buildOpenstackCloud(cluster, osASG.opts, scope)
+	if err != nil {
+		return nil, err
+	}
+	provider := cloud.ComputeClient().ProviderClient
+	provider.HTTPClient.Transport = newContextTransport(provider.HTTPClient.Transport, osASG.runCtx)
+	if r := osASG.apiRecorder(); r != nil {
+		provider.HTTPClient.Transport = newRecordingTransport(provider.HTTPClient.Transport, r)
+	}
+	glog.V(2).Infof("Built OpenStack clients of %s\n", osASG.clusterName)
+	if c == nil {
+		c = &clients{}
+		osASG.clients = c
+	}
+	c.cloud = cloud
+	c.capabilities = probeCapabilities(cloud, osASG.opts)
+	c.cloudConfig = cluster.Spec.CloudConfig.DeepCopy()
+	c.created = time.Now()
+	c.generation = generation
+	c.scope = scope
+	return cloud, nil
+}
+
+// stores returns the keystore and secretstore of the cluster, reused while the config base
+// of the cluster stays the same
+func (osASG *openstackASG) stores(cluster *kops.Cluster) (fi.CAStore, fi.SecretStore, error) {
+	c := osASG.clients
+	if c != nil && c.keyStore != nil && c.configBase == cluster.Spec.ConfigBase {
+		return c.keyStore, c.secretStore, nil
+	}
+	keyStore, err := osASG.clientset.KeyStore(cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	secretStore, err := osASG.clientset.SecretStore(cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c == nil {
+		c = &clients{}
+		osASG.clients = c
+	}
+	c.configBase = cluster.Spec.ConfigBase
+	c.keyStore = keyStore
+	c.secretStore = secretStore
+	return keyStore, secretStore, nil
+}
+
+// resetClients drops the reused clients, so that the next execution authenticates again.
+// It is called after failed executions, as an expired or revoked token fails every request.
+func (osASG *openstackASG) resetClients() {
+	osASG.clients = nil
+}
@@ -0,0 +1,52 @@
+package autoscaler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+// expectedServerNames returns the names kops gives to the servers of the instance groups
+func expectedServerNames(clusterName string, instanceGroups []*kops.InstanceGroup) map[string]bool {
+	names := make(map[string]bool)
+	for _, ig := range instanceGroups {
+		for i := 0; i < int(fi.Int32Value(ig.Spec.MinSize)); i++ {
+			names[strings.ToLower(fmt.Sprintf("%s-%s-%d", clusterName, ig.ObjectMeta.Name, i+1))] = true
+		}
+	}
+	return names
+}
+
+// checkNameCollisions fails if servers outside the cluster have the names of the servers of the
+// cluster. Kops finds servers by name only, so it would treat them as servers of the cluster.
+func (osASG *openstackASG) checkNameCollisions(cloud openstack.OpenstackCloud) error {
+	list, err := cloud.ListInstances(servers.ListOpts{})
+	if err != nil {
+		return fmt.Errorf("error listing servers: %v", err)
+	}
+	// servers in the server groups of the cluster belong to it, even if their metadata is missing
+	members, err := serverGroupMembers(cloud, osASG.clusterName, osASG.ApplyCmd.InstanceGroups)
+	if err != nil {
+		return err
+	}
+	names := expectedServerNames(osASG.clusterName, osASG.ApplyCmd.InstanceGroups)
+	var collisions []string
+	for _, s := range list {
+		if !names[s.Name] || s.Metadata[openstack.TagClusterName] == osASG.clusterName || members[s.ID] != nil {
+			continue
+		}
+		owner := s.Metadata[openstack.TagClusterName]
+		if owner == "" {
+			owner = "no cluster"
+		}
+		collisions = append(collisions, fmt.Sprintf("%s (%s, %s)", s.Name, s.ID, owner))
+	}
+	if len(collisions) > 0 {
+		return fmt.Errorf("servers outside the cluster have the names of its servers: %s, rename or delete them", strings.Join(collisions, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package autoscaler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/kops/pkg/apis/kops"
+)
+
+// annotationPrefix is the prefix of the cluster annotations which override autoscaler settings, e.g.
+// kops-autoscaler-openstack/interval: 5m
+const annotationPrefix = "kops-autoscaler-openstack/"
+
+// Config is the content of the --config file
+type Config struct {
+	// Clusters contains the settings per cluster name
+	Clusters map[string]ClusterConfig `json:"clusters,omitempty"`
+}
+
+// ClusterConfig contains the settings which can be overridden per cluster
+type ClusterConfig struct {
+	// Interval between executions, e.g. 5m
+	Interval string `json:"interval,omitempty"`
+	// Paused clusters are not checked at all
+	Paused *bool `json:"paused,omitempty"`
+	// InstanceGroups limits the changes to these instance groups
+	InstanceGroups []string `json:"instanceGroups,omitempty"`
+	// Project is the keystone project of the cluster and ProjectDomain its domain
+	Project       string `json:"project,omitempty"`
+	ProjectDomain string `json:"projectDomain,omitempty"`
+	// IgnoreFields are the task fields ignored in change detection, e.g. Instance.Metadata.owner
+	IgnoreFields []string `json:"ignoreFields,omitempty"`
+	// Alerts map the names of Alertmanager alerts to scaling actions on the instance groups
+	Alerts map[string]AlertAction `json:"alerts,omitempty"`
+	// Metrics map the instance groups to the Prometheus queries they are sized from
+	Metrics map[string]MetricTarget `json:"metrics,omitempty"`
+}
+
+// clusterSettings are the settings in effect for a cluster
+type clusterSettings struct {
+	interval       time.Duration
+	paused         bool
+	instanceGroups map[string]bool
+	project        string
+	projectDomain  string
+	ignoreFields   map[string]bool
+}
+
+func loadConfig(path string) (*Config, error) {
+	config := &Config{}
+	if path == "" {
+		return config, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config %s: %v", path, err)
+	}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("error parsing config %s: %v", path, err)
+	}
+	for name, c := range config.Clusters {
+		if _, err := c.apply(&clusterSettings{}); err != nil {
+			return nil, fmt.Errorf("invalid config for cluster %s: %v", name, err)
+		}
+		if err := validateAlerts(c.Alerts); err != nil {
+			return nil, fmt.Errorf("invalid config for cluster %s: %v", name, err)
+		}
+		if err := validateMetricTargets(c.Metrics, c.Alerts); err != nil {
+			return nil, fmt.Errorf("invalid config for cluster %s: %v", name, err)
+		}
+	}
+	return config, nil
+}
+
+// apply overrides the settings with the values set in the config
+func (c ClusterConfig) apply(s *clusterSettings) (*clusterSettings, error) {
+	if c.Interval != "" {
+		interval, err := time.ParseDuration(c.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval %q: %v", c.Interval, err)
+		}
+		s.interval = interval
+	}
+	if c.Paused != nil {
+		s.paused = *c.Paused
+	}
+	if c.InstanceGroups != nil {
+		s.instanceGroups = make(map[string]bool)
+		for _, ig := range c.InstanceGroups {
+			s.instanceGroups[ig] = true
+		}
+	}
+	if c.Project != "" {
+		s.project = c.Project
+		s.projectDomain = c.ProjectDomain
+	} else if c.ProjectDomain != "" {
+		return nil, fmt.Errorf("projectDomain needs project")
+	}
+	if c.IgnoreFields != nil {
+		fields, err := parseIgnoreFields(c.IgnoreFields)
+		if err != nil {
+			return nil, err
+		}
+		s.ignoreFields = fields
+	}
+	return s, nil
+}
+
+// override returns the config with the values set in o replacing its own
+func (c ClusterConfig) override(o ClusterConfig) ClusterConfig {
+	if o.Interval != "" {
+		c.Interval = o.Interval
+	}
+	if o.Paused != nil {
+		c.Paused = o.Paused
+	}
+	if o.InstanceGroups != nil {
+		c.InstanceGroups = o.InstanceGroups
+	}
+	if o.Project != "" {
+		c.Project = o.Project
+		c.ProjectDomain = o.ProjectDomain
+	}
+	if o.IgnoreFields != nil {
+		c.IgnoreFields = o.IgnoreFields
+	}
+	if o.Alerts != nil {
+		c.Alerts = o.Alerts
+	}
+	if o.Metrics != nil {
+		c.Metrics = o.Metrics
+	}
+	return c
+}
+
+// annotationConfig reads the cluster config from the cluster annotations
+func annotationConfig(cluster *kops.Cluster) (ClusterConfig, error) {
+	c := ClusterConfig{}
+	annotations := cluster.ObjectMeta.Annotations
+	c.Interval = annotations[annotationPrefix+"interval"]
+	if v, ok := annotations[annotationPrefix+"paused"]; ok {
+		paused, err := strconv.ParseBool(v)
+		if err != nil {
+			return c, fmt.Errorf("invalid annotation %spaused %q", annotationPrefix, v)
+		}
+		c.Paused = &paused
+	}
+	if v, ok := annotations[annotationPrefix+"instance-groups"]; ok {
+		c.InstanceGroups = splitList(v)
+	}
+	c.Project = annotations[annotationPrefix+"project"]
+	c.ProjectDomain = annotations[annotationPrefix+"project-domain"]
+	if v, ok := annotations[annotationPrefix+"ignore-fields"]; ok {
+		c.IgnoreFields = splitList(v)
+	}
+	return c, nil
+}
+
+// resolveSettings returns the settings of the cluster. Cluster annotations override the
+// command line flags and the config file overrides both.
+func resolveSettings(opts *Options, config *Config, cluster *kops.Cluster) (*clusterSettings, error) {
+	s := &clusterSettings{
+		interval: time.Duration(opts.Sleep) * time.Second,
+	}
+	fields, err := parseIgnoreFields(splitList(opts.IgnoreFields))
+	if err != nil {
+		return nil, err
+	}
+	s.ignoreFields = fields
+	annotations, err := annotationConfig(cluster)
+	if err != nil {
+		return nil, err
+	}
+	s, err = annotations.apply(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid annotations: %v", err)
+	}
+	if c, ok := config.Clusters[cluster.ObjectMeta.Name]; ok {
+		s, err = c.apply(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// splitList splits comma separated list
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
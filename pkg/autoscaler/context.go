@@ -0,0 +1,144 @@
+package autoscaler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/client/clientset_generated/clientset/typed/kops/internalversion"
+	"k8s.io/kops/pkg/client/simple"
+)
+
+// runContext is the context of the executions. The clients are built before the executions
+// start, so they read it on every request.
+type runContext struct {
+	mu  sync.Mutex
+	ctx context.Context
+}
+
+func (c *runContext) get() context.Context {
+	if c == nil {
+		return context.Background()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+func (c *runContext) set(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ctx = ctx
+}
+
+// ctx returns the context of the current execution
+func (osASG *openstackASG) ctx() context.Context {
+	return osASG.runCtx.get()
+}
+
+// sleepContext waits for d, or until ctx is done and returns its error
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// contextTransport sends the requests with the context of the executions, so that they are
+// cancelled with it
+type contextTransport struct {
+	next http.RoundTripper
+	ctx  *runContext
+}
+
+func newContextTransport(next http.RoundTripper, ctx *runContext) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &contextTransport{
+		next: next,
+		ctx:  ctx,
+	}
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.next.RoundTrip(req.WithContext(t.ctx.get()))
+}
+
+// contextClientset fails the state store operations once the context of the executions is done.
+// The vfs clients of kops do not take a context, so operations already started are not cancelled.
+type contextClientset struct {
+	simple.Clientset
+	ctx *runContext
+}
+
+func (c *contextClientset) GetCluster(name string) (*kops.Cluster, error) {
+	if err := c.ctx.get().Err(); err != nil {
+		return nil, err
+	}
+	return c.Clientset.GetCluster(name)
+}
+
+func (c *contextClientset) ListClusters(options v1.ListOptions) (*kops.ClusterList, error) {
+	if err := c.ctx.get().Err(); err != nil {
+		return nil, err
+	}
+	return c.Clientset.ListClusters(options)
+}
+
+func (c *contextClientset) InstanceGroupsFor(cluster *kops.Cluster) internalversion.InstanceGroupInterface {
+	return &contextInstanceGroups{
+		InstanceGroupInterface: c.Clientset.InstanceGroupsFor(cluster),
+		ctx:                    c.ctx,
+	}
+}
+
+type contextInstanceGroups struct {
+	internalversion.InstanceGroupInterface
+	ctx *runContext
+}
+
+func (c *contextInstanceGroups) Get(name string, options v1.GetOptions) (*kops.InstanceGroup, error) {
+	if err := c.ctx.get().Err(); err != nil {
+		return nil, err
+	}
+	return c.InstanceGroupInterface.Get(name, options)
+}
+
+func (c *contextInstanceGroups) List(options v1.ListOptions) (*kops.InstanceGroupList, error) {
+	if err := c.ctx.get().Err(); err != nil {
+		return nil, err
+	}
+	return c.InstanceGroupInterface.List(options)
+}
+
+func (c *contextInstanceGroups) Create(ig *kops.InstanceGroup) (*kops.InstanceGroup, error) {
+	if err := c.ctx.get().Err(); err != nil {
+		return nil, err
+	}
+	return c.InstanceGroupInterface.Create(ig)
+}
+
+func (c *contextInstanceGroups) Update(ig *kops.InstanceGroup) (*kops.InstanceGroup, error) {
+	if err := c.ctx.get().Err(); err != nil {
+		return nil, err
+	}
+	return c.InstanceGroupInterface.Update(ig)
+}
+
+func (c *contextInstanceGroups) Delete(name string, options *v1.DeleteOptions) error {
+	if err := c.ctx.get().Err(); err != nil {
+		return err
+	}
+	return c.InstanceGroupInterface.Delete(name, options)
+}
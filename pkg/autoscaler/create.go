@@ -0,0 +1,160 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+// createRetryBase is the wait before the first retry of a rejected server create request,
+// doubled on every retry
+const createRetryBase = 5 * time.Second
+
+// deleteTimeout is how long the deletion of a server which did not become ACTIVE is waited for
+const deleteTimeout = 2 * time.Minute
+
+// instanceCloud extends the server create requests of the embedded kops: servers of boot from
+// volume instance groups get a Cinder root volume and the extra user data parts are appended.
+// Kops runs the instance tasks concurrently, creates holds the requests in flight to its size.
+// The ports of instance groups in provider networks are created in their provider network.
+type instanceCloud struct {
+	openstack.OpenstackCloud
+	clusterName      string
+	instanceGroups   []*kops.InstanceGroup
+	userData         []userDataPart
+	creates          chan struct{}
+	createRetries    int
+	activeTimeout    time.Duration
+	providerNetworks map[string]*providerNetwork
+	spreadSubnets    bool
+	// zones are the availability zones of the new servers projected by the capacity check
+	zones map[string]string
+	// subnetIDs are the IDs of the cluster subnets by name, guarded by subnetsMu
+	subnetsMu sync.Mutex
+	subnetIDs map[string]string
+	// quotaError is the latest error of a create rejected by quota, guarded by quotaMu
+	quotaMu    sync.Mutex
+	quotaError string
+	// ctx is the context of the execution, the waits end when it is done
+	ctx context.Context
+}
+
+func newInstanceCloud(cloud openstack.OpenstackCloud, clusterName string, instanceGroups []*kops.InstanceGroup, userData []userDataPart, providerNetworks map[string]*providerNetwork, opts *Options) *instanceCloud {
+	c := &instanceCloud{
+		OpenstackCloud:   cloud,
+		clusterName:      clusterName,
+		instanceGroups:   instanceGroups,
+		userData:         userData,
+		createRetries:    opts.CreateRetries,
+		activeTimeout:    opts.ServerActiveTimeout,
+		providerNetworks: providerNetworks,
+		spreadSubnets:    opts.SpreadSubnets,
+		ctx:              context.Background(),
+	}
+	if opts.CreateConcurrency > 0 {
+		c.creates = make(chan struct{}, opts.CreateConcurrency)
+	}
+	return c
+}
+
+func (c *instanceCloud) CreateInstance(opt servers.CreateOptsBuilder) (*servers.Server, error) {
+	m, err := opt.ToServerCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	server, _ := m["server"].(map[string]interface{})
+	name, _ := server["name"].(string)
+	group := instanceGroupOf(c.clusterName, c.instanceGroups, name)
+	for _, ig := range c.instanceGroups {
+		if ig.ObjectMeta.Name != group {
+			continue
+		}
+		volume, err := rootVolumeFor(ig)
+		if err != nil {
+			return nil, err
+		}
+		if volume != nil {
+			opt = &volumeBootOpts{CreateOptsBuilder: opt, volume: volume}
+		}
+	}
+	if len(c.userData) > 0 {
+		opt = &userDataOpts{CreateOptsBuilder: opt, parts: c.userData}
+	}
+	if zone := c.zones[name]; zone != "" {
+		opt = &zoneOpts{CreateOptsBuilder: opt, zone: zone}
+	}
+
+	created, err := c.create(name, opt)
+	if err != nil {
+		c.checkQuota(err)
+		return nil, err
+	}
+	// kops waits only 120 seconds for the server to become ACTIVE before attaching a floating IP
+	if err := waitActive(c.ctx, c.ComputeClient(), name, created.ID, c.activeTimeout); err != nil {
+		glog.Warningf("Deleting server %s: %v", name, err)
+		if err := c.deleteInactive(created.ID); err != nil {
+			glog.Errorf("Error deleting server %s: %v", name, err)
+		}
+		return nil, err
+	}
+	return created, nil
+}
+
+// create sends the create request, retrying it while it is rejected. The request is sent with the
+// compute client instead of kops, which wraps the error and loses the status code.
+func (c *instanceCloud) create(name string, opt servers.CreateOptsBuilder) (*servers.Server, error) {
+	if c.creates != nil {
+		c.creates <- struct{}{}
+		defer func() { <-c.creates }()
+	}
+	for retry := 0; ; retry++ {
+		created, err := servers.Create(c.ComputeClient(), opt).Extract()
+		if err == nil {
+			return created, nil
+		}
+		if retry >= c.createRetries || !rejectedCreate(err) {
+			return nil, fmt.Errorf("error creating server %s: %v", name, err)
+		}
+		wait := createRetryBase << uint(retry)
+		glog.Warningf("Server %s was not created, retrying in %v: %v", name, wait, err)
+		if err := sleepContext(c.ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// deleteInactive deletes the server and waits until it is gone, so that the next attempt of the
+// instance task does not find it by name. The port is kept for the next attempt.
+func (c *instanceCloud) deleteInactive(id string) error {
+	if err := c.DeleteInstanceWithID(id); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(deleteTimeout)
+	for time.Now().Before(deadline) {
+		_, err := servers.Get(c.ComputeClient(), id).Extract()
+		if _, ok := err.(gophercloud.ErrDefault404); ok {
+			return nil
+		}
+		if err := sleepContext(c.ctx, 5*time.Second); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("server %s was not deleted in %v", id, deleteTimeout)
+}
+
+// rejectedCreate returns true if the create request was rejected before the server was created, so
+// that retrying can not create a duplicate server
+func rejectedCreate(err error) bool {
+	switch err.(type) {
+	case gophercloud.ErrDefault429, gophercloud.ErrDefault503:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// credentialsPollInterval is how often the credential secrets are checked for rotation
+const credentialsPollInterval = time.Minute
+
+// credentialKey matches the secret keys exported as environment variables, e.g. S3_ACCESS_KEY_ID or OS_PASSWORD
+var credentialKey = regexp.MustCompile(`^(S3|OS)_[A-Z0-9_]+$`)
+
+// credentialsGeneration is increased when OpenStack credentials are rotated, the OpenStack
+// clients built with older credentials are not reused
+var credentialsGeneration int64
+
+// credentialSecrets reads S3 and OpenStack credentials from kubernetes secrets
+type credentialSecrets struct {
+	kubeClient kubernetes.Interface
+	refs       []string
+	stateStore string
+	// versions are the resource versions of the secrets last read
+	versions map[string]string
+}
+
+// loadCredentialSecrets reads the secrets given as comma separated namespace/name list and sets
+// their S3_ and OS_ keys as environment variables
+func loadCredentialSecrets(opts *Options, kubeClient kubernetes.Interface) (*credentialSecrets, error) {
+	c := &credentialSecrets{
+		kubeClient: kubeClient,
+		refs:       splitList(opts.CredentialsSecrets),
+		stateStore: opts.StateStore,
+		versions:   make(map[string]string),
+	}
+	for _, ref := range c.refs {
+		if _, err := c.load(ref); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// load sets the credentials of the secret, if it has changed since it was last read, and returns
+// the names of the changed variables
+func (c *credentialSecrets) load(ref string) ([]string, error) {
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid credentials secret %q, must be namespace/name", ref)
+	}
+	secret, err := c.kubeClient.CoreV1().Secrets(parts[0]).Get(parts[1], metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error reading credentials secret %s: %v", ref, err)
+	}
+	if c.versions[ref] == secret.ResourceVersion {
+		return nil, nil
+	}
+	c.versions[ref] = secret.ResourceVersion
+
+	values := make(map[string]string)
+	for key, value := range secret.Data {
+		values[key] = string(value)
+	}
+	return setCredentials(values)
+}
+
+// setCredentials sets the S3_ and OS_ values as environment variables and returns the names of
+// the changed variables
+func setCredentials(values map[string]string) ([]string, error) {
+	authEnvMu.Lock()
+	defer authEnvMu.Unlock()
+	var changed []string
+	for key, value := range values {
+		if !credentialKey.MatchString(key) {
+			continue
+		}
+		v := strings.TrimSpace(value)
+		if isSecretEnv(key) {
+			registerSecret(v)
+		}
+		if os.Getenv(key) == v {
+			continue
+		}
+		if err := os.Setenv(key, v); err != nil {
+			return nil, err
+		}
+		changed = append(changed, key)
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// watch polls the secrets for rotation until ctx is done
+func (c *credentialSecrets) watch(ctx context.Context) {
+	for {
+		if sleepContext(ctx, credentialsPollInterval) != nil {
+			return
+		}
+		for _, ref := range c.refs {
+			changed, err := c.load(ref)
+			if err != nil {
+				glog.Errorf("Error checking credentials %v", err)
+				continue
+			}
+			if len(changed) == 0 {
+				continue
+			}
+			glog.Infof("Credentials rotated in secret %s: %s\n", ref, strings.Join(changed, ", "))
+			credentialsRotated(c.stateStore, changed)
+		}
+	}
+}
+
+// credentialsRotated makes the next OpenStack clients use the changed credentials. The kops
+// state store clients can not be rebuilt, so the autoscaler exits to be restarted when the
+// credentials of the state store have changed.
+func credentialsRotated(stateStore string, changed []string) {
+	swift := strings.HasPrefix(stateStore, "swift://")
+	for _, key := range changed {
+		if strings.HasPrefix(key, "S3_") || (swift && strings.HasPrefix(key, "OS_")) {
+			glog.Infof("State store credentials rotated, exiting to restart\n")
+			glog.Flush()
+			os.Exit(0)
+		}
+	}
+	atomic.AddInt64(&credentialsGeneration, 1)
+}
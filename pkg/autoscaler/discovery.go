@@ -0,0 +1,30 @@
+package autoscaler
+
+import (
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/client/simple"
+)
+
+// discoverClusters returns the names of the openstack clusters in the state store matching the selector
+func discoverClusters(clientset simple.Clientset, selector labels.Selector) ([]string, error) {
+	list, err := clientset.ListClusters(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, cluster := range list.Items {
+		if kops.CloudProviderID(cluster.Spec.CloudProvider) != kops.CloudProviderOpenstack {
+			continue
+		}
+		if !selector.Matches(labels.Set(cluster.ObjectMeta.Labels)) {
+			continue
+		}
+		names = append(names, cluster.ObjectMeta.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
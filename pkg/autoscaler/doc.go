@@ -0,0 +1,20 @@
+// Package autoscaler keeps the servers of kops clusters on OpenStack in line with their instance
+// groups. The command line in pkg/cmd is a thin wrapper around it, and other programs can embed the
+// reconcile engine:
+//
+//	r, err := autoscaler.New(opts)
+//	if err != nil {
+//		return err
+//	}
+//	results, err := r.RunOnce(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	for _, result := range results {
+//		if result.Failed() {
+//			log.Printf("%s: %s", result.Cluster, result.Error)
+//		}
+//	}
+//
+// Reconciler.Run executes the clusters at their intervals instead, until the context is done.
+package autoscaler
@@ -0,0 +1,156 @@
+package autoscaler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// scaleDownAnnotation is set on the nodes cordoned in --cordon-only mode, the value is the time of cordoning
+const scaleDownAnnotation = annotationPrefix + "scale-down"
+
+// cordon marks the node unschedulable
+func (osASG *openstackASG) cordon(name string) (*v1.Node, error) {
+	node, err := osASG.kubeClient.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if node.Spec.Unschedulable {
+		return node, nil
+	}
+	node.Spec.Unschedulable = true
+	return osASG.kubeClient.CoreV1().Nodes().Update(node)
+}
+
+// cordonAndAnnotate cordons the node and marks it to be removed, leaving the drain and the
+// deletion of the server to someone else
+func (osASG *openstackASG) cordonAndAnnotate(name string) error {
+	node, err := osASG.cordon(name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			glog.Infof("Node %s not found, nothing to cordon\n", name)
+			return nil
+		}
+		return fmt.Errorf("error cordoning node %s: %v", name, err)
+	}
+	if _, ok := node.ObjectMeta.Annotations[scaleDownAnnotation]; ok {
+		return nil
+	}
+	if node.ObjectMeta.Annotations == nil {
+		node.ObjectMeta.Annotations = make(map[string]string)
+	}
+	node.ObjectMeta.Annotations[scaleDownAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	if _, err := osASG.kubeClient.CoreV1().Nodes().Update(node); err != nil {
+		return fmt.Errorf("error annotating node %s: %v", name, err)
+	}
+	glog.Infof("Cordoned node %s, it can be removed\n", name)
+	return nil
+}
+
+// markedForScaleDown returns true if the node has already been cordoned and annotated for removal
+func (osASG *openstackASG) markedForScaleDown(name string) (bool, error) {
+	node, err := osASG.kubeClient.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_, ok := node.ObjectMeta.Annotations[scaleDownAnnotation]
+	return ok && node.Spec.Unschedulable, nil
+}
+
+// drain cordons the node and evicts its pods. Pods which have not terminated in --drain-timeout
+// are deleted without grace period if --drain-force is set.
+func (osASG *openstackASG) drain(name string) error {
+	if _, err := osASG.cordon(name); err != nil {
+		if errors.IsNotFound(err) {
+			glog.Infof("Node %s not found, nothing to drain\n", name)
+			return nil
+		}
+		return fmt.Errorf("error cordoning node %s: %v", name, err)
+	}
+
+	var gracePeriod *int64
+	if osASG.opts.DrainGracePeriod >= 0 {
+		seconds := int64(osASG.opts.DrainGracePeriod)
+		gracePeriod = &seconds
+	}
+
+	glog.Infof("Draining node %s\n", name)
+	deadline := time.Now().Add(osASG.opts.DrainTimeout)
+	for {
+		pods, err := osASG.podsToEvict(name)
+		if err != nil {
+			return err
+		}
+		if len(pods) == 0 {
+			glog.Infof("Node %s drained\n", name)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		for _, pod := range pods {
+			if pod.ObjectMeta.DeletionTimestamp != nil {
+				continue
+			}
+			err := osASG.kubeClient.CoreV1().Pods(pod.Namespace).Evict(&policy.Eviction{
+				ObjectMeta:    metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+				DeleteOptions: &metav1.DeleteOptions{GracePeriodSeconds: gracePeriod},
+			})
+			// TooManyRequests means that a disruption budget does not allow the eviction yet
+			if err != nil && !errors.IsNotFound(err) && !errors.IsTooManyRequests(err) {
+				return fmt.Errorf("error evicting pod %s/%s: %v", pod.Namespace, pod.Name, err)
+			}
+		}
+		if err := sleepContext(osASG.ctx(), 5*time.Second); err != nil {
+			return err
+		}
+	}
+
+	pods, err := osASG.podsToEvict(name)
+	if err != nil {
+		return err
+	}
+	if !osASG.opts.DrainForce {
+		return fmt.Errorf("node %s still has %d pods after %v", name, len(pods), osASG.opts.DrainTimeout)
+	}
+	var zero int64
+	for _, pod := range pods {
+		glog.Warningf("Force deleting pod %s/%s from node %s", pod.Namespace, pod.Name, name)
+		err := osASG.kubeClient.CoreV1().Pods(pod.Namespace).Delete(pod.Name, &metav1.DeleteOptions{GracePeriodSeconds: &zero})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("error deleting pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+	}
+	return nil
+}
+
+// podsToEvict returns the pods of the node, except mirror and daemonset pods which would not
+// be rescheduled elsewhere
+func (osASG *openstackASG) podsToEvict(name string) ([]v1.Pod, error) {
+	list, err := osASG.kubeClient.CoreV1().Pods("").List(metav1.ListOptions{FieldSelector: "spec.nodeName=" + name})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods of node %s: %v", name, err)
+	}
+	var pods []v1.Pod
+	for _, pod := range list.Items {
+		if _, ok := pod.ObjectMeta.Annotations[v1.MirrorPodAnnotationKey]; ok {
+			continue
+		}
+		if owner := metav1.GetControllerOf(&pod); owner != nil && owner.Kind == "DaemonSet" {
+			continue
+		}
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
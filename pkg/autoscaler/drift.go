@@ -0,0 +1,73 @@
+package autoscaler
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var unremediatedDrift = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "kops_autoscaler",
+	Name:      "unremediated_drift_changes",
+	Help:      "Number of changes found in the dry-run which the autoscaler is configured not to apply.",
+}, []string{"cluster", "kind"})
+
+var appliedChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "kops_autoscaler",
+	Name:      "applied_changes_total",
+	Help:      "Number of changes in the applied plans.",
+}, []string{"cluster", "kind"})
+
+func init() {
+	prometheus.MustRegister(unremediatedDrift)
+	prometheus.MustRegister(appliedChanges)
+}
+
+// unremediated returns the changes of the plan which will not be applied: changes ignored by
+// configuration and infrastructure changes when --manage-infrastructure is not set
+func (osASG *openstackASG) unremediated(plan *Plan) []Change {
+	drift := append([]Change{}, plan.ignored...)
+	if !osASG.opts.ManageInfrastructure {
+		for _, c := range plan.Changes {
+			if !instanceScope[c.Type] {
+				drift = append(drift, c)
+			}
+		}
+	}
+	return drift
+}
+
+// reportDrift updates the drift metric and notifies once about each new set of changes
+// which are detected but not remediated
+func (osASG *openstackASG) reportDrift(plan *Plan) {
+	drift := osASG.unremediated(plan)
+	counts := make(map[string]int)
+	for _, c := range drift {
+		counts[c.Kind]++
+	}
+	for _, kind := range changeKinds {
+		unremediatedDrift.WithLabelValues(osASG.clusterName, kind).Set(float64(counts[kind]))
+	}
+	if len(drift) == 0 {
+		osASG.driftID = ""
+		return
+	}
+	id := newPlan(osASG.clusterName, drift).ID
+	if id == osASG.driftID {
+		return
+	}
+	osASG.driftID = id
+	osASG.notifier.event(eventDriftDetected, osASG.clusterName, &eventData{
+		PlanID:  id,
+		Kinds:   kinds(drift),
+		Changes: drift,
+	})
+	osASG.notifier.notify(osASG.clusterName, "DriftNotRemediated", fmt.Sprintf("drift detected but not remediated: %s", osASG.summary(drift)), drift...)
+}
+
+// countApplied counts the changes of the applied plan by kind
+func (osASG *openstackASG) countApplied(plan *Plan) {
+	for _, c := range plan.Changes {
+		appliedChanges.WithLabelValues(osASG.clusterName, c.Kind).Inc()
+	}
+}
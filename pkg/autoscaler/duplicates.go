@@ -0,0 +1,160 @@
+package autoscaler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/floatingips"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+// duplicateServers returns the servers of the cluster by name for the expected server names
+// which have more than one server. Kops fails to find the instance of such names.
+func (osASG *openstackASG) duplicateServers(list []servers.Server) map[string][]servers.Server {
+	names := expectedServerNames(osASG.clusterName, osASG.ApplyCmd.InstanceGroups)
+	byName := make(map[string][]servers.Server)
+	for _, s := range list {
+		if names[s.Name] {
+			byName[s.Name] = append(byName[s.Name], s)
+		}
+	}
+	for name, l := range byName {
+		if len(l) < 2 {
+			delete(byName, name)
+		}
+	}
+	return byName
+}
+
+// resolveDuplicates fails if the cluster has several servers with the same name. With
+// --resolve-duplicates the server registered as the Ready node of the name is kept and the
+// others are deleted.
+func (osASG *openstackASG) resolveDuplicates(cloud openstack.OpenstackCloud) error {
+	list, err := clusterServers(cloud, osASG.clusterName)
+	if err != nil {
+		return err
+	}
+	duplicates := osASG.duplicateServers(list)
+	if len(duplicates) == 0 {
+		return nil
+	}
+	var names []string
+	for name := range duplicates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if !osASG.opts.ResolveDuplicates || osASG.delayed() != "" {
+		var descriptions []string
+		for _, name := range names {
+			descriptions = append(descriptions, fmt.Sprintf("%s (%s)", name, strings.Join(serverIDs(duplicates[name]), ", ")))
+		}
+		err := fmt.Errorf("several servers have the same name: %s", strings.Join(descriptions, ", "))
+		osASG.notifier.notify(osASG.clusterName, "DuplicateServers", err.Error())
+		return err
+	}
+
+	roles := make(map[string]kops.InstanceGroupRole)
+	for _, ig := range osASG.ApplyCmd.InstanceGroups {
+		roles[ig.ObjectMeta.Name] = ig.Spec.Role
+	}
+	foreign := osASG.foreignServers(list)
+	for _, name := range names {
+		if roles[osASG.instanceGroupFor(name)] == kops.InstanceGroupRoleMaster {
+			return fmt.Errorf("several servers have the master name %s, not resolving duplicate masters", name)
+		}
+		if key := foreign[name]; key != "" {
+			return fmt.Errorf("several servers have the name %s, not resolving servers with metadata %s", name, key)
+		}
+		keep, err := osASG.registeredServer(name, duplicates[name])
+		if err != nil {
+			return err
+		}
+		for _, s := range duplicates[name] {
+			if s.ID == keep.ID {
+				continue
+			}
+			if err := deleteDuplicate(cloud, s, osASG.opts.gc()); err != nil {
+				return err
+			}
+		}
+		osASG.notifier.notify(osASG.clusterName, "DuplicateServersResolved",
+			fmt.Sprintf("kept server %s (%s), deleted %d servers with the same name", name, keep.ID, len(duplicates[name])-1))
+	}
+	return nil
+}
+
+// registeredServer returns the server which is ACTIVE and registered as the Ready node of the name
+func (osASG *openstackASG) registeredServer(name string, list []servers.Server) (*servers.Server, error) {
+	node, err := osASG.kubeClient.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, fmt.Errorf("several servers have the name %s and none of them is registered as node, not resolving", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading node %s: %v", name, err)
+	}
+	if !nodeReady(node) {
+		return nil, fmt.Errorf("several servers have the name %s and node %s is not Ready, not resolving", name, name)
+	}
+	for i := range list {
+		s := &list[i]
+		if strings.HasSuffix(node.Spec.ProviderID, "/"+s.ID) {
+			if s.Status != "ACTIVE" {
+				return nil, fmt.Errorf("server %s (%s) of node %s is %s, not resolving", name, s.ID, name, s.Status)
+			}
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("several servers have the name %s and node provider ID %q matches none of them, not resolving", name, node.Spec.ProviderID)
+}
+
+// deleteDuplicate deletes the server with its ports and the floating IPs selected by gc. The ports
+// are found by device, because the duplicates have the same port names as the server which is kept.
+// They are deleted even with --skip-gc, as kops can not find the ports of the kept server otherwise.
+func deleteDuplicate(cloud openstack.OpenstackCloud, s servers.Server, gc gcScope) error {
+	var fips []floatingips.FloatingIP
+	if gc.floatingIPs {
+		var err error
+		fips, err = cloud.ListFloatingIPs()
+		if err != nil {
+			return fmt.Errorf("error listing floating IPs: %v", err)
+		}
+	}
+	list, err := cloud.ListPorts(ports.ListOpts{DeviceID: s.ID})
+	if err != nil {
+		return fmt.Errorf("error listing ports of %s (%s): %v", s.Name, s.ID, err)
+	}
+
+	glog.Infof("Deleting duplicate server %s (%s)\n", s.Name, s.ID)
+	if err := cloud.DeleteInstanceWithID(s.ID); err != nil {
+		return fmt.Errorf("error deleting server %s (%s): %v", s.Name, s.ID, err)
+	}
+	for _, fip := range fips {
+		if fip.InstanceID == s.ID {
+			if err := cloud.DeleteFloatingIP(fip.ID); err != nil {
+				return fmt.Errorf("error deleting floating IP %s of %s (%s): %v", fip.IP, s.Name, s.ID, err)
+			}
+		}
+	}
+	for _, port := range list {
+		if err := cloud.DeletePort(port.ID); err != nil {
+			return fmt.Errorf("error deleting port %s: %v", port.Name, err)
+		}
+	}
+	return nil
+}
+
+func serverIDs(list []servers.Server) []string {
+	var ids []string
+	for _, s := range list {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
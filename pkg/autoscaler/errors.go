@@ -0,0 +1,110 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstacktasks"
+)
+
+// causer is implemented by the errors wrapping another error, the errors of the autoscaler and of
+// github.com/pkg/errors
+type causer interface {
+	Cause() error
+}
+
+// cause returns the error wrapped by err, or nil
+func cause(err error) error {
+	if c, ok := err.(causer); ok {
+		return c.Cause()
+	}
+	return nil
+}
+
+// ErrStateStoreUnavailable is returned when the cluster, its instance groups or the pending plan
+// can not be read from or written to the state store
+type ErrStateStoreUnavailable struct {
+	Err error
+}
+
+func (e *ErrStateStoreUnavailable) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ErrStateStoreUnavailable) Cause() error {
+	return e.Err
+}
+
+// ErrQuotaExceeded is returned when OpenStack rejected a create of the apply because of the
+// project quota. Message is the rejection.
+type ErrQuotaExceeded struct {
+	Message string
+	Err     error
+}
+
+func (e *ErrQuotaExceeded) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ErrQuotaExceeded) Cause() error {
+	return e.Err
+}
+
+// ErrApplyFailed is returned when the apply of a plan failed. Tasks are the keys of the changes
+// which were not applied, e.g. Instance/nodes-1-example-k8s-local. Err is the error of the apply,
+// which may be an ErrQuotaExceeded.
+type ErrApplyFailed struct {
+	PlanID string
+	Tasks  []string
+	Err    error
+	// message describes the failure, including the instances created before it
+	message string
+}
+
+func (e *ErrApplyFailed) Error() string {
+	if e.message != "" {
+		return e.message
+	}
+	return fmt.Sprintf("error applying %s: %v", strings.Join(e.Tasks, ", "), e.Err)
+}
+
+func (e *ErrApplyFailed) Cause() error {
+	return e.Err
+}
+
+// failedTasks returns the keys of the changes of the plan, except the instances created before
+// the apply failed
+func failedTasks(plan *Plan) []string {
+	var tasks []string
+	for _, c := range plan.Changes {
+		if i, ok := c.task.(*openstacktasks.Instance); ok && c.Action == actionCreate && i.ID != nil {
+			continue
+		}
+		tasks = append(tasks, c.Key)
+	}
+	return tasks
+}
+
+// errorClass classifies the error of an execution for the metrics
+func errorClass(err error) string {
+	for ; err != nil; err = cause(err) {
+		switch e := err.(type) {
+		case *unsupportedSpecError:
+			return "unsupported_spec"
+		case *ErrStateStoreUnavailable:
+			return "state_store_unavailable"
+		case *ErrQuotaExceeded:
+			return "quota_exceeded"
+		case *ErrApplyFailed:
+			if quotaExceeded(e.Err) {
+				return "quota_exceeded"
+			}
+			return "apply_failed"
+		}
+		if err == context.Canceled || err == context.DeadlineExceeded {
+			return "cancelled"
+		}
+	}
+	return "other"
+}
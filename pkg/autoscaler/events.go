@@ -0,0 +1,125 @@
+package autoscaler
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// eventTypePrefix is the prefix of the CloudEvents types, in reverse DNS notation
+const eventTypePrefix = "io.github.zetaab.kops-autoscaler-openstack."
+
+// types of the CloudEvents sent to --cloudevents-sink
+const (
+	eventPlanApplied     = eventTypePrefix + "plan.applied"
+	eventApplyFailed     = eventTypePrefix + "apply.failed"
+	eventReconcileFailed = eventTypePrefix + "reconcile.failed"
+	eventAlert           = eventTypePrefix + "alert"
+	eventDriftDetected   = eventTypePrefix + "drift.detected"
+)
+
+var cloudEventsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "kops_autoscaler",
+	Name:      "cloudevents_sent_total",
+	Help:      "CloudEvents sent to the sink by type and result, ok or error.",
+}, []string{"type", "result"})
+
+func init() {
+	prometheus.MustRegister(cloudEventsSent)
+}
+
+// cloudEvent is a CloudEvents 1.0 event in the structured JSON format
+type cloudEvent struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Subject         string      `json:"subject,omitempty"`
+	Time            time.Time   `json:"time"`
+	DataContentType string      `json:"datacontenttype"`
+	Data            interface{} `json:"data"`
+}
+
+// eventData is the data of the events. Subject of the events is the cluster name.
+type eventData struct {
+	Cluster string   `json:"cluster"`
+	PlanID  string   `json:"planID,omitempty"`
+	Kinds   []string `json:"kinds,omitempty"`
+	Changes []Change `json:"changes,omitempty"`
+	// Reason and Message are set in alerts
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// eventSink posts CloudEvents to an HTTP sink, e.g. a Knative broker
+type eventSink struct {
+	url    string
+	client *http.Client
+}
+
+// newEventSink returns the sink of the url, or nil if url is empty
+func newEventSink(url string) *eventSink {
+	if url == "" {
+		return nil
+	}
+	return &eventSink{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// send posts the encoded event of the cluster to the sink. Errors are only logged.
+func (s *eventSink) send(eventType string, cluster string, payload []byte) {
+	if s == nil {
+		return
+	}
+	resp, err := s.client.Post(s.url, "application/cloudevents+json; charset=utf-8", bytes.NewReader(payload))
+	if err != nil {
+		cloudEventsSent.WithLabelValues(eventType, "error").Inc()
+		glog.Errorf("Error sending event %s of %s: %v", eventType, cluster, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		cloudEventsSent.WithLabelValues(eventType, "error").Inc()
+		glog.Errorf("Error sending event %s of %s, sink returned %s", eventType, cluster, resp.Status)
+		return
+	}
+	cloudEventsSent.WithLabelValues(eventType, "ok").Inc()
+}
+
+// event sends the event of the cluster to --cloudevents-sink and --event-bus, if configured
+func (n *notifier) event(eventType string, cluster string, data *eventData) {
+	if n == nil || (n.events == nil && n.bus == nil) {
+		return
+	}
+	data.Cluster = cluster
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		glog.Errorf("Error generating event id %v", err)
+		return
+	}
+	payload, err := json.Marshal(cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              hex.EncodeToString(id),
+		Source:          n.source,
+		Type:            eventType,
+		Subject:         cluster,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            data,
+	})
+	if err != nil {
+		glog.Errorf("Error encoding event %v", err)
+		return
+	}
+	n.events.send(eventType, cluster, payload)
+	n.bus.publish(eventType, cluster, payload)
+}
@@ -0,0 +1,157 @@
+package autoscaler
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+// endpointProbeTimeout is how long an endpoint may take to answer before it is considered unreachable
+const endpointProbeTimeout = 10 * time.Second
+
+var endpointFailovers = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "kops_autoscaler",
+	Name:      "openstack_endpoint_failovers_total",
+	Help:      "Number of times the OpenStack clients were built with a fallback endpoint because the primary one was unreachable.",
+}, []string{"service"})
+
+func init() {
+	prometheus.MustRegister(endpointFailovers)
+}
+
+// endpointInterfaces are the interfaces of the service catalog which can be used as fallbacks
+var endpointInterfaces = map[string]bool{
+	string(gophercloud.AvailabilityPublic):   true,
+	string(gophercloud.AvailabilityInternal): true,
+	string(gophercloud.AvailabilityAdmin):    true,
+}
+
+// validateEndpointFallbacks checks the interfaces given in --os-endpoint-fallbacks
+func validateEndpointFallbacks(fallbacks string) error {
+	for _, i := range splitList(fallbacks) {
+		if !endpointInterfaces[i] {
+			return fmt.Errorf("unknown endpoint interface %q, must be public, internal or admin", i)
+		}
+	}
+	return nil
+}
+
+// identityEndpoint returns the keystone URL to authenticate to. It is empty while the URL of
+// the credentials is reachable, otherwise it is the first reachable fallback. If none is
+// reachable, the URL of the credentials is used and building the cloud fails with its error.
+func identityEndpoint(opts *Options, scope keystoneScope) (string, error) {
+	fallbacks := splitList(opts.AuthURLFallbacks)
+	if len(fallbacks) == 0 {
+		return "", nil
+	}
+	creds, err := scope.credentials()
+	if err != nil {
+		return "", err
+	}
+	primaryErr := probeEndpoint(nil, creds.IdentityEndpoint)
+	if primaryErr == nil {
+		return "", nil
+	}
+	for _, fallback := range fallbacks {
+		if err := probeEndpoint(nil, fallback); err != nil {
+			glog.Warningf("Fallback keystone %s is unreachable: %v", fallback, err)
+			continue
+		}
+		glog.Warningf("Keystone %s is unreachable, failing over to %s: %v", creds.IdentityEndpoint, fallback, primaryErr)
+		endpointFailovers.WithLabelValues("identity").Inc()
+		return fallback, nil
+	}
+	return "", nil
+}
+
+// failoverEndpoints points the compute, network, volume and load balancer clients of the cloud to another
+// interface of the service catalog when their endpoint is unreachable. The region is kept:
+// the servers of the cluster are only in the region of the cluster.
+func failoverEndpoints(cloud openstack.OpenstackCloud, fallbacks []string) {
+	if len(fallbacks) == 0 {
+		return
+	}
+	for _, client := range []*gophercloud.ServiceClient{cloud.ComputeClient(), cloud.NetworkingClient(), cloud.BlockStorageClient(), cloud.LoadBalancerClient()} {
+		if client == nil {
+			continue
+		}
+		transport := client.ProviderClient.HTTPClient.Transport
+		primaryErr := probeEndpoint(transport, client.Endpoint)
+		if primaryErr == nil {
+			continue
+		}
+		// the network and load balancer clients add the API version to the endpoint
+		suffix := ""
+		if client.ResourceBase != "" {
+			suffix = strings.TrimPrefix(client.ResourceBase, client.Endpoint)
+		}
+		for _, i := range fallbacks {
+			endpoint, err := client.ProviderClient.EndpointLocator(gophercloud.EndpointOpts{
+				Type:         client.Type,
+				Region:       cloud.Region(),
+				Availability: gophercloud.Availability(i),
+			})
+			if err != nil {
+				glog.V(2).Infof("No %s endpoint of %s: %v\n", i, client.Type, err)
+				continue
+			}
+			if endpoint == client.Endpoint {
+				continue
+			}
+			if err := probeEndpoint(transport, endpoint); err != nil {
+				glog.Warningf("Fallback %s endpoint %s is unreachable: %v", client.Type, endpoint, err)
+				continue
+			}
+			glog.Warningf("%s endpoint %s is unreachable, failing over to %s endpoint %s: %v", client.Type, client.Endpoint, i, endpoint, primaryErr)
+			endpointFailovers.WithLabelValues(client.Type).Inc()
+			client.Endpoint = endpoint
+			if suffix != "" {
+				client.ResourceBase = endpoint + suffix
+			}
+			break
+		}
+	}
+}
+
+// probeEndpoint returns an error if the endpoint can not be connected to or answers with a
+// server error, e.g. from a load balancer without backends. Other answers, like the 401 of
+// an unauthenticated request, mean the endpoint is reachable.
+func probeEndpoint(transport http.RoundTripper, endpoint string) error {
+	client := &http.Client{Transport: transport, Timeout: endpointProbeTimeout}
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		if unreachable(err) {
+			return err
+		}
+		return nil
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("%s answered %s", endpoint, resp.Status)
+	}
+	return nil
+}
+
+// unreachable returns true for the errors of connecting to a host, like refused connections,
+// timeouts and unknown hosts. TLS and protocol errors do not go away by failing over.
+func unreachable(err error) bool {
+	if e, ok := err.(*url.Error); ok {
+		if e.Timeout() {
+			return true
+		}
+		err = e.Err
+	}
+	_, ok := err.(*net.OpError)
+	return ok
+}
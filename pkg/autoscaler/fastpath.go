@@ -0,0 +1,108 @@
+package autoscaler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+// sizeDiscrepancies compares the number of servers in each instance group against the
+// instance group minSize, which is the number of servers kops creates on OpenStack. The
+// differences are described by instance group name.
+func (osASG *openstackASG) sizeDiscrepancies() (map[string]string, error) {
+	cloud, err := osASG.openstackCloud()
+	if err != nil {
+		return nil, err
+	}
+	counts, err := serverCounts(cloud, osASG.ApplyCmd.Cluster, osASG.ApplyCmd.InstanceGroups)
+	if err != nil {
+		return nil, err
+	}
+	discrepancies := make(map[string]string)
+	for _, ig := range osASG.ApplyCmd.InstanceGroups {
+		name := ig.ObjectMeta.Name
+		minSize := int(fi.Int32Value(ig.Spec.MinSize))
+		if counts[name] != minSize {
+			discrepancies[name] = fmt.Sprintf("%s has %d servers, minSize is %d", name, counts[name], minSize)
+		}
+	}
+	return discrepancies, nil
+}
+
+// fastPath returns true if the task build can be skipped: the latest one found nothing to
+// apply less than --task-build-interval ago and the server counts match the instance groups.
+// Otherwise the instance groups whose server counts differ are returned, if they are known.
+func (osASG *openstackASG) fastPath() (bool, []string) {
+	if osASG.opts.TaskBuildInterval <= 0 || osASG.builtAt.IsZero() || time.Since(osASG.builtAt) >= osASG.opts.TaskBuildInterval {
+		return false, nil
+	}
+	if osASG.lastPlanID != "" || osASG.requeued != nil || osASG.delayed() != "" {
+		return false, nil
+	}
+	discrepancies, err := osASG.sizeDiscrepancies()
+	if err != nil {
+		glog.Warningf("Error comparing server counts of %s: %v", osASG.clusterName, err)
+		return false, nil
+	}
+	if len(discrepancies) == 0 {
+		return true, nil
+	}
+	var drifted, descriptions []string
+	for name := range discrepancies {
+		drifted = append(drifted, name)
+	}
+	sort.Strings(drifted)
+	for _, name := range drifted {
+		descriptions = append(descriptions, discrepancies[name])
+	}
+	glog.Infof("Building tasks of %s, %s\n", osASG.clusterName, strings.Join(descriptions, ", "))
+	return false, drifted
+}
+
+// scopedInstanceGroups returns the instance groups the tasks are built for when only the named
+// instance group has drifted. Kops needs at least one master and one node instance group, and
+// the tasks of the API load balancer depend on the masters, so all masters are kept, and the
+// first node instance group when the drifted one is a master.
+func scopedInstanceGroups(instanceGroups []*kops.InstanceGroup, name string) []*kops.InstanceGroup {
+	var scoped []*kops.InstanceGroup
+	var node *kops.InstanceGroup
+	hasNode := false
+	for _, ig := range instanceGroups {
+		switch {
+		case ig.ObjectMeta.Name == name:
+			scoped = append(scoped, ig)
+			hasNode = hasNode || !ig.IsMaster()
+		case ig.IsMaster():
+			scoped = append(scoped, ig)
+		case node == nil:
+			node = ig
+		}
+	}
+	if !hasNode && node != nil {
+		scoped = append(scoped, node)
+	}
+	sort.Slice(scoped, func(i, j int) bool {
+		return scoped[i].ObjectMeta.Name < scoped[j].ObjectMeta.Name
+	})
+	return scoped
+}
+
+// markBuilt remembers the time of a task build which found no instances to change. Builds
+// with servers still booting are not remembered, as the boots are tracked in the dry-run.
+// A build scoped to a single instance group does not replace the latest full build, but
+// changes found by it are verified by a full build. Builds during create-first replacements and
+// blue/green rollouts are not remembered either.
+func (osASG *openstackASG) markBuilt(plan *Plan, scoped string) {
+	if plan.needsUpdate() || len(plan.postponed) > 0 || len(osASG.boots) > 0 || len(osASG.surges) > 0 || osASG.rolloutActive() {
+		osASG.builtAt = time.Time{}
+		return
+	}
+	if scoped == "" {
+		osASG.builtAt = time.Now()
+	}
+}
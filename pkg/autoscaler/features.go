@@ -0,0 +1,175 @@
+package autoscaler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+// capabilities are the features of the OpenStack APIs the optional features of the autoscaler depend on
+type capabilities struct {
+	// computeMinVersion and computeMaxVersion are the supported compute microversions, empty if unknown
+	computeMinVersion string
+	computeMaxVersion string
+	// loadBalancers is octavia or neutron, or empty if neither is available
+	loadBalancers string
+	// hypervisors is true if the hypervisors can be listed, probed only with --check-capacity
+	hypervisors bool
+	report      string
+}
+
+// probedCapabilities are the probed capabilities by compute endpoint, the report is logged once per cloud
+var probedCapabilities = struct {
+	sync.Mutex
+	byEndpoint map[string]*capabilities
+}{byEndpoint: make(map[string]*capabilities)}
+
+// probeCapabilities checks which of the features configured in the options the cloud supports and
+// logs a report the first time the cloud is seen. Features the cloud does not support are disabled
+// instead of failing every execution: a compute microversion out of the supported range is not used,
+// the API load balancer pool is not checked without a load balancer service and --check-capacity
+// is skipped without access to the hypervisors.
+func probeCapabilities(cloud openstack.OpenstackCloud, opts *Options) *capabilities {
+	compute := cloud.ComputeClient()
+	key := compute.Endpoint
+	if lb := cloud.LoadBalancerClient(); lb != nil {
+		key += " " + lb.Endpoint
+	}
+	probedCapabilities.Lock()
+	caps, ok := probedCapabilities.byEndpoint[key]
+	probedCapabilities.Unlock()
+	if !ok {
+		caps = probe(cloud, opts)
+		probedCapabilities.Lock()
+		probedCapabilities.byEndpoint[key] = caps
+		probedCapabilities.Unlock()
+		glog.Infof("OpenStack capabilities of %s:\n%s", compute.Endpoint, caps.report)
+	}
+	if compute.Microversion != "" && !caps.supportsCompute(compute.Microversion) {
+		compute.Microversion = ""
+	}
+	return caps
+}
+
+// features returns the capabilities of the cloud of the cluster, nil before its clients are built
+func (osASG *openstackASG) features() *capabilities {
+	if osASG.clients == nil {
+		return nil
+	}
+	return osASG.clients.capabilities
+}
+
+func probe(cloud openstack.OpenstackCloud, opts *Options) *capabilities {
+	caps := &capabilities{}
+	var report []string
+
+	compute := cloud.ComputeClient()
+	var versions struct {
+		Version struct {
+			MinVersion string `json:"min_version"`
+			Version    string `json:"version"`
+		} `json:"version"`
+	}
+	// the provider client does not send the microversion header, which could be the one not supported
+	_, err := compute.ProviderClient.Request("GET", compute.Endpoint, &gophercloud.RequestOpts{
+		JSONResponse: &versions,
+		OkCodes:      []int{200},
+	})
+	switch {
+	case err != nil:
+		report = append(report, fmt.Sprintf("compute microversions: unknown (%v)", err))
+	case versions.Version.Version == "":
+		report = append(report, "compute microversions: not supported")
+	default:
+		caps.computeMinVersion = versions.Version.MinVersion
+		caps.computeMaxVersion = versions.Version.Version
+		report = append(report, fmt.Sprintf("compute microversions: %s - %s", caps.computeMinVersion, caps.computeMaxVersion))
+	}
+	if v := opts.ComputeMicroversion; v != "" {
+		if caps.supportsCompute(v) {
+			report = append(report, fmt.Sprintf("--compute-microversion %s: supported", v))
+		} else {
+			report = append(report, fmt.Sprintf("--compute-microversion %s: not supported, using the default microversion", v))
+			compute.Microversion = ""
+		}
+	}
+
+	lb := cloud.LoadBalancerClient()
+	switch {
+	case lb == nil:
+		report = append(report, "load balancers: no client")
+	case lb.Type == octaviaType:
+		caps.loadBalancers = lbProviderOctavia
+		report = append(report, "load balancers: octavia")
+	case networkExtension(cloud.NetworkingClient(), "lbaasv2"):
+		caps.loadBalancers = lbProviderNeutron
+		report = append(report, "load balancers: neutron lbaas v2")
+	default:
+		report = append(report, "load balancers: not available, API load balancer pool is not checked")
+	}
+
+	if opts.CheckCapacity {
+		_, err := compute.Get(compute.ServiceURL("os-hypervisors"), nil, &gophercloud.RequestOpts{OkCodes: []int{200}})
+		if err == nil {
+			caps.hypervisors = true
+			report = append(report, "hypervisors: available")
+		} else {
+			report = append(report, fmt.Sprintf("hypervisors: not available, --check-capacity is skipped (%v)", err))
+		}
+	}
+	caps.report = "  " + strings.Join(report, "\n  ") + "\n"
+	return caps
+}
+
+// supportsCompute returns true if the compute microversion is latest or in the supported range, or the range is unknown
+func (caps *capabilities) supportsCompute(version string) bool {
+	if caps.computeMaxVersion == "" || version == "latest" {
+		return true
+	}
+	return compareMicroversions(version, caps.computeMinVersion) >= 0 && compareMicroversions(version, caps.computeMaxVersion) <= 0
+}
+
+// compareMicroversions compares microversions like 2.60, returning -1, 0 or 1
+func compareMicroversions(a string, b string) int {
+	pa, pb := strings.SplitN(a, ".", 2), strings.SplitN(b, ".", 2)
+	for i := 0; i < 2; i++ {
+		var x, y int
+		if i < len(pa) {
+			x, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			y, _ = strconv.Atoi(pb[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// networkExtension returns true if the networking API has the extension
+func networkExtension(client *gophercloud.ServiceClient, alias string) bool {
+	var body struct {
+		Extensions []struct {
+			Alias string `json:"alias"`
+		} `json:"extensions"`
+	}
+	if _, err := client.Get(client.ServiceURL("extensions"), &body, nil); err != nil {
+		glog.V(2).Infof("Error listing network extensions: %v\n", err)
+		return false
+	}
+	for _, e := range body.Extensions {
+		if e.Alias == alias {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package autoscaler
+
+import (
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+)
+
+// foreignServers returns the servers of the instance groups which carry metadata of other
+// orchestration, e.g. Heat stacks, mapped to the metadata key which identified them.
+// These servers are never replaced or deleted by the autoscaler.
+func (osASG *openstackASG) foreignServers(list []servers.Server) map[string]string {
+	keys := splitList(osASG.opts.ForeignMetadataKeys)
+	foreign := make(map[string]string)
+	for _, s := range list {
+		if osASG.instanceGroupFor(s.Name) == "" {
+			continue
+		}
+		for _, key := range keys {
+			if _, ok := s.Metadata[key]; ok {
+				foreign[s.Name] = key
+				break
+			}
+		}
+	}
+	return foreign
+}
+
+// foreignChange returns the metadata key marking the server of the change as managed by
+// other orchestration, or empty string
+func (osASG *openstackASG) foreignChange(c Change) string {
+	if c.Action == actionCreate {
+		return ""
+	}
+	return osASG.foreign[changeInstance(c)]
+}
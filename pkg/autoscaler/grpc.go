@@ -0,0 +1,251 @@
+package autoscaler
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	adminv1 "github.com/zetaab/kops-autoscaler-openstack/pkg/admin/v1"
+)
+
+// grpcAdmin serves the Admin service of proto/admin.proto with the authentication, audit log
+// and limits of the HTTP admin API
+type grpcAdmin struct {
+	s *adminServer
+}
+
+// startGRPC serves the gRPC admin API on Options.AdminGRPCAddress, over TLS if tlsConfig is set
+func (s *adminServer) startGRPC(tlsConfig *tls.Config) error {
+	lis, err := net.Listen("tcp", s.opts.AdminGRPCAddress)
+	if err != nil {
+		return fmt.Errorf("error listening on %s: %v", s.opts.AdminGRPCAddress, err)
+	}
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	s.grpc = grpc.NewServer(opts...)
+	adminv1.RegisterAdminServer(s.grpc, &grpcAdmin{s: s})
+	glog.Infof("Starting gRPC admin API on %s\n", lis.Addr())
+	go func() {
+		if err := s.grpc.Serve(lis); err != nil {
+			glog.Errorf("gRPC admin API stopped %v", err)
+		}
+	}()
+	return nil
+}
+
+// grpcRequest returns the HTTP request equivalent to the gRPC call, so that the callers are
+// authenticated, audited and throttled like the callers of the HTTP admin API
+func grpcRequest(ctx context.Context) *http.Request {
+	r := &http.Request{
+		URL:    &url.URL{},
+		Header: make(http.Header),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			r.TLS = &info.State
+		}
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, v := range md["authorization"] {
+			r.Header.Add("Authorization", v)
+		}
+	}
+	return r
+}
+
+// grpcError returns err with the gRPC code of the HTTP status
+func grpcError(httpStatus int, err error) error {
+	code := codes.Internal
+	switch httpStatus {
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	}
+	return status.Error(code, err.Error())
+}
+
+// cluster returns the requested cluster, defaults to the --name cluster
+func (g *grpcAdmin) cluster(name string) string {
+	if name != "" {
+		return name
+	}
+	return g.s.opts.ClusterName
+}
+
+func (g *grpcAdmin) GetPlan(ctx context.Context, in *adminv1.ClusterRequest) (*adminv1.Plan, error) {
+	plan, err := PendingPlan(g.s.opts, g.cluster(in.Cluster))
+	if err != nil {
+		return nil, grpcError(http.StatusInternalServerError, err)
+	}
+	if plan == nil {
+		return nil, status.Error(codes.NotFound, "no pending plan")
+	}
+	return planProto(plan), nil
+}
+
+func (g *grpcAdmin) Approve(ctx context.Context, in *adminv1.ApproveRequest) (*adminv1.Plan, error) {
+	r := grpcRequest(ctx)
+	name := g.cluster(in.Cluster)
+	caller, code, err := g.s.checkCaller(r, "approve", name)
+	if err != nil {
+		return nil, grpcError(code, err)
+	}
+	plan, err := g.s.approve(r, caller, name, in.Id)
+	if err != nil {
+		return nil, grpcError(http.StatusConflict, err)
+	}
+	return planProto(plan), nil
+}
+
+func (g *grpcAdmin) Pause(ctx context.Context, in *adminv1.ClusterRequest) (*adminv1.ClusterActionResponse, error) {
+	return g.clusterAction(ctx, in, "pause", "paused", func(name string) error {
+		return g.s.manager.setPaused(name, true)
+	})
+}
+
+func (g *grpcAdmin) Resume(ctx context.Context, in *adminv1.ClusterRequest) (*adminv1.ClusterActionResponse, error) {
+	return g.clusterAction(ctx, in, "resume", "resumed", func(name string) error {
+		return g.s.manager.setPaused(name, false)
+	})
+}
+
+func (g *grpcAdmin) Reconcile(ctx context.Context, in *adminv1.ClusterRequest) (*adminv1.ClusterActionResponse, error) {
+	return g.clusterAction(ctx, in, "reconcile", "scheduled for execution", func(name string) error {
+		return g.s.manager.trigger(name)
+	})
+}
+
+func (g *grpcAdmin) clusterAction(ctx context.Context, in *adminv1.ClusterRequest, verb string, result string, action func(name string) error) (*adminv1.ClusterActionResponse, error) {
+	r := grpcRequest(ctx)
+	name := g.cluster(in.Cluster)
+	caller, code, err := g.s.checkCaller(r, verb, name)
+	if err != nil {
+		return nil, grpcError(code, err)
+	}
+	if wait, code, err := g.s.runAction(r, caller, verb, name, result, action); err != nil {
+		if wait > 0 {
+			grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfter(wait)))
+		}
+		return nil, grpcError(code, err)
+	}
+	return &adminv1.ClusterActionResponse{Cluster: name, Result: result}, nil
+}
+
+func (g *grpcAdmin) Ready(ctx context.Context, in *adminv1.ReadyRequest) (*adminv1.ReadyResponse, error) {
+	return &adminv1.ReadyResponse{Ready: g.s.manager.ready()}, nil
+}
+
+func (g *grpcAdmin) GetStatus(ctx context.Context, in *adminv1.StatusRequest) (*adminv1.StatusList, error) {
+	statuses, err := g.s.manager.statuses(in.Cluster)
+	if err != nil {
+		return nil, grpcError(http.StatusNotFound, err)
+	}
+	list := &adminv1.StatusList{}
+	for _, s := range statuses {
+		list.Clusters = append(list.Clusters, statusProto(s))
+	}
+	return list, nil
+}
+
+func planProto(plan *Plan) *adminv1.Plan {
+	p := &adminv1.Plan{
+		Id:         plan.ID,
+		Cluster:    plan.Cluster,
+		Created:    timestampProto(&plan.Created),
+		Approved:   plan.Approved,
+		ApprovedBy: plan.ApprovedBy,
+		ApprovedAt: timestampProto(plan.ApprovedAt),
+	}
+	for _, c := range plan.Changes {
+		p.Changes = append(p.Changes, &adminv1.Change{
+			Key:    c.Key,
+			Type:   c.Type,
+			Name:   c.Name,
+			Action: c.Action,
+			Fields: c.Fields,
+			Kind:   c.Kind,
+		})
+	}
+	return p
+}
+
+func statusProto(s *ClusterStatus) *adminv1.ClusterStatus {
+	p := &adminv1.ClusterStatus{
+		Cluster:                 s.Cluster,
+		LastReconcile:           timestampProto(s.LastReconcile),
+		LastSuccessfulReconcile: timestampProto(s.LastSuccessfulReconcile),
+		LastApply:               timestampProto(s.LastApply),
+		Paused:                  s.Paused,
+		Error:                   s.Error,
+	}
+	if len(s.InstanceGroups) > 0 {
+		p.InstanceGroups = make(map[string]*adminv1.InstanceGroupCount)
+		for name, c := range s.InstanceGroups {
+			p.InstanceGroups[name] = &adminv1.InstanceGroupCount{
+				MinSize: int32(c.MinSize),
+				MaxSize: int32(c.MaxSize),
+				Servers: int32(c.Servers),
+			}
+		}
+	}
+	for i := range s.Conditions {
+		c := &s.Conditions[i]
+		p.Conditions = append(p.Conditions, &adminv1.StatusCondition{
+			Type:               c.Type,
+			Status:             c.Status,
+			Reason:             c.Reason,
+			Message:            c.Message,
+			LastTransitionTime: timestampProto(&c.LastTransitionTime),
+		})
+	}
+	for i := range s.History {
+		e := &s.History[i]
+		p.History = append(p.History, &adminv1.Execution{
+			Started:  timestampProto(&e.Started),
+			Duration: e.Duration,
+			PlanId:   e.PlanID,
+			Changes:  int32(e.Changes),
+			Actions:  e.Actions,
+			Error:    e.Error,
+		})
+	}
+	return p
+}
+
+// timestampProto converts t, nil or zero times are left out of the message
+func timestampProto(t *time.Time) *timestamp.Timestamp {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	ts, err := ptypes.TimestampProto(*t)
+	if err != nil {
+		return nil
+	}
+	return ts
+}
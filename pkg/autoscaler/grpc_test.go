@@ -0,0 +1,93 @@
+package autoscaler
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	adminv1 "github.com/zetaab/kops-autoscaler-openstack/pkg/admin/v1"
+)
+
+func TestGRPCAdmin(t *testing.T) {
+	applied := time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+	m := &manager{
+		dryRunDone: true,
+		workers: map[string]*openstackASG{
+			"a.example.com": {
+				lastStatus: &ClusterStatus{
+					Cluster:        "a.example.com",
+					LastApply:      &applied,
+					InstanceGroups: map[string]*InstanceGroupCount{"nodes": {MinSize: 2, MaxSize: 5, Servers: 3}},
+				},
+				history: []Execution{{Started: applied, Duration: "1m0s", Changes: 2, Actions: []string{"created server"}}},
+			},
+		},
+	}
+	s := &adminServer{
+		opts:    &Options{ClusterName: "a.example.com"},
+		manager: m,
+		auth:    &adminAuth{token: "secret"},
+		limits:  map[string]*triggerLimiter{"reconcile": newTriggerLimiter(time.Minute, nil)},
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	adminv1.RegisterAdminServer(server, &grpcAdmin{s: s})
+	go server.Serve(lis)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := adminv1.NewAdminClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ready, err := client.Ready(ctx, &adminv1.ReadyRequest{})
+	if err != nil || !ready.Ready {
+		t.Fatalf("Ready = %v, %v, want ready", ready, err)
+	}
+
+	list, err := client.GetStatus(ctx, &adminv1.StatusRequest{Cluster: "a.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Clusters) != 1 {
+		t.Fatalf("got %d clusters, want 1", len(list.Clusters))
+	}
+	c := list.Clusters[0]
+	if c.LastApply.GetSeconds() != applied.Unix() {
+		t.Errorf("lastApply = %v, want %v", c.LastApply, applied)
+	}
+	if ig := c.InstanceGroups["nodes"]; ig == nil || ig.MinSize != 2 || ig.MaxSize != 5 || ig.Servers != 3 {
+		t.Errorf("instance group nodes = %v", ig)
+	}
+	if len(c.History) != 1 || c.History[0].Changes != 2 || len(c.History[0].Actions) != 1 {
+		t.Errorf("history = %v", c.History)
+	}
+	if _, err := client.GetStatus(ctx, &adminv1.StatusRequest{Cluster: "b.example.com"}); grpc.Code(err) != codes.NotFound {
+		t.Errorf("status of unmanaged cluster: %v, want NotFound", err)
+	}
+
+	if _, err := client.Reconcile(ctx, &adminv1.ClusterRequest{}); grpc.Code(err) != codes.Unauthenticated {
+		t.Errorf("reconcile without token: %v, want Unauthenticated", err)
+	}
+	authorized := metadata.NewOutgoingContext(ctx, metadata.Pairs("authorization", "Bearer secret"))
+	resp, err := client.Reconcile(authorized, &adminv1.ClusterRequest{})
+	if err != nil || resp.Cluster != "a.example.com" {
+		t.Fatalf("Reconcile = %v, %v", resp, err)
+	}
+	if _, err := client.Reconcile(authorized, &adminv1.ClusterRequest{}); grpc.Code(err) != codes.ResourceExhausted {
+		t.Errorf("second reconcile: %v, want ResourceExhausted", err)
+	}
+}
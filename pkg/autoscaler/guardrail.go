@@ -0,0 +1,94 @@
+package autoscaler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstacktasks"
+)
+
+// limit is an absolute number or a percentage of the instance group size
+type limit struct {
+	value   int
+	percent bool
+}
+
+func parseLimit(s string) (*limit, error) {
+	if s == "" {
+		return nil, nil
+	}
+	l := &limit{}
+	if strings.HasSuffix(s, "%") {
+		l.percent = true
+		s = strings.TrimSuffix(s, "%")
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		return nil, fmt.Errorf("invalid limit %q, must be number or percentage", s)
+	}
+	l.value = v
+	return l, nil
+}
+
+// exceeded returns true if count is over the limit in group of given size
+func (l *limit) exceeded(count int, size int) bool {
+	if l.percent {
+		return count*100 > l.value*size
+	}
+	return count > l.value
+}
+
+func (l *limit) String() string {
+	if l.percent {
+		return fmt.Sprintf("%d%%", l.value)
+	}
+	return strconv.Itoa(l.value)
+}
+
+// instanceGroupFor returns the name of the instance group the server belongs to. All instance
+// groups of the cluster are matched, also when the tasks are built for some of them only.
+func (osASG *openstackASG) instanceGroupFor(server string) string {
+	if osASG.instanceGroups != nil {
+		return instanceGroupOf(osASG.clusterName, osASG.instanceGroups, server)
+	}
+	return instanceGroupOf(osASG.clusterName, osASG.ApplyCmd.InstanceGroups, server)
+}
+
+// deletionsOverLimit returns description of the instance groups in which the plan would delete
+// more servers than allowed by --max-deletions, or empty string if the plan is within the limit.
+func (osASG *openstackASG) deletionsOverLimit(plan *Plan) string {
+	if osASG.maxDeletions == nil {
+		return ""
+	}
+	deletions := make(map[string]int)
+	for _, c := range plan.Changes {
+		if c.Type == "Instance" && c.Action == actionDelete {
+			deletions[osASG.instanceGroupFor(c.Name)]++
+		}
+	}
+	if len(deletions) == 0 {
+		return ""
+	}
+
+	// current size is the servers that exist and are not created by the plan
+	sizes := make(map[string]int)
+	for ig, count := range deletions {
+		sizes[ig] = count
+	}
+	for key, t := range osASG.ApplyCmd.TaskMap {
+		if i, ok := t.(*openstacktasks.Instance); ok && !plan.creates(strings.TrimPrefix(key, "Instance/")) {
+			sizes[osASG.instanceGroupFor(taskName(i))]++
+		}
+	}
+
+	var over []string
+	for ig, count := range deletions {
+		if osASG.maxDeletions.exceeded(count, sizes[ig]) {
+			over = append(over, fmt.Sprintf("%d of %d servers in %q", count, sizes[ig], ig))
+		}
+	}
+	sort.Strings(over)
+	return strings.Join(over, ", ")
+}
@@ -0,0 +1,59 @@
+package autoscaler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// parseIgnoreFields parses the task fields ignored in change detection. A field is given as Type.Field,
+// e.g. Port.SecurityGroups, and a key of server metadata as Instance.Metadata.key.
+func parseIgnoreFields(list []string) (map[string]bool, error) {
+	fields := make(map[string]bool)
+	for _, f := range list {
+		parts := strings.SplitN(f, ".", 3)
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" || (len(parts) == 3 && parts[2] == "") {
+			return nil, fmt.Errorf("invalid ignored field %q, must be Type.Field or Type.Field.key", f)
+		}
+		if len(parts) == 3 && parts[0]+"."+parts[1] != "Instance.Metadata" {
+			return nil, fmt.Errorf("invalid ignored field %q, only keys of Instance.Metadata can be ignored", f)
+		}
+		fields[f] = true
+	}
+	return fields, nil
+}
+
+// fieldIgnored returns true if the field of the task type, or the key of it, is ignored by the cluster settings
+func (osASG *openstackASG) fieldIgnored(taskType string, field string, key string) bool {
+	if osASG.settings == nil || len(osASG.settings.ignoreFields) == 0 {
+		return false
+	}
+	if osASG.settings.ignoreFields[taskType+"."+field] {
+		return true
+	}
+	return key != "" && osASG.settings.ignoreFields[taskType+"."+field+"."+key]
+}
+
+// dropIgnoredFields removes the ignored fields from an update. Returns true if all of its fields are
+// ignored, so that the update is no change at all.
+func (osASG *openstackASG) dropIgnoredFields(c Change) (Change, bool) {
+	if c.Action != actionUpdate || len(c.Fields) == 0 {
+		return c, false
+	}
+	var fields []string
+	for _, f := range c.Fields {
+		if !osASG.fieldIgnored(c.Type, f, "") {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == len(c.Fields) {
+		return c, false
+	}
+	if len(fields) == 0 {
+		glog.V(2).Infof("Ignoring %s, the fields are ignored\n", c)
+		return c, true
+	}
+	c.Fields = fields
+	return c, false
+}
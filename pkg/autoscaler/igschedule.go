@@ -0,0 +1,119 @@
+package autoscaler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/kops/pkg/apis/kops"
+)
+
+const (
+	// annotationGroupInterval sets the interval at which the changes of an instance group are acted on.
+	// The cluster is executed at the shortest interval of its instance groups.
+	annotationGroupInterval = annotationPrefix + "interval"
+	// annotationGroupCooldown sets the time after changes to the servers of an instance group during
+	// which its further changes are postponed
+	annotationGroupCooldown = annotationPrefix + "cooldown"
+)
+
+// groupInterval returns the interval set in the annotation of the instance group, or zero if it has none
+func groupInterval(ig *kops.InstanceGroup) (time.Duration, error) {
+	return groupDuration(ig, annotationGroupInterval)
+}
+
+// groupCooldown returns the cooldown set in the annotation of the instance group, or zero if it has none
+func groupCooldown(ig *kops.InstanceGroup) (time.Duration, error) {
+	return groupDuration(ig, annotationGroupCooldown)
+}
+
+func groupDuration(ig *kops.InstanceGroup, annotation string) (time.Duration, error) {
+	v, ok := ig.ObjectMeta.Annotations[annotation]
+	if !ok {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid annotation %s %q", annotation, v)
+	}
+	return d, nil
+}
+
+// shortestGroupInterval returns the shortest interval set on the instance groups, or zero
+func (osASG *openstackASG) shortestGroupInterval() time.Duration {
+	var shortest time.Duration
+	for _, ig := range osASG.instanceGroups {
+		interval, err := groupInterval(ig)
+		if err != nil || interval == 0 {
+			continue
+		}
+		if shortest == 0 || interval < shortest {
+			shortest = interval
+		}
+	}
+	return shortest
+}
+
+// dueChanges splits the instance changes of the instance groups cooling down, or with an interval
+// which has not passed since their changes were last acted on, from the changes to act on now.
+// Instance groups without the annotations are always due, and so are the changes requeued after
+// a failed apply.
+func (osASG *openstackASG) dueChanges(changes []Change) ([]Change, []Change) {
+	now := time.Now()
+	due := make(map[string]bool)
+	for _, ig := range osASG.instanceGroups {
+		name := ig.ObjectMeta.Name
+		if cooldown, err := groupCooldown(ig); err == nil && cooldown > 0 {
+			if until := osASG.groupChanged[name].Add(cooldown); now.Before(until) {
+				glog.V(2).Infof("Instance group %s is cooling down until %s\n", name, until.Format(time.RFC3339))
+				continue
+			}
+		}
+		interval, err := groupInterval(ig)
+		if err != nil || interval == 0 {
+			due[name] = true
+			continue
+		}
+		if checked, ok := osASG.groupChecked[name]; ok && now.Sub(checked) < interval {
+			continue
+		}
+		due[name] = true
+		if osASG.groupChecked == nil {
+			osASG.groupChecked = make(map[string]time.Time)
+		}
+		osASG.groupChecked[name] = now
+	}
+
+	var result, postponed []Change
+	for _, c := range changes {
+		server := changeInstance(c)
+		if server == "" || osASG.requeued[c.String()] {
+			result = append(result, c)
+			continue
+		}
+		if ig := osASG.instanceGroupFor(server); ig != "" && !due[ig] {
+			glog.V(2).Infof("Postponing %s, instance group %s is cooling down or its interval has not passed\n", c, ig)
+			postponed = append(postponed, c)
+			continue
+		}
+		result = append(result, c)
+	}
+	return result, postponed
+}
+
+// markChanged starts the cooldown of the instance groups whose servers were changed by the applied plan
+func (osASG *openstackASG) markChanged(plan *Plan) {
+	now := time.Now()
+	for _, c := range plan.Changes {
+		server := changeInstance(c)
+		if server == "" {
+			continue
+		}
+		if ig := osASG.instanceGroupFor(server); ig != "" {
+			if osASG.groupChanged == nil {
+				osASG.groupChanged = make(map[string]time.Time)
+			}
+			osASG.groupChanged[ig] = now
+		}
+	}
+}
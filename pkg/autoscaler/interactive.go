@@ -0,0 +1,29 @@
+package autoscaler
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// confirmInteractive prints the plan and asks the user whether it should be applied
+func confirmInteractive(plan *Plan) bool {
+	fmt.Print(plan.String())
+	fmt.Print("Apply these changes? [y/N]: ")
+	answer, err := stdin.ReadString('\n')
+	if err != nil {
+		glog.Errorf("Error reading answer %v", err)
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer == "y" || answer == "yes" {
+		return true
+	}
+	glog.Infof("Plan %s was not applied\n", plan.ID)
+	return false
+}
@@ -0,0 +1,117 @@
+package autoscaler
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// redacted replaces secret values in the /config output
+const redacted = "REDACTED"
+
+// secretOptions are the options never shown in /config
+var secretOptions = map[string]bool{
+	"AccessKey":       true,
+	"SecretKey":       true,
+	"NotifyWebhook":   true,
+	"CloudEventsSink": true,
+	"EventBus":        true,
+}
+
+// runtimeConfig is the resolved configuration served from /config
+type runtimeConfig struct {
+	// Options are the flags merged with the environment variables
+	Options map[string]interface{} `json:"options"`
+	// ConfigFile is the content of --config
+	ConfigFile *Config `json:"configFile"`
+	// Clusters are the settings in effect after merging annotations and the config file
+	Clusters map[string]*resolvedSettings `json:"clusters"`
+}
+
+type resolvedSettings struct {
+	Interval       string   `json:"interval"`
+	Paused         bool     `json:"paused"`
+	PausedByAdmin  bool     `json:"pausedByAdmin,omitempty"`
+	InstanceGroups []string `json:"instanceGroups,omitempty"`
+	Project        string   `json:"project,omitempty"`
+	ProjectDomain  string   `json:"projectDomain,omitempty"`
+	IgnoreFields   []string `json:"ignoreFields,omitempty"`
+}
+
+// redactedOptions returns the options by field name with secrets redacted
+func redactedOptions(opts *Options) map[string]interface{} {
+	result := make(map[string]interface{})
+	v := reflect.ValueOf(opts).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		switch value := v.Field(i).Interface().(type) {
+		case time.Duration:
+			result[name] = value.String()
+		case string:
+			if secretOptions[name] && value != "" {
+				result[name] = redacted
+			} else {
+				result[name] = redactURL(value)
+			}
+		default:
+			result[name] = value
+		}
+	}
+	return result
+}
+
+// redactURL removes the password of URLs like proxies with credentials
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
+
+// runtimeConfig returns the resolved configuration of the autoscaler and its clusters
+func (m *manager) runtimeConfig() *runtimeConfig {
+	c := &runtimeConfig{
+		Options:    redactedOptions(m.opts),
+		ConfigFile: m.config,
+		Clusters:   make(map[string]*resolvedSettings),
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, osASG := range m.workers {
+		s := &resolvedSettings{
+			Interval:      osASG.interval().String(),
+			PausedByAdmin: osASG.paused,
+		}
+		if osASG.settings != nil {
+			s.Paused = osASG.settings.paused
+			for ig := range osASG.settings.instanceGroups {
+				s.InstanceGroups = append(s.InstanceGroups, ig)
+			}
+			sort.Strings(s.InstanceGroups)
+			for f := range osASG.settings.ignoreFields {
+				s.IgnoreFields = append(s.IgnoreFields, f)
+			}
+			sort.Strings(s.IgnoreFields)
+			scope := keystoneScopeFor(osASG.opts, osASG.settings)
+			s.Project = scope.project
+			s.ProjectDomain = scope.projectDomain
+		}
+		c.Clusters[name] = s
+	}
+	return c
+}
+
+// handleConfig returns the resolved configuration with secrets redacted
+func (s *adminServer) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.manager.runtimeConfig())
+}
@@ -0,0 +1,81 @@
+package autoscaler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+// instanceGroupOf returns the name of the instance group the server belongs to.
+// Kops names the servers <cluster>-<instancegroup>-<index>.
+func instanceGroupOf(clusterName string, instanceGroups []*kops.InstanceGroup, server string) string {
+	group := ""
+	for _, ig := range instanceGroups {
+		prefix := strings.ToLower(fmt.Sprintf("%s-%s-", clusterName, ig.ObjectMeta.Name))
+		if strings.HasPrefix(server, prefix) && len(ig.ObjectMeta.Name) > len(group) {
+			group = ig.ObjectMeta.Name
+		}
+	}
+	return group
+}
+
+// clusterServers lists the servers tagged to belong to the cluster
+func clusterServers(cloud openstack.OpenstackCloud, clusterName string) ([]servers.Server, error) {
+	list, err := cloud.ListInstances(servers.ListOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing servers: %v", err)
+	}
+	var result []servers.Server
+	for _, s := range list {
+		if s.Metadata[openstack.TagClusterName] == clusterName {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+// serverCounts returns the number of servers in each instance group
+func serverCounts(cloud openstack.OpenstackCloud, cluster *kops.Cluster, instanceGroups []*kops.InstanceGroup) (map[string]int, error) {
+	list, err := clusterServers(cloud, cluster.ObjectMeta.Name)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, s := range list {
+		counts[instanceGroupOf(cluster.ObjectMeta.Name, instanceGroups, s.Name)]++
+	}
+	return counts, nil
+}
+
+// inventoryDrift compares the number of servers in each instance group against the
+// instance group sizes and describes the differences
+func (osASG *openstackASG) inventoryDrift(cluster *kops.Cluster, instanceGroups []*kops.InstanceGroup) ([]string, error) {
+	cloud, err := osASG.cloudFor(cluster)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := serverCounts(cloud, cluster, instanceGroups)
+	if err != nil {
+		return nil, err
+	}
+
+	var drift []string
+	for _, ig := range instanceGroups {
+		name := ig.ObjectMeta.Name
+		minSize := int(fi.Int32Value(ig.Spec.MinSize))
+		maxSize := int(fi.Int32Value(ig.Spec.MaxSize))
+		if counts[name] < minSize {
+			drift = append(drift, fmt.Sprintf("%s has %d servers, minSize is %d", name, counts[name], minSize))
+		}
+		if ig.Spec.MaxSize != nil && counts[name] > maxSize {
+			drift = append(drift, fmt.Sprintf("%s has %d servers, maxSize is %d", name, counts[name], maxSize))
+		}
+	}
+	sort.Strings(drift)
+	return drift, nil
+}
@@ -0,0 +1,172 @@
+package autoscaler
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/gophercloud/gophercloud"
+	openstackclient "github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// authEnvMu guards the OS_ environment variables, which kops reads the credentials from
+var authEnvMu sync.Mutex
+
+// keystoneScope is the domain of the user and the project the autoscaler authenticates to,
+// when they are not the ones in the credentials
+type keystoneScope struct {
+	userDomain    string
+	project       string
+	projectDomain string
+}
+
+// keystoneScopeFor returns the keystone scope of the cluster: the flags overridden by the cluster settings
+func keystoneScopeFor(opts *Options, settings *clusterSettings) keystoneScope {
+	scope := keystoneScope{
+		userDomain:    opts.UserDomain,
+		project:       opts.Project,
+		projectDomain: opts.ProjectDomain,
+	}
+	if settings != nil && settings.project != "" {
+		scope.project = settings.project
+		scope.projectDomain = settings.projectDomain
+	}
+	return scope
+}
+
+func (s keystoneScope) empty() bool {
+	return s == keystoneScope{}
+}
+
+// authOptions overrides the user domain and the project of the credentials. The project
+// is scoped by name in the project domain, which defaults to the user domain.
+func (s keystoneScope) authOptions(base gophercloud.AuthOptions) gophercloud.AuthOptions {
+	o := base
+	if s.userDomain != "" {
+		o.DomainName = s.userDomain
+		o.DomainID = ""
+	}
+	project := s.project
+	if project == "" {
+		if s.projectDomain == "" || o.TenantID != "" {
+			return o
+		}
+		project = o.TenantName
+	}
+	o.TenantID = ""
+	o.TenantName = ""
+	o.Scope = &gophercloud.AuthScope{ProjectName: project}
+	switch {
+	case s.projectDomain != "":
+		o.Scope.DomainName = s.projectDomain
+	case o.DomainID != "":
+		o.Scope.DomainID = o.DomainID
+	default:
+		o.Scope.DomainName = o.DomainName
+	}
+	return o
+}
+
+// credentials returns the current credentials with the scope applied
+func (s keystoneScope) credentials() (gophercloud.AuthOptions, error) {
+	authEnvMu.Lock()
+	defer authEnvMu.Unlock()
+	base, err := vfs.OpenstackConfig{}.GetCredential()
+	if err != nil {
+		return base, err
+	}
+	return s.authOptions(base), nil
+}
+
+// withCredentials runs f, which builds the kops cloud, with the credentials of the scope in
+// the environment, authenticating to authURL if it is set. The environment can not express
+// a project in another domain than the user, so the project is looked up and passed by ID.
+func withCredentials(s keystoneScope, authURL string, f func() error) error {
+	authEnvMu.Lock()
+	defer authEnvMu.Unlock()
+	if s.empty() && authURL == "" {
+		return f()
+	}
+	base, err := vfs.OpenstackConfig{}.GetCredential()
+	if err != nil {
+		return err
+	}
+	if authURL != "" {
+		base.IdentityEndpoint = authURL
+	}
+	o := s.authOptions(base)
+	projectID, projectName := o.TenantID, o.TenantName
+	if !s.empty() {
+		projectID, err = scopedProjectID(o)
+		if err != nil {
+			return fmt.Errorf("error finding project of keystone scope: %v", err)
+		}
+		projectName = ""
+	}
+	registerSecret(o.Password)
+
+	env := map[string]string{
+		"OS_AUTH_URL":     o.IdentityEndpoint,
+		"OS_USERNAME":     o.Username,
+		"OS_USERID":       o.UserID,
+		"OS_PASSWORD":     o.Password,
+		"OS_DOMAIN_ID":    o.DomainID,
+		"OS_DOMAIN_NAME":  o.DomainName,
+		"OS_TENANT_ID":    projectID,
+		"OS_PROJECT_ID":   projectID,
+		"OS_TENANT_NAME":  projectName,
+		"OS_PROJECT_NAME": projectName,
+	}
+	saved := make(map[string]*string)
+	for key, value := range env {
+		if v, ok := os.LookupEnv(key); ok {
+			saved[key] = &v
+		} else {
+			saved[key] = nil
+		}
+		if value == "" {
+			os.Unsetenv(key)
+		} else {
+			os.Setenv(key, value)
+		}
+	}
+	defer func() {
+		for key, v := range saved {
+			if v == nil {
+				os.Unsetenv(key)
+			} else {
+				os.Setenv(key, *v)
+			}
+		}
+	}()
+	return f()
+}
+
+// scopedProjectID authenticates with the credentials and returns the ID of the project of the token
+func scopedProjectID(o gophercloud.AuthOptions) (string, error) {
+	if o.Scope == nil && o.TenantID != "" {
+		return o.TenantID, nil
+	}
+	client, err := openstackclient.NewClient(o.IdentityEndpoint)
+	if err != nil {
+		return "", err
+	}
+	o.AllowReauth = false
+	if err := openstackclient.Authenticate(client, o); err != nil {
+		return "", err
+	}
+	identity, err := openstackclient.NewIdentityV3(client, gophercloud.EndpointOpts{})
+	if err != nil {
+		return "", err
+	}
+	project, err := tokens.Get(identity, client.TokenID).ExtractProject()
+	if err != nil {
+		return "", err
+	}
+	if project == nil || project.ID == "" {
+		return "", fmt.Errorf("token is not scoped to a project")
+	}
+	return project.ID, nil
+}
@@ -0,0 +1,32 @@
+package autoscaler
+
+import (
+	"fmt"
+	"net/http"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// newKubeClient builds a client for the kubernetes cluster the autoscaler is running in. Its
+// requests are sent with the context of the executions.
+func newKubeClient(ctx *runContext) (kubernetes.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error building in-cluster kubernetes config: %v", err)
+	}
+	config.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+		return newContextTransport(rt, ctx)
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+func nodeReady(node *v1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == v1.NodeReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
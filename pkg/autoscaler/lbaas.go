@@ -0,0 +1,69 @@
+package autoscaler
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+// load balancer services, selected with --lb-provider
+const (
+	lbProviderAuto    = "auto"
+	lbProviderOctavia = "octavia"
+	lbProviderNeutron = "neutron"
+)
+
+// octaviaType is the service catalog type of Octavia. Neutron LBaaS v2 is an extension of the network service.
+const octaviaType = "load-balancer"
+
+// selectLBService points the load balancer client of the cloud to Octavia or to Neutron LBaaS v2.
+// The embedded kops always uses the network endpoint, which has no load balancers on clouds where
+// Neutron LBaaS has been removed. Both expose the same API under v2.0/lbaas, so only the endpoint
+// differs. With auto, Octavia is used if the service catalog has it.
+func selectLBService(cloud openstack.OpenstackCloud, provider string) error {
+	client := cloud.LoadBalancerClient()
+	if client == nil {
+		return nil
+	}
+	if provider == "" {
+		provider = lbProviderAuto
+	}
+	if provider == lbProviderNeutron {
+		useNeutronLBaaS(client, cloud.NetworkingClient())
+		return nil
+	}
+	endpoint, err := client.ProviderClient.EndpointLocator(gophercloud.EndpointOpts{
+		Type:   octaviaType,
+		Region: cloud.Region(),
+	})
+	if err != nil {
+		if provider == lbProviderOctavia {
+			return fmt.Errorf("error finding octavia endpoint: %v", err)
+		}
+		glog.V(2).Infof("No octavia endpoint in region %s, using neutron lbaas\n", cloud.Region())
+		useNeutronLBaaS(client, cloud.NetworkingClient())
+		return nil
+	}
+	glog.V(2).Infof("Using octavia endpoint %s for load balancers\n", endpoint)
+	client.Endpoint = endpoint
+	client.ResourceBase = endpoint + "v2.0/"
+	client.Type = octaviaType
+	return nil
+}
+
+// useNeutronLBaaS points the load balancer client to the network endpoint
+func useNeutronLBaaS(client *gophercloud.ServiceClient, network *gophercloud.ServiceClient) {
+	client.Endpoint = network.Endpoint
+	client.ResourceBase = network.ResourceBase
+	client.Type = network.Type
+}
+
+func validateLBProvider(provider string) error {
+	switch provider {
+	case "", lbProviderAuto, lbProviderOctavia, lbProviderNeutron:
+		return nil
+	}
+	return fmt.Errorf("unknown load balancer provider %q, must be auto, octavia or neutron", provider)
+}
@@ -0,0 +1,230 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kops/pkg/client/simple"
+)
+
+// manager keeps track of the managed clusters and schedules their executions
+type manager struct {
+	opts         *Options
+	clientset    simple.Clientset
+	selector     labels.Selector
+	config       *Config
+	kubeClient   kubernetes.Interface
+	notifier     *notifier
+	maxDeletions *limit
+	// ctx is the context of the executions, set by the Reconciler
+	ctx *runContext
+	// applier returns the Applier of the clusters, set by the Reconciler
+	applier ApplierFunc
+	// alerts are the Alertmanager alerts scaling the instance groups
+	alerts *alertScaler
+	// sizeOverrides are the desired sizes from the size overrides config map
+	sizeOverrides *sizeOverrides
+
+	mu            sync.Mutex
+	workers       map[string]*openstackASG
+	lastDiscovery time.Time
+	// started is the startup time the initial delay is counted from
+	started time.Time
+	// dryRunDone is set after the first successful dry-run of any cluster
+	dryRunDone bool
+}
+
+// run executes the clusters when their interval has passed, until ctx is done
+func (m *manager) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+		m.discover()
+		for _, osASG := range m.due() {
+			if ctx.Err() != nil {
+				return
+			}
+			glog.Infof("Executing %s...\n", osASG.clusterName)
+			if r := osASG.apiRecorder(); r != nil {
+				r.reset()
+			}
+			started := time.Now()
+			result := &Result{Cluster: osASG.clusterName}
+			osASG.result = result
+			err := osASG.reconcile()
+			osASG.result = nil
+			if err != nil {
+				osASG.logError(err)
+				osASG.saveRecording(err)
+				osASG.resetClients()
+			} else {
+				lastSuccessfulReconcile.WithLabelValues(osASG.clusterName).SetToCurrentTime()
+			}
+			status := osASG.writeStatus(err)
+			m.mu.Lock()
+			osASG.lastStatus = status
+			osASG.addExecution(newExecution(started, result, err))
+			osASG.next = time.Now().Add(osASG.nextInterval())
+			if osASG.dryRunDone {
+				m.dryRunDone = true
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// discover updates the managed clusters
+func (m *manager) discover() {
+	if time.Since(m.lastDiscovery) < time.Duration(m.opts.Sleep)*time.Second {
+		return
+	}
+	m.lastDiscovery = time.Now()
+
+	names := []string{m.opts.ClusterName}
+	if m.opts.DiscoverAll {
+		var err error
+		names, err = discoverClusters(m.clientset, m.selector)
+		if err != nil {
+			glog.Errorf("Error discovering clusters %v", err)
+			return
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	workers := make(map[string]*openstackASG)
+	for _, name := range names {
+		osASG := m.workers[name]
+		if osASG == nil {
+			glog.Infof("Managing cluster %s\n", name)
+			osASG = &openstackASG{
+				opts:          m.opts,
+				clientset:     m.clientset,
+				clusterName:   name,
+				config:        m.config,
+				kubeClient:    m.kubeClient,
+				notifier:      m.notifier,
+				maxDeletions:  m.maxDeletions,
+				runCtx:        m.ctx,
+				sizeOverrides: m.sizeOverrides,
+				next:          time.Now().Add(time.Duration(m.opts.Sleep) * time.Second),
+				applyAfter:    m.started.Add(m.opts.InitialDelay + splay(m.opts.InitialSplay)),
+			}
+			osASG.applier = newApplier(osASG, m.applier)
+		}
+		workers[name] = osASG
+	}
+	m.workers = workers
+}
+
+// due returns the clusters which should be executed now
+func (m *manager) due() []*openstackASG {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []*openstackASG
+	now := time.Now()
+	for _, osASG := range m.workers {
+		if !osASG.paused && !osASG.next.After(now) {
+			due = append(due, osASG)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].clusterName < due[j].clusterName
+	})
+	return due
+}
+
+// worker returns the managed cluster with the name
+func (m *manager) worker(name string) (*openstackASG, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	osASG, ok := m.workers[name]
+	if !ok {
+		return nil, fmt.Errorf("cluster %q is not managed", name)
+	}
+	return osASG, nil
+}
+
+// statuses returns the status of the named cluster, or of every managed cluster if name is empty
+func (m *manager) statuses(name string) ([]*ClusterStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	if name != "" {
+		if _, ok := m.workers[name]; !ok {
+			return nil, fmt.Errorf("cluster %q is not managed", name)
+		}
+		names = []string{name}
+	} else {
+		for name := range m.workers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	var list []*ClusterStatus
+	for _, name := range names {
+		osASG := m.workers[name]
+		s := &ClusterStatus{Cluster: name}
+		if osASG.lastStatus != nil {
+			copied := *osASG.lastStatus
+			s = &copied
+		}
+		// pausing and resuming from the admin API take effect before the next execution
+		s.Paused = osASG.paused || s.conditionReason(conditionPaused) == "PausedBySettings"
+		s.History = append([]Execution{}, osASG.history...)
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+// setPaused pauses or resumes the cluster until the process is restarted
+func (m *manager) setPaused(name string, paused bool) error {
+	osASG, err := m.worker(name)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	osASG.paused = paused
+	return nil
+}
+
+// trigger schedules the cluster to be executed immediately
+func (m *manager) trigger(name string) error {
+	osASG, err := m.worker(name)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	osASG.next = time.Now()
+	return nil
+}
+
+// splayRand is used only from discover, while holding the manager lock
+var splayRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// splay returns random duration between 0 and max
+func splay(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(splayRand.Int63n(int64(max)))
+}
+
+// ready returns true once a dry-run has succeeded since startup
+func (m *manager) ready() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.dryRunDone
+}
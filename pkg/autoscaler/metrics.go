@@ -0,0 +1,84 @@
+package autoscaler
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+var (
+	stateStoreDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "kops_autoscaler",
+		Subsystem: "state_store",
+		Name:      "operation_duration_seconds",
+		Help:      "Latency of state store operations.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"backend", "operation"})
+	stateStoreErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kops_autoscaler",
+		Subsystem: "state_store",
+		Name:      "operation_errors_total",
+		Help:      "Number of failed state store operations.",
+	}, []string{"backend", "operation"})
+	lastSuccessfulReconcile = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kops_autoscaler",
+		Name:      "last_successful_reconcile_timestamp_seconds",
+		Help:      "Time of the latest execution of the cluster which finished without errors.",
+	}, []string{"cluster"})
+	lastSuccessfulApply = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kops_autoscaler",
+		Name:      "last_successful_apply_timestamp_seconds",
+		Help:      "Time of the latest plan applied to the cluster.",
+	}, []string{"cluster"})
+	instanceGroupValid = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kops_autoscaler",
+		Name:      "instance_group_valid",
+		Help:      "Whether the instance group passed validation in the latest execution, 1 or 0.",
+	}, []string{"cluster", "instance_group"})
+	reconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kops_autoscaler",
+		Name:      "reconcile_errors_total",
+		Help:      "Number of failed executions by class: state_store_unavailable, quota_exceeded, apply_failed, unsupported_spec, cancelled or other.",
+	}, []string{"cluster", "class"})
+	unsupportedSpec = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "kops_autoscaler",
+		Name:      "unsupported_spec",
+		Help:      "Whether the cluster or instance group specs use an api version the embedded kops can not read, 1 or 0.",
+	}, []string{"cluster"})
+)
+
+func init() {
+	prometheus.MustRegister(stateStoreDuration)
+	prometheus.MustRegister(stateStoreErrors)
+	prometheus.MustRegister(lastSuccessfulReconcile)
+	prometheus.MustRegister(lastSuccessfulApply)
+	prometheus.MustRegister(instanceGroupValid)
+	prometheus.MustRegister(unsupportedSpec)
+	prometheus.MustRegister(reconcileErrors)
+}
+
+// observeStateStore records the latency and the result of a state store operation started at start
+func observeStateStore(backend string, operation string, start time.Time, err error) {
+	stateStoreDuration.WithLabelValues(backend, operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		stateStoreErrors.WithLabelValues(backend, operation).Inc()
+	}
+}
+
+// backendOf returns the name of the storage backend of the path
+func backendOf(p vfs.Path) string {
+	switch p.(type) {
+	case *vfs.S3Path:
+		return "s3"
+	case *vfs.SwiftPath:
+		return "swift"
+	case *vfs.FSPath:
+		return "file"
+	case *vfs.GSPath:
+		return "gs"
+	case *vfs.MemFSPath:
+		return "memfs"
+	}
+	return "other"
+}
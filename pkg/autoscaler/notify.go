@@ -0,0 +1,88 @@
+package autoscaler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// notification is the payload posted to the notification webhook
+type notification struct {
+	Cluster   string    `json:"cluster"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+	// Kinds are the kinds of the changes the alert is about: scale-up, scale-down, replacement or drift
+	Kinds []string `json:"kinds,omitempty"`
+	// Text makes the payload usable with Slack compatible incoming webhooks
+	Text string `json:"text"`
+}
+
+// notifier sends alerts about autoscaler actions to a webhook, and the alerts and scaling events
+// as CloudEvents to the event sink and the event bus
+type notifier struct {
+	url    string
+	client *http.Client
+	events *eventSink
+	bus    *eventBus
+	// source is the source of the CloudEvents
+	source string
+}
+
+func newNotifier(opts *Options) (*notifier, error) {
+	bus, err := newEventBus(opts.EventBus, opts.EventBusTopic)
+	if err != nil {
+		return nil, err
+	}
+	return &notifier{
+		url:    opts.NotifyWebhook,
+		client: &http.Client{Timeout: 10 * time.Second},
+		events: newEventSink(opts.CloudEventsSink),
+		bus:    bus,
+		source: opts.CloudEventsSource,
+	}, nil
+}
+
+// notify logs the alert and posts it to the webhook, if one is configured. The kinds of the
+// changes the alert is about are included in the payload.
+func (n *notifier) notify(cluster string, reason string, message string, changes ...Change) {
+	message = scrubSecrets(message)
+	glog.Warningf("%s: %s: %s", cluster, reason, message)
+	if n == nil {
+		return
+	}
+	n.event(eventAlert, cluster, &eventData{
+		Reason:  reason,
+		Message: message,
+		Kinds:   kinds(changes),
+	})
+	if n.url == "" {
+		return
+	}
+	payload := notification{
+		Cluster:   cluster,
+		Reason:    reason,
+		Message:   message,
+		Timestamp: time.Now().UTC(),
+		Kinds:     kinds(changes),
+		Text:      fmt.Sprintf("[%s] %s: %s", cluster, reason, message),
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		glog.Errorf("Error encoding notification %v", err)
+		return
+	}
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		glog.Errorf("Error sending notification %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		glog.Errorf("Error sending notification, webhook returned %s", resp.Status)
+	}
+}
@@ -0,0 +1,182 @@
+package autoscaler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// microversionRegexp matches the valid values of --compute-microversion and --network-microversion
+var microversionRegexp = regexp.MustCompile(`^([0-9]+\.[0-9]+|latest)$`)
+
+// defaultOptions are the defaults of the flags of the command, for the options whose zero value
+// is not usable, e.g. a zero --server-active-timeout would delete every server just created
+var defaultOptions = Options{
+	Sleep:               45,
+	CanaryTimeout:       10 * time.Minute,
+	BlueGreenTimeout:    30 * time.Minute,
+	MaxTaskDuration:     10 * time.Minute,
+	TaskRetryInterval:   10 * time.Second,
+	ServerActiveTimeout: 10 * time.Minute,
+	APIRetryMaxWait:     time.Minute,
+	DrainTimeout:        5 * time.Minute,
+	RecordKeep:          10,
+	CPUAllocationRatio:  16,
+	RAMAllocationRatio:  1.5,
+	PolicyTimeout:       30 * time.Second,
+	MetricsInterval:     time.Minute,
+	LBProvider:          lbProviderAuto,
+	CapacityPolicy:      capacityWarn,
+	UnreachableAPI:      unreachableApply,
+	CloudEventsSource:   "kops-autoscaler-openstack",
+	EventBusTopic:       "kops-autoscaler.events",
+}
+
+// SetDefaults sets the options left at their zero value, whose zero value is not usable, to the
+// defaults of the flags of the command. Options whose zero value disables something are kept.
+func (o *Options) SetDefaults() {
+	d := defaultOptions
+	if o.Sleep == 0 {
+		o.Sleep = d.Sleep
+	}
+	for _, f := range []struct {
+		value *time.Duration
+		def   time.Duration
+	}{
+		{&o.CanaryTimeout, d.CanaryTimeout},
+		{&o.BlueGreenTimeout, d.BlueGreenTimeout},
+		{&o.MaxTaskDuration, d.MaxTaskDuration},
+		{&o.TaskRetryInterval, d.TaskRetryInterval},
+		{&o.ServerActiveTimeout, d.ServerActiveTimeout},
+		{&o.APIRetryMaxWait, d.APIRetryMaxWait},
+		{&o.DrainTimeout, d.DrainTimeout},
+		{&o.PolicyTimeout, d.PolicyTimeout},
+		{&o.MetricsInterval, d.MetricsInterval},
+	} {
+		if *f.value == 0 {
+			*f.value = f.def
+		}
+	}
+	if o.RecordKeep == 0 {
+		o.RecordKeep = d.RecordKeep
+	}
+	if o.CPUAllocationRatio == 0 {
+		o.CPUAllocationRatio = d.CPUAllocationRatio
+	}
+	if o.RAMAllocationRatio == 0 {
+		o.RAMAllocationRatio = d.RAMAllocationRatio
+	}
+	for _, f := range []struct {
+		value *string
+		def   string
+	}{
+		{&o.LBProvider, d.LBProvider},
+		{&o.CapacityPolicy, d.CapacityPolicy},
+		{&o.UnreachableAPI, d.UnreachableAPI},
+		{&o.CloudEventsSource, d.CloudEventsSource},
+		{&o.EventBusTopic, d.EventBusTopic},
+	} {
+		if *f.value == "" {
+			*f.value = f.def
+		}
+	}
+}
+
+// Validate checks the options and their combinations. The errors name the flags of the command.
+func (o *Options) Validate() error {
+	if o.ClusterName == "" && !o.DiscoverAll {
+		return fmt.Errorf("Please set NAME to env variable or as start flag")
+	}
+	if o.StateStore == "" {
+		return fmt.Errorf("Please set KOPS_STATE_STORE to env variable or as start flag")
+	}
+	if o.Sleep <= 0 {
+		return fmt.Errorf("--sleep must be positive")
+	}
+	if o.DiscoverAll && o.Canary {
+		return fmt.Errorf("--canary can not be used with --discover-all, canary nodes are checked from the cluster the autoscaler is running in")
+	}
+	validPolicy := false
+	for _, p := range UnreachableAPIPolicies {
+		validPolicy = validPolicy || p == o.UnreachableAPI
+	}
+	if !validPolicy {
+		return fmt.Errorf("invalid --unreachable-api %q, must be one of %s", o.UnreachableAPI, strings.Join(UnreachableAPIPolicies, ", "))
+	}
+	if o.Output != "" && o.Output != "json" && o.Output != "yaml" {
+		return fmt.Errorf("--output must be json or yaml")
+	}
+	if o.Output != "" && !o.Once {
+		return fmt.Errorf("--output can be used only with --once")
+	}
+	if o.ZoneRebalance && !o.ScaleDown {
+		return fmt.Errorf("--zone-rebalance requires --scale-down, otherwise the replacement servers are never removed after the zone recovers")
+	}
+	if o.Once && o.ConfirmDrift {
+		return fmt.Errorf("--confirm-drift can not be used with --once, it needs two executions")
+	}
+	if (o.AdminTLSCertFile == "") != (o.AdminTLSKeyFile == "") {
+		return fmt.Errorf("--admin-tls-cert-file and --admin-tls-key-file must be set together")
+	}
+	if o.AdminTLSCertFile != "" && o.AdminAddress == "" && o.AdminGRPCAddress == "" {
+		return fmt.Errorf("--admin-tls-cert-file requires --admin-address or --admin-grpc-address")
+	}
+	if o.AuditLog != "" && o.AdminAddress == "" && o.AdminGRPCAddress == "" {
+		return fmt.Errorf("--audit-log requires --admin-address or --admin-grpc-address")
+	}
+	if o.VaultSecrets != "" && o.VaultAddress == "" {
+		return fmt.Errorf("--vault-secrets requires --vault-address or VAULT_ADDR")
+	}
+	if o.AdminClientCAFile != "" && o.AdminTLSCertFile == "" {
+		return fmt.Errorf("--admin-client-ca-file requires --admin-tls-cert-file")
+	}
+	if o.Once && (o.InitialDelay > 0 || o.InitialSplay > 0) {
+		return fmt.Errorf("--initial-delay and --initial-splay can not be used with --once, nothing would be applied")
+	}
+	for _, v := range []string{o.ComputeMicroversion, o.NetworkMicroversion} {
+		if v != "" && !microversionRegexp.MatchString(v) {
+			return fmt.Errorf("invalid microversion %q, must be like 2.52 or latest", v)
+		}
+	}
+	if o.ScaleUpOnly && o.ScaleDown {
+		return fmt.Errorf("--scale-up-only can not be used with --scale-down")
+	}
+	if o.CordonOnly && !o.ScaleDown {
+		return fmt.Errorf("--cordon-only needs --scale-down")
+	}
+	if o.DiscoverAll && o.ScaleDown {
+		return fmt.Errorf("--scale-down can not be used with --discover-all, nodes are drained in the cluster the autoscaler is running in")
+	}
+	if o.DiscoverAll && o.ResolveDuplicates {
+		return fmt.Errorf("--resolve-duplicates can not be used with --discover-all, nodes are read from the cluster the autoscaler is running in")
+	}
+	if o.MaxTaskDuration <= 0 || o.TaskRetryInterval <= 0 {
+		return fmt.Errorf("--max-task-duration and --task-retry-interval must be positive")
+	}
+	if o.IncrementalTaskBuild && o.TaskBuildInterval <= 0 {
+		return fmt.Errorf("--incremental-task-build requires --task-build-interval")
+	}
+	if o.DiscoverAll && o.CreateBatchWaitReady {
+		return fmt.Errorf("--create-batch-wait-ready can not be used with --discover-all, nodes are checked from the cluster the autoscaler is running in")
+	}
+	if o.APIRetries < 0 || o.APIRetryMaxWait <= 0 {
+		return fmt.Errorf("--api-retries must not be negative and --api-retry-max-wait must be positive")
+	}
+	if o.ServerActiveTimeout <= 0 {
+		return fmt.Errorf("--server-active-timeout must be positive")
+	}
+	if o.CanaryTimeout <= 0 || o.BlueGreenTimeout <= 0 || o.DrainTimeout <= 0 {
+		return fmt.Errorf("--canary-timeout, --blue-green-timeout and --drain-timeout must be positive")
+	}
+	if o.PolicyTimeout <= 0 || o.MetricsInterval <= 0 {
+		return fmt.Errorf("--policy-timeout and --metrics-interval must be positive")
+	}
+	if o.CreateBatchSize < 0 {
+		return fmt.Errorf("--create-batch-size must not be negative")
+	}
+	if o.CreateConcurrency < 0 || o.CreateRetries < 0 {
+		return fmt.Errorf("--create-concurrency and --create-retries must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package autoscaler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstacktasks"
+)
+
+// applyRetryBase is the delay before the first retry of a failed apply, doubled after each
+// further failure up to the interval of the cluster
+const applyRetryBase = 30 * time.Second
+
+// PartialApply describes the instances created and not created by an apply which failed
+type PartialApply struct {
+	PlanID     string   `json:"planID"`
+	Created    []string `json:"created"`
+	NotCreated []string `json:"notCreated"`
+}
+
+// partialApply returns the instances of the plan created by a failed apply, or nil if none was
+// created. Instance tasks get their ID when the server is created.
+func partialApply(plan *Plan) *PartialApply {
+	p := &PartialApply{PlanID: plan.ID}
+	for _, c := range plan.instanceCreates() {
+		i, ok := c.task.(*openstacktasks.Instance)
+		if ok && i.ID != nil {
+			p.Created = append(p.Created, c.Name)
+		} else {
+			p.NotCreated = append(p.NotCreated, c.Name)
+		}
+	}
+	if len(p.Created) == 0 {
+		return nil
+	}
+	sort.Strings(p.Created)
+	sort.Strings(p.NotCreated)
+	return p
+}
+
+// applyFailed reports the instances created before the apply of the plan failed. The changes of
+// the plan are requeued, so that the next execution retries the remaining ones without
+// confirmation or approval.
+func (osASG *openstackASG) applyFailed(plan *Plan, err error) error {
+	osASG.applyFailures++
+	osASG.requeued = make(map[string]bool)
+	for _, c := range plan.Changes {
+		osASG.requeued[c.String()] = true
+	}
+	osASG.requeuedPlanID = plan.ID
+
+	p := partialApply(plan)
+	if p == nil {
+		return err
+	}
+	osASG.markChanged(plan)
+	osASG.recordChurn(plan)
+	message := fmt.Sprintf("plan %s partially applied, created %s, not created %s: %v; plan: %s",
+		plan.ID, strings.Join(p.Created, ", "), strings.Join(p.NotCreated, ", "), err, osASG.summary(plan.Changes))
+	osASG.notifier.notify(osASG.clusterName, "PartialApply", message, plan.Changes...)
+	osASG.record("partially applied plan %s, created %s", plan.ID, strings.Join(p.Created, ", "))
+	if osASG.result != nil {
+		osASG.result.Partial = p
+	}
+	return fmt.Errorf("%s", message)
+}
+
+// clearRequeue clears the requeued changes and the retry backoff after a successful apply or
+// when nothing is left to apply
+func (osASG *openstackASG) clearRequeue() {
+	osASG.applyFailures = 0
+	osASG.requeued = nil
+	osASG.requeuedPlanID = ""
+}
+
+// requeuedRemainder returns true if all changes of the plan are left from a failed apply
+func (osASG *openstackASG) requeuedRemainder(plan *Plan) bool {
+	if len(osASG.requeued) == 0 {
+		return false
+	}
+	for _, c := range plan.Changes {
+		if !osASG.requeued[c.String()] {
+			return false
+		}
+	}
+	glog.Infof("Plan %s contains only changes left from failed apply of plan %s, retrying them\n", plan.ID, osASG.requeuedPlanID)
+	return true
+}
+
+// nextInterval returns the time until the next execution. After failed applies the remaining
+// changes are retried sooner, backing off up to the interval.
+func (osASG *openstackASG) nextInterval() time.Duration {
+	interval := osASG.interval()
+	if osASG.applyFailures == 0 {
+		return interval
+	}
+	backoff := applyRetryBase
+	for i := 1; i < osASG.applyFailures && backoff < interval; i++ {
+		backoff *= 2
+	}
+	if backoff > interval {
+		return interval
+	}
+	return backoff
+}
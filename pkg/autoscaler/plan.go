@@ -0,0 +1,278 @@
+package autoscaler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unsafe"
+
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+const (
+	actionCreate = "create"
+	actionUpdate = "update"
+	actionDelete = "delete"
+)
+
+// kinds classify the changes for logs, metrics and notifications
+const (
+	kindScaleUp     = "scale-up"
+	kindScaleDown   = "scale-down"
+	kindReplacement = "replacement"
+	kindDrift       = "drift"
+)
+
+var changeKinds = []string{kindScaleUp, kindScaleDown, kindReplacement, kindDrift}
+
+// Change describes a single task that the dry-run would create, update or delete
+type Change struct {
+	Key    string   `json:"key"`
+	Type   string   `json:"type"`
+	Name   string   `json:"name"`
+	Action string   `json:"action"`
+	Fields []string `json:"fields,omitempty"`
+	// Kind is scale-up, scale-down, replacement or drift. It is not part of the plan ID.
+	Kind string `json:"kind,omitempty"`
+	// Diff shows the changed user data of a server, with secrets masked
+	Diff string `json:"diff,omitempty"`
+
+	task fi.Task
+	// serverID is set for servers deleted by scale down
+	serverID string
+}
+
+// Plan contains the changes found by a single dry-run of a cluster
+type Plan struct {
+	ID         string     `json:"id"`
+	Cluster    string     `json:"cluster"`
+	Created    time.Time  `json:"created"`
+	Changes    []Change   `json:"changes"`
+	Approved   bool       `json:"approved"`
+	ApprovedBy string     `json:"approvedBy,omitempty"`
+	ApprovedAt *time.Time `json:"approvedAt,omitempty"`
+	// CloudOnly is set when the API server is not reachable. Servers are then created without
+	// canary and not deleted, as their nodes can not be drained.
+	CloudOnly bool `json:"-"`
+
+	// ignored contains the changes the autoscaler is configured not to act on
+	ignored []Change
+	// postponed contains the changes of instance groups whose interval has not passed
+	postponed []Change
+	// portFixes are the ports to attach missing security groups to
+	portFixes []*portDrift
+	// tagFixes are the servers to add missing metadata to
+	tagFixes []*metadataDrift
+	// poolFix are the members to add to and remove from the API load balancer pool
+	poolFix *poolDrift
+	// rolloutSteps move the blue/green rollouts to their next phase
+	rolloutSteps []*rolloutStep
+}
+
+func newPlan(cluster string, changes []Change) *Plan {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].String() < changes[j].String()
+	})
+	h := sha256.New()
+	for _, c := range changes {
+		fmt.Fprintln(h, c.String())
+	}
+	return &Plan{
+		ID:      hex.EncodeToString(h.Sum(nil))[:12],
+		Cluster: cluster,
+		Created: time.Now().UTC(),
+		Changes: changes,
+	}
+}
+
+func (c Change) String() string {
+	if len(c.Fields) == 0 {
+		return fmt.Sprintf("%s %s", c.Action, c.Key)
+	}
+	return fmt.Sprintf("%s %s (%s)", c.Action, c.Key, strings.Join(c.Fields, ", "))
+}
+
+// needsUpdate returns true if the plan contains changes to instances
+func (p *Plan) needsUpdate() bool {
+	return instanceChanges(p.Changes)
+}
+
+// instanceChanges returns true if any of the changes is to an instance
+func instanceChanges(changes []Change) bool {
+	for _, c := range changes {
+		if c.Type == "Instance" {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns human readable description of the plan
+func (p *Plan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Plan %s for cluster %s:\n", p.ID, p.Cluster)
+	for _, c := range p.Changes {
+		fmt.Fprintf(&b, "  [%s] %s\n", c.Kind, c.String())
+	}
+	return b.String()
+}
+
+// kinds returns the distinct kinds of the changes
+func kinds(changes []Change) []string {
+	found := make(map[string]bool)
+	for _, c := range changes {
+		found[c.Kind] = true
+	}
+	var list []string
+	for _, kind := range changeKinds {
+		if found[kind] {
+			list = append(list, kind)
+		}
+	}
+	return list
+}
+
+// dryRunChanges reads the changes collected by a finished dry-run. The vendored kops
+// does not expose them from fi.DryRunTarget yet, so the unexported fields are read with reflection.
+// An error is returned if the fields are not the expected ones, e.g. after updating kops.
+func dryRunChanges(target *fi.DryRunTarget, taskMap map[string]fi.Task) ([]Change, error) {
+	keys := make(map[fi.Task]string)
+	for k, t := range taskMap {
+		keys[t] = k
+	}
+
+	var changes []Change
+	v := reflect.ValueOf(target).Elem()
+	renders, err := unexportedField(v, "changes")
+	if err != nil {
+		return nil, err
+	}
+	if renders.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("unexpected type %s of field changes of %s", renders.Type(), v.Type())
+	}
+	for i := 0; i < renders.Len(); i++ {
+		r := renders.Index(i)
+		if r.Kind() == reflect.Ptr {
+			r = r.Elem()
+		}
+		f, err := unexportedField(r, "e")
+		if err != nil {
+			return nil, err
+		}
+		e, ok := f.Interface().(fi.Task)
+		if !ok {
+			return nil, fmt.Errorf("unexpected type %s of field e of %s", f.Type(), r.Type())
+		}
+		c := Change{
+			Key:    keys[e],
+			Type:   fi.TypeNameForTask(e),
+			Action: actionCreate,
+			Kind:   kindDrift,
+			task:   e,
+		}
+		if c.Type == "Instance" {
+			c.Kind = kindScaleUp
+		}
+		if c.Key == "" {
+			c.Key = c.Type + "/" + taskName(e)
+		}
+		c.Name = strings.TrimPrefix(c.Key, c.Type+"/")
+		aIsNil, err := unexportedField(r, "aIsNil")
+		if err != nil {
+			return nil, err
+		}
+		if aIsNil.Kind() != reflect.Bool {
+			return nil, fmt.Errorf("unexpected type %s of field aIsNil of %s", aIsNil.Type(), r.Type())
+		}
+		if !aIsNil.Bool() {
+			fields, err := unexportedField(r, "changes")
+			if err != nil {
+				return nil, err
+			}
+			c.Action = actionUpdate
+			c.Kind = kindDrift
+			c.Fields = changedFields(fields.Interface())
+		}
+		changes = append(changes, c)
+	}
+
+	deletions, err := unexportedField(v, "deletions")
+	if err != nil {
+		return nil, err
+	}
+	if deletions.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("unexpected type %s of field deletions of %s", deletions.Type(), v.Type())
+	}
+	for i := 0; i < deletions.Len(); i++ {
+		d, ok := deletions.Index(i).Interface().(fi.Deletion)
+		if !ok {
+			return nil, fmt.Errorf("unexpected type %s of deletion of %s", deletions.Index(i).Type(), v.Type())
+		}
+		changes = append(changes, Change{
+			Key:    d.TaskName() + "/" + d.Item(),
+			Type:   d.TaskName(),
+			Name:   d.Item(),
+			Action: actionDelete,
+			Kind:   kindDrift,
+		})
+	}
+	return changes, nil
+}
+
+// changedFields returns the names of the fields which are set in a changes task
+func changedFields(changes interface{}) []string {
+	v := reflect.ValueOf(changes)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields []string
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.PkgPath != "" || f.Name == "Lifecycle" {
+			continue
+		}
+		if isZero(v.Field(i)) {
+			continue
+		}
+		fields = append(fields, f.Name)
+	}
+	return fields
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+func taskName(t fi.Task) string {
+	if hn, ok := t.(fi.HasName); ok {
+		return fi.StringValue(hn.GetName())
+	}
+	return "?"
+}
+
+// unexportedField returns the named field of the addressable struct v, also if it is unexported.
+// An error is returned if v has no such field.
+func unexportedField(v reflect.Value, name string) (reflect.Value, error) {
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("error reading field %s: %s is not a struct", name, v.Type())
+	}
+	f := v.FieldByName(name)
+	if !f.IsValid() {
+		return reflect.Value{}, fmt.Errorf("error reading field %s: %s has no such field, the vendored kops is not the expected version", name, v.Type())
+	}
+	return reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem(), nil
+}
@@ -0,0 +1,30 @@
+package autoscaler
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+func TestDryRunChanges(t *testing.T) {
+	// fails if the vendored kops renames the fields of fi.DryRunTarget which are read with reflection
+	changes, err := dryRunChanges(&fi.DryRunTarget{}, nil)
+	if err != nil {
+		t.Fatalf("dryRunChanges: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("got %d changes, want none", len(changes))
+	}
+}
+
+func TestUnexportedField(t *testing.T) {
+	v := reflect.ValueOf(&struct{ name string }{name: "a"}).Elem()
+	f, err := unexportedField(v, "name")
+	if err != nil || f.String() != "a" {
+		t.Errorf("unexportedField(name) = %v, %v, want a", f, err)
+	}
+	if _, err := unexportedField(v, "missing"); err == nil {
+		t.Errorf("unexportedField(missing) returned no error")
+	}
+}
@@ -0,0 +1,181 @@
+package autoscaler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	"github.com/golang/glog"
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+// decisions of the policy plugins
+const (
+	policyAllow  = "allow"
+	policyDeny   = "deny"
+	policyModify = "modify"
+)
+
+// PolicyRequest is the input of the policy plugins: the plan about to be applied and the sizes
+// and servers of the instance groups
+type PolicyRequest struct {
+	Cluster        string                         `json:"cluster"`
+	Plan           *Plan                          `json:"plan"`
+	InstanceGroups map[string]*InstanceGroupCount `json:"instanceGroups"`
+}
+
+// PolicyResponse is the output of a policy plugin. Decision is allow, deny or modify. With modify,
+// Drop are the keys of the changes not to apply in this execution, e.g. Instance/nodes-3-example-k8s-local.
+// Only changes of servers can be dropped, and the other changes of the same servers are dropped with them.
+type PolicyResponse struct {
+	Decision string   `json:"decision"`
+	Reason   string   `json:"reason,omitempty"`
+	Drop     []string `json:"drop,omitempty"`
+}
+
+// policyRequest returns the input of the policy plugins for the plan
+func (osASG *openstackASG) policyRequest(plan *Plan) *PolicyRequest {
+	req := &PolicyRequest{
+		Cluster:        osASG.clusterName,
+		Plan:           plan,
+		InstanceGroups: make(map[string]*InstanceGroupCount),
+	}
+	for _, ig := range osASG.instanceGroups {
+		req.InstanceGroups[ig.ObjectMeta.Name] = &InstanceGroupCount{
+			MinSize: int(fi.Int32Value(ig.Spec.MinSize)),
+			MaxSize: int(fi.Int32Value(ig.Spec.MaxSize)),
+			Servers: osASG.serverCounts[ig.ObjectMeta.Name],
+		}
+	}
+	return req
+}
+
+// checkPolicies consults the policy plugins in order before the plan is applied. It returns the
+// reason when a plugin denies the plan. The changes dropped by the plugins are removed from the
+// plan and postponed. A plugin which fails or answers with an unknown decision fails the execution.
+func (osASG *openstackASG) checkPolicies(plan *Plan) (string, error) {
+	for _, plugin := range splitList(osASG.opts.PolicyPlugins) {
+		resp, err := osASG.callPolicy(plugin, osASG.policyRequest(plan))
+		if err != nil {
+			return "", fmt.Errorf("error consulting policy plugin %s: %v", plugin, err)
+		}
+		switch resp.Decision {
+		case policyAllow:
+		case policyDeny:
+			return fmt.Sprintf("denied by policy plugin %s: %s", plugin, resp.Reason), nil
+		case policyModify:
+			if err := osASG.dropChanges(plan, resp.Drop); err != nil {
+				return "", fmt.Errorf("invalid answer of policy plugin %s: %v", plugin, err)
+			}
+			glog.Infof("Policy plugin %s dropped %s from plan %s: %s\n", plugin, strings.Join(resp.Drop, ", "), plan.ID, resp.Reason)
+			osASG.record("policy plugin %s dropped %d changes", plugin, len(resp.Drop))
+		default:
+			return "", fmt.Errorf("policy plugin %s answered unknown decision %q", plugin, resp.Decision)
+		}
+	}
+	return "", nil
+}
+
+// dropChanges removes the servers of the changes from the plan and postpones them
+func (osASG *openstackASG) dropChanges(plan *Plan, keys []string) error {
+	servers := make(map[string]bool)
+	for _, key := range keys {
+		server := ""
+		for _, c := range plan.Changes {
+			if c.Key == key {
+				server = changeInstance(c)
+				if server == "" {
+					return fmt.Errorf("%s is not a change of a server", key)
+				}
+			}
+		}
+		if server == "" {
+			return fmt.Errorf("%s is not in plan %s", key, plan.ID)
+		}
+		servers[server] = true
+	}
+	var changes []Change
+	for _, c := range plan.Changes {
+		if servers[changeInstance(c)] {
+			plan.postponed = append(plan.postponed, c)
+			continue
+		}
+		changes = append(changes, c)
+	}
+	plan.Changes = changes
+	if osASG.postponed == nil {
+		osASG.postponed = make(map[string]bool)
+	}
+	for server := range servers {
+		osASG.postponed[server] = true
+	}
+	return nil
+}
+
+// callPolicy sends the request to the plugin: an http or https URL gets it as POST body, and
+// other plugins are executed with the request in standard input. The answer is read from the
+// response body or standard output.
+func (osASG *openstackASG) callPolicy(plugin string, req *PolicyRequest) (*PolicyResponse, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(osASG.ctx())
+	if osASG.opts.PolicyTimeout > 0 {
+		ctx, cancel = context.WithTimeout(osASG.ctx(), osASG.opts.PolicyTimeout)
+	}
+	defer cancel()
+
+	var out []byte
+	if strings.HasPrefix(plugin, "http://") || strings.HasPrefix(plugin, "https://") {
+		out, err = postPolicy(ctx, plugin, data)
+	} else {
+		out, err = execPolicy(ctx, plugin, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp := &PolicyResponse{}
+	if err := json.Unmarshal(out, resp); err != nil {
+		return nil, fmt.Errorf("error parsing answer: %v", err)
+	}
+	return resp, nil
+}
+
+func postPolicy(ctx context.Context, url string, data []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("plugin returned %s", resp.Status)
+	}
+	return body, nil
+}
+
+func execPolicy(ctx context.Context, path string, data []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,103 @@
+package autoscaler
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// registryDirs are the directories of a cluster in the state store polled for changes: the
+// cluster spec, the instance groups and the pending plan
+var registryDirs = []string{"", "instancegroup", "autoscaler"}
+
+// reconcile runs a full execution of the cluster when its specs in state store have changed,
+// the full interval has passed or the previous execution left work pending. Otherwise only the
+// ETags of the specs are polled.
+func (osASG *openstackASG) reconcile() error {
+	if osASG.opts.FullInterval <= 0 {
+		return osASG.fullReconcile()
+	}
+	etags, err := osASG.registryETags()
+	if err == nil && osASG.sizeOverrides != nil {
+		// changed size overrides need the full execution as well
+		etags += "," + osASG.sizeOverrides.resourceVersion()
+	}
+	if err != nil {
+		glog.Warningf("Error polling state store of %s: %v", osASG.clusterName, err)
+	} else if etags == osASG.etags && time.Since(osASG.fullAt) < osASG.opts.FullInterval {
+		glog.Infof("Specs of %s are unchanged, skipping execution\n", osASG.clusterName)
+		osASG.record("skipped, specs unchanged")
+		return nil
+	}
+
+	osASG.etags = ""
+	if err := osASG.fullReconcile(); err != nil {
+		return err
+	}
+	// a plan waiting for confirmation or the initial delay needs the next execution
+	if etags != "" && osASG.lastPlanID == "" && osASG.delayed() == "" {
+		osASG.etags = etags
+		osASG.fullAt = time.Now()
+	}
+	return nil
+}
+
+// registryETags lists the files of the cluster in the state store and returns their ETags.
+// Only the object metadata is read, not the content.
+func (osASG *openstackASG) registryETags() (string, error) {
+	registryBase, err := vfs.Context.BuildVfsPath(osASG.opts.StateStore)
+	if err != nil {
+		return "", fmt.Errorf("error parsing registry path %q: %v", osASG.opts.StateStore, err)
+	}
+	base := registryBase.Join(osASG.clusterName)
+
+	var etags []string
+	for _, dir := range registryDirs {
+		p := base
+		if dir != "" {
+			p = base.Join(dir)
+		}
+		start := time.Now()
+		files, err := p.ReadDir()
+		if err != nil && os.IsNotExist(err) {
+			err = nil
+		}
+		observeStateStore(backendOf(p), "poll_etags", start, err)
+		if err != nil {
+			return "", fmt.Errorf("error listing %s: %v", p.Path(), err)
+		}
+		for _, f := range files {
+			if dir == "" && f.Base() != "config" {
+				continue
+			}
+			etag, err := fileETag(f)
+			if err != nil {
+				return "", err
+			}
+			etags = append(etags, etag)
+		}
+	}
+	sort.Strings(etags)
+	return strings.Join(etags, "\n"), nil
+}
+
+// fileETag returns the path and the ETag of the file listed from the state store
+func fileETag(f vfs.Path) (string, error) {
+	h, ok := f.(vfs.HasHash)
+	if !ok {
+		return "", fmt.Errorf("%s has no ETag", f.Path())
+	}
+	hash, err := h.PreferredHash()
+	if err != nil {
+		return "", err
+	}
+	if hash == nil {
+		return "", fmt.Errorf("%s has no ETag", f.Path())
+	}
+	return f.Path() + "=" + hash.Hex(), nil
+}
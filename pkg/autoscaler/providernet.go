@@ -0,0 +1,166 @@
+package autoscaler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstacktasks"
+)
+
+const (
+	// annotationProviderNetwork puts the servers of the instance group to a provider network, given by name or ID
+	annotationProviderNetwork = annotationPrefix + "provider-network"
+	// annotationProviderSubnet selects the subnets of the provider network the addresses are allocated
+	// from, one per IP version on dual-stack networks
+	annotationProviderSubnet = annotationPrefix + "provider-subnet"
+)
+
+// providerPortSuffix is appended to the names of the ports in provider networks. Kops finds the port of
+// an instance by name and fails when the port with that name is not in the cluster network.
+const providerPortSuffix = "-provider"
+
+// providerNetwork is the resolved provider network of an instance group
+type providerNetwork struct {
+	name      string
+	networkID string
+	subnetIDs []string
+}
+
+// resolveProviderNetwork finds the provider network and subnet of the instance group. Returns nil
+// if the instance group is in the cluster network, or a description of the problem if the
+// annotations do not match the cloud or can not work with the cluster.
+func resolveProviderNetwork(cloud openstack.OpenstackCloud, cluster *kops.Cluster, ig *kops.InstanceGroup) (*providerNetwork, string) {
+	network := ig.ObjectMeta.Annotations[annotationProviderNetwork]
+	subnet := ig.ObjectMeta.Annotations[annotationProviderSubnet]
+	if network == "" {
+		if subnet != "" {
+			return nil, fmt.Sprintf("%s needs %s", annotationProviderSubnet, annotationProviderNetwork)
+		}
+		return nil, ""
+	}
+	// the API load balancer pool and etcd find the masters by their address in the cluster network
+	if ig.Spec.Role == kops.InstanceGroupRoleMaster {
+		return nil, "masters can not be in a provider network"
+	}
+
+	found, err := cloud.ListNetworks(networks.ListOpts{Name: network})
+	if err == nil && len(found) == 0 {
+		found, err = cloud.ListNetworks(networks.ListOpts{ID: network})
+	}
+	switch {
+	case err != nil:
+		return nil, fmt.Sprintf("error finding provider network %q: %v", network, err)
+	case len(found) == 0:
+		return nil, fmt.Sprintf("provider network %q not found", network)
+	case len(found) > 1:
+		return nil, fmt.Sprintf("%d networks named %q", len(found), network)
+	case found[0].Name == cluster.ObjectMeta.Name:
+		return nil, fmt.Sprintf("provider network %q is the cluster network", network)
+	}
+	pn := &providerNetwork{name: found[0].Name, networkID: found[0].ID}
+
+	if subnet == "" {
+		list, err := cloud.ListSubnets(subnets.ListOpts{NetworkID: pn.networkID, IPVersion: 4})
+		switch {
+		case err != nil:
+			return nil, fmt.Sprintf("error finding subnets of provider network %q: %v", network, err)
+		case len(list) == 0:
+			return nil, fmt.Sprintf("provider network %q has no IPv4 subnets", network)
+		}
+		return pn, ""
+	}
+	versions := make(map[int]string)
+	for _, name := range splitList(subnet) {
+		list, err := cloud.ListSubnets(subnets.ListOpts{NetworkID: pn.networkID, Name: name})
+		if err == nil && len(list) == 0 {
+			list, err = cloud.ListSubnets(subnets.ListOpts{NetworkID: pn.networkID, ID: name})
+		}
+		switch {
+		case err != nil:
+			return nil, fmt.Sprintf("error finding subnets of provider network %q: %v", network, err)
+		case len(list) == 0:
+			return nil, fmt.Sprintf("subnet %q not found in provider network %q", name, network)
+		case len(list) > 1:
+			return nil, fmt.Sprintf("%d subnets named %q in provider network %q", len(list), name, network)
+		case versions[list[0].IPVersion] != "":
+			return nil, fmt.Sprintf("subnets %q and %q are both IPv%d", versions[list[0].IPVersion], name, list[0].IPVersion)
+		}
+		versions[list[0].IPVersion] = name
+		pn.subnetIDs = append(pn.subnetIDs, list[0].ID)
+	}
+	// the embedded kops configures the nodes with their IPv4 address
+	if versions[4] == "" {
+		return nil, fmt.Sprintf("%s has no IPv4 subnet", annotationProviderSubnet)
+	}
+	return pn, ""
+}
+
+// providerNetworkOf returns the provider network of the server, or nil if it is in the cluster network
+func (osASG *openstackASG) providerNetworkOf(server string) *providerNetwork {
+	return osASG.providerNetworks[osASG.instanceGroupFor(server)]
+}
+
+// providerNetworkChange returns true for the ports and floating IPs of servers in provider networks.
+// Their ports have another name than kops expects, so the dry-run finds them missing on every
+// execution, and they have no floating IPs.
+func (osASG *openstackASG) providerNetworkChange(c Change) bool {
+	if c.Action != actionCreate || (c.Type != "Port" && c.Type != "FloatingIP") {
+		return false
+	}
+	return osASG.providerNetworkOf(changeInstance(c)) != nil
+}
+
+// providerFloatingIP returns true for the floating IP tasks of servers in provider networks
+func (osASG *openstackASG) providerFloatingIP(task fi.Task) bool {
+	f, ok := task.(*openstacktasks.FloatingIP)
+	if !ok || f.Server == nil {
+		return false
+	}
+	return osASG.providerNetworkOf(taskName(f.Server)) != nil
+}
+
+func (c *instanceCloud) CreatePort(opt ports.CreateOptsBuilder) (*ports.Port, error) {
+	port, err := c.createPort(opt)
+	c.checkQuota(err)
+	return port, err
+}
+
+// createPort creates the ports of servers in provider networks in the provider network, with
+// the address from the subnet of the instance group. A port left by an earlier attempt is reused.
+// The other ports are spread over the subnets of the instance group.
+func (c *instanceCloud) createPort(opt ports.CreateOptsBuilder) (*ports.Port, error) {
+	o, ok := opt.(ports.CreateOpts)
+	if !ok {
+		return c.OpenstackCloud.CreatePort(opt)
+	}
+	server := strings.TrimPrefix(o.Name, "port-")
+	pn := c.providerNetworks[instanceGroupOf(c.clusterName, c.instanceGroups, server)]
+	if pn == nil {
+		return c.createSpreadPort(o, server)
+	}
+	o.Name += providerPortSuffix
+	existing, err := c.ListPorts(ports.ListOpts{Name: o.Name, NetworkID: pn.networkID})
+	if err != nil {
+		return nil, fmt.Errorf("error finding port %s: %v", o.Name, err)
+	}
+	if len(existing) > 0 {
+		return &existing[0], nil
+	}
+	o.NetworkID = pn.networkID
+	var fixedIPs []ports.IP
+	for _, id := range pn.subnetIDs {
+		fixedIPs = append(fixedIPs, ports.IP{SubnetID: id})
+	}
+	if len(fixedIPs) > 0 {
+		o.FixedIPs = fixedIPs
+	}
+	glog.Infof("Creating port %s in provider network %s\n", o.Name, pn.name)
+	return c.OpenstackCloud.CreatePort(o)
+}
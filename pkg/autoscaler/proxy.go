@@ -0,0 +1,69 @@
+package autoscaler
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// setSwiftClient sets the Swift client of the kops VFS context to one which connects through the
+// proxy from the environment, before the state store is first used. The client is built like the
+// embedded kops builds it.
+func setSwiftClient(stateStore string) error {
+	if !strings.HasPrefix(stateStore, "swift://") {
+		return nil
+	}
+	f, err := unexportedField(reflect.ValueOf(&vfs.Context).Elem(), "swiftClient")
+	if err != nil {
+		return err
+	}
+	if !f.IsNil() {
+		return nil
+	}
+
+	config := vfs.OpenstackConfig{}
+	authOption, err := config.GetCredential()
+	if err != nil {
+		return err
+	}
+	provider, err := openstack.NewClient(authOption.IdentityEndpoint)
+	if err != nil {
+		return fmt.Errorf("error building openstack provider client: %v", err)
+	}
+	provider.HTTPClient = http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	if err := openstack.Authenticate(provider, authOption); err != nil {
+		return fmt.Errorf("error building openstack authenticated client: %v", err)
+	}
+
+	var endpointOpt gophercloud.EndpointOpts
+	if region, err := config.GetRegion(); err != nil {
+		glog.Warningf("Retrieving swift configuration from openstack config file: %v", err)
+		endpointOpt, err = config.GetServiceConfig("Swift")
+		if err != nil {
+			return err
+		}
+	} else {
+		endpointOpt = gophercloud.EndpointOpts{
+			Type:   "object-store",
+			Region: region,
+		}
+	}
+	client, err := openstack.NewObjectStorageV1(provider, endpointOpt)
+	if err != nil {
+		return fmt.Errorf("error building swift client: %v", err)
+	}
+	f.Set(reflect.ValueOf(client))
+	return nil
+}
@@ -0,0 +1,63 @@
+package autoscaler
+
+import (
+	"fmt"
+)
+
+// etcdMembers returns the number of members in the largest etcd cluster of the cluster
+func (osASG *openstackASG) etcdMembers() int {
+	members := 0
+	for _, etcd := range osASG.ApplyCmd.Cluster.Spec.EtcdClusters {
+		if len(etcd.Members) > members {
+			members = len(etcd.Members)
+		}
+	}
+	return members
+}
+
+// quorumViolation returns description of why the plan would break etcd quorum, or empty string
+// if the plan does not change the number of masters or the new number is safe. The number of
+// masters must stay at least the quorum of the etcd members and must not become even, as an even
+// number of members tolerates no more failures than one member less.
+func (osASG *openstackASG) quorumViolation(plan *Plan) (string, error) {
+	masters := osASG.masterInstanceGroups()
+	delta := 0
+	for _, c := range plan.Changes {
+		if c.Type != "Instance" || !masters[osASG.instanceGroupFor(c.Name)] {
+			continue
+		}
+		switch c.Action {
+		case actionCreate:
+			delta++
+		case actionDelete:
+			delta--
+		}
+	}
+	if delta == 0 {
+		return "", nil
+	}
+
+	cloud, err := osASG.openstackCloud()
+	if err != nil {
+		return "", err
+	}
+	list, err := clusterServers(cloud, osASG.clusterName)
+	if err != nil {
+		return "", err
+	}
+	current := 0
+	for _, s := range list {
+		if masters[osASG.instanceGroupFor(s.Name)] {
+			current++
+		}
+	}
+	after := current + delta
+
+	if quorum := osASG.etcdMembers()/2 + 1; after < quorum {
+		return fmt.Sprintf("plan %s would leave %d masters, etcd with %d members needs %d for quorum", plan.ID, after, osASG.etcdMembers(), quorum), nil
+	}
+	if after%2 == 0 {
+		return fmt.Sprintf("plan %s would change the number of masters from %d to even %d", plan.ID, current, after), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,35 @@
+package autoscaler
+
+import (
+	"regexp"
+)
+
+// quotaMessage matches the errors of Nova, Neutron and Cinder for requests over the project quota
+var quotaMessage = regexp.MustCompile(`(?i)quota exceeded|overquota|exceeds .*quota|quotaerror`)
+
+// quotaExceeded returns true if the error is a request rejected by quota
+func quotaExceeded(err error) bool {
+	for e := err; e != nil; e = cause(e) {
+		if _, ok := e.(*ErrQuotaExceeded); ok {
+			return true
+		}
+	}
+	return err != nil && quotaMessage.MatchString(err.Error())
+}
+
+// checkQuota remembers the error if it is a create rejected by quota
+func (c *instanceCloud) checkQuota(err error) {
+	if !quotaExceeded(err) {
+		return
+	}
+	c.quotaMu.Lock()
+	defer c.quotaMu.Unlock()
+	c.quotaError = err.Error()
+}
+
+// quotaRejection returns the latest create rejected by quota, or empty string
+func (c *instanceCloud) quotaRejection() string {
+	c.quotaMu.Lock()
+	defer c.quotaMu.Unlock()
+	return c.quotaError
+}
@@ -0,0 +1,100 @@
+package autoscaler
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// triggerLimiter throttles externally triggered executions per caller and globally, so that
+// a misbehaving client can not force back-to-back executions
+type triggerLimiter struct {
+	callerInterval time.Duration
+	global         *rate.Limiter
+
+	mu      sync.Mutex
+	callers map[string]*callerLimit
+}
+
+type callerLimit struct {
+	limiter *rate.Limiter
+	last    time.Time
+}
+
+// newTriggerLimiter returns a limiter with its own callers, which shares the global limit with
+// the limiters given the same global, nil disables the global limit
+func newTriggerLimiter(callerInterval time.Duration, global *rate.Limiter) *triggerLimiter {
+	return &triggerLimiter{
+		callerInterval: callerInterval,
+		global:         global,
+		callers:        make(map[string]*callerLimit),
+	}
+}
+
+// newGlobalLimiter returns the limiter of the executions triggered by anyone, nil if interval is 0
+func newGlobalLimiter(interval time.Duration) *rate.Limiter {
+	if interval <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Every(interval), 1)
+}
+
+// allow returns zero if the caller may trigger an execution now, otherwise the time to wait
+func (l *triggerLimiter) allow(caller string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for name, c := range l.callers {
+		if now.Sub(c.last) > l.callerInterval {
+			delete(l.callers, name)
+		}
+	}
+
+	var reservations []*rate.Reservation
+	if l.callerInterval > 0 {
+		c := l.callers[caller]
+		if c == nil {
+			c = &callerLimit{limiter: rate.NewLimiter(rate.Every(l.callerInterval), 1)}
+			l.callers[caller] = c
+		}
+		c.last = now
+		reservations = append(reservations, c.limiter.ReserveN(now, 1))
+	}
+	if l.global != nil {
+		reservations = append(reservations, l.global.ReserveN(now, 1))
+	}
+
+	var wait time.Duration
+	for _, r := range reservations {
+		if d := r.DelayFrom(now); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+	}
+	return wait
+}
+
+// limitKey identifies the caller by the authenticated identity, or by the address of anonymous callers
+func limitKey(r *http.Request, caller string) string {
+	if caller != "" && caller != "anonymous" {
+		return caller
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// retryAfter formats the wait as Retry-After header value in whole seconds
+func retryAfter(wait time.Duration) string {
+	return strconv.Itoa(int((wait + time.Second - 1) / time.Second))
+}
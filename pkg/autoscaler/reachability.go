@@ -0,0 +1,152 @@
+package autoscaler
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/dns"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+// policies for applying into a cluster whose API server does not respond
+const (
+	unreachableApply     = "apply"
+	unreachableCloudOnly = "cloud-only"
+	unreachableAbort     = "abort"
+)
+
+// UnreachableAPIPolicies are the valid values of --unreachable-api
+var UnreachableAPIPolicies = []string{unreachableApply, unreachableCloudOnly, unreachableAbort}
+
+// apiProbe checks the API server endpoints. Any HTTP response means that the API server is
+// reachable, so the certificate is not verified and the response is not authenticated.
+var apiProbe = &http.Client{
+	Timeout: 5 * time.Second,
+	Transport: &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	},
+}
+
+// apiEndpoints returns the hosts the API server of the cluster is reached at: the master public
+// name with DNS, the load balancer with gossip or the addresses of the masters.
+func (osASG *openstackASG) apiEndpoints(cloud openstack.OpenstackCloud, list []servers.Server) ([]string, error) {
+	cluster := osASG.ApplyCmd.Cluster
+	if !dns.IsGossipHostname(osASG.clusterName) {
+		return []string{cluster.Spec.MasterPublicName}, nil
+	}
+	if cluster.Spec.API != nil && cluster.Spec.API.LoadBalancer != nil {
+		lbs, err := cloud.ListLBs(loadbalancers.ListOpts{Name: cluster.Spec.MasterPublicName})
+		if err != nil {
+			return nil, fmt.Errorf("error listing load balancers: %v", err)
+		}
+		var hosts []string
+		for _, lb := range lbs {
+			hosts = append(hosts, lb.VipAddress)
+		}
+		return hosts, nil
+	}
+
+	masters := osASG.masterInstanceGroups()
+	fips, err := cloud.ListFloatingIPs()
+	if err != nil {
+		return nil, fmt.Errorf("error listing floating IPs: %v", err)
+	}
+	var hosts []string
+	for _, s := range list {
+		if !masters[osASG.instanceGroupFor(s.Name)] {
+			continue
+		}
+		for _, fip := range fips {
+			if fip.InstanceID == s.ID {
+				hosts = append(hosts, fip.IP)
+			}
+		}
+		hosts = append(hosts, fixedAddresses(&s, osASG.clusterName)...)
+	}
+	return hosts, nil
+}
+
+// masterInstanceGroups returns the names of the master instance groups
+func (osASG *openstackASG) masterInstanceGroups() map[string]bool {
+	masters := make(map[string]bool)
+	for _, ig := range osASG.ApplyCmd.InstanceGroups {
+		if ig.Spec.Role == kops.InstanceGroupRoleMaster {
+			masters[ig.ObjectMeta.Name] = true
+		}
+	}
+	return masters
+}
+
+// apiUnreachable returns description of why the API server of the cluster is unreachable, or
+// empty string if any of its endpoints responds
+func (osASG *openstackASG) apiUnreachable() (string, error) {
+	cloud, err := osASG.openstackCloud()
+	if err != nil {
+		return "", err
+	}
+	list, err := clusterServers(cloud, osASG.clusterName)
+	if err != nil {
+		return "", err
+	}
+	hosts, err := osASG.apiEndpoints(cloud, list)
+	if err != nil {
+		return "", err
+	}
+	if len(hosts) == 0 {
+		return "no API server endpoints found", nil
+	}
+	var errs []string
+	for _, host := range hosts {
+		resp, err := apiProbe.Get("https://" + net.JoinHostPort(host, "443") + "/healthz")
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		resp.Body.Close()
+		return "", nil
+	}
+	return "API server is unreachable: " + strings.Join(errs, ", "), nil
+}
+
+// createsMasters returns true if the plan creates master servers. The API server is not expected
+// to respond while masters are missing, and creating them is how the cluster recovers.
+func (osASG *openstackASG) createsMasters(plan *Plan) bool {
+	masters := osASG.masterInstanceGroups()
+	for _, c := range plan.instanceCreates() {
+		if masters[osASG.instanceGroupFor(c.Name)] {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAPI checks that the API server responds before applying the plan, when --unreachable-api
+// is cloud-only or abort. Returns true if only the cloud changes should be applied.
+func (osASG *openstackASG) checkAPI(plan *Plan) (bool, error) {
+	policy := osASG.opts.UnreachableAPI
+	if policy == "" || policy == unreachableApply || osASG.createsMasters(plan) {
+		return false, nil
+	}
+	reason, err := osASG.apiUnreachable()
+	if err != nil {
+		return false, fmt.Errorf("error checking API server: %v", err)
+	}
+	if reason == "" {
+		return false, nil
+	}
+	osASG.notifier.notify(osASG.clusterName, "APIUnreachable", reason)
+	if policy == unreachableAbort {
+		return false, fmt.Errorf("not applying plan %s, %s", plan.ID, reason)
+	}
+	glog.Warningf("Applying only cloud changes of plan %s, %s", plan.ID, reason)
+	return true, nil
+}
@@ -0,0 +1,64 @@
+package autoscaler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	openstackclient "github.com/gophercloud/gophercloud/openstack"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var reauthentications = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "kops_autoscaler",
+	Name:      "openstack_reauthentications_total",
+	Help:      "Number of times the OpenStack clients authenticated again after a request failed with 401.",
+}, []string{"result"})
+
+func init() {
+	prometheus.MustRegister(reauthentications)
+}
+
+// enableReauth makes the provider client authenticate again when a request fails with 401, e.g.
+// because the token has expired, and retry the request. Gophercloud does it only for credentials
+// read from the config file. The credentials are read again, so rotated credentials are used.
+// authURL overrides the keystone URL of the credentials when the cloud was built with a fallback.
+func enableReauth(provider *gophercloud.ProviderClient, scope keystoneScope, authURL string) {
+	// the tasks of an apply share the client concurrently
+	provider.UseTokenLock()
+	provider.ReauthFunc = func() error {
+		token, err := authenticate(provider.HTTPClient, scope, authURL)
+		if err != nil {
+			reauthentications.WithLabelValues("error").Inc()
+			glog.Errorf("Error authenticating to keystone again: %v", err)
+			return err
+		}
+		reauthentications.WithLabelValues("success").Inc()
+		glog.Infof("Authenticated to keystone again\n")
+		// called by Reauthenticate with the token lock held
+		provider.TokenID = token
+		return nil
+	}
+}
+
+// authenticate gets a new token with a throw-away provider client
+func authenticate(httpClient http.Client, scope keystoneScope, authURL string) (string, error) {
+	authOption, err := scope.credentials()
+	if err != nil {
+		return "", err
+	}
+	if authURL != "" {
+		authOption.IdentityEndpoint = authURL
+	}
+	authOption.AllowReauth = false
+	client, err := openstackclient.NewClient(authOption.IdentityEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("error building openstack provider client: %v", err)
+	}
+	client.HTTPClient = httpClient
+	if err := openstackclient.Authenticate(client, authOption); err != nil {
+		return "", err
+	}
+	return client.TokenID, nil
+}
@@ -0,0 +1,178 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	kopsversion "k8s.io/kops"
+)
+
+// Reconciler is the reconcile engine of the autoscaler, for programs embedding it. It manages the
+// cluster of Options.ClusterName, or the clusters discovered with Options.DiscoverAll, the same way
+// as the command. Options left at a zero value which is not usable get the defaults of the flags
+// of the command, and the options are validated like the flags.
+type Reconciler struct {
+	m           *manager
+	credentials *credentialSecrets
+	vault       *vaultCredentials
+}
+
+// New sets the defaults of the options, checks them and builds the clients of the reconciler. The
+// credentials from kubernetes secrets and Vault are read here, and refreshed in the background
+// while Run is running.
+func New(opts *Options) (*Reconciler, error) {
+	opts.SetDefaults()
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	glog.Infof("Using embedded kops %s\n", kopsversion.Version)
+	rc := &runContext{}
+	r := &Reconciler{}
+	if opts.CredentialsSecrets != "" {
+		kubeClient, err := newKubeClient(rc)
+		if err != nil {
+			return nil, fmt.Errorf("credentials secrets need access to kubernetes: %v", err)
+		}
+		r.credentials, err = loadCredentialSecrets(opts, kubeClient)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.VaultAddress != "" && opts.VaultSecrets != "" {
+		vault, err := loadVaultCredentials(opts)
+		if err != nil {
+			return nil, err
+		}
+		r.vault = vault
+	}
+
+	clientset, err := newClientset(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	maxDeletions, err := parseLimit(opts.MaxDeletions)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateEndpointFallbacks(opts.EndpointFallbacks); err != nil {
+		return nil, err
+	}
+	if err := validateLBProvider(opts.LBProvider); err != nil {
+		return nil, err
+	}
+	if err := validateCapacityPolicy(opts.CapacityPolicy); err != nil {
+		return nil, err
+	}
+	if err := validateChaos(opts.Chaos); err != nil {
+		return nil, err
+	}
+	if _, err := parseIgnoreFields(splitList(opts.IgnoreFields)); err != nil {
+		return nil, err
+	}
+
+	selector, err := labels.Parse(opts.ClusterSelector)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing cluster selector %q: %v", opts.ClusterSelector, err)
+	}
+
+	var kubeClient kubernetes.Interface
+	if opts.Canary || opts.ScaleDown || opts.AdminKubeAuth || opts.ResolveDuplicates || opts.CreateBatchWaitReady || opts.StatusNamespace != "" || opts.SizeOverrides != "" {
+		kubeClient, err = newKubeClient(rc)
+		if err != nil {
+			return nil, fmt.Errorf("canary instances, waiting for batches to become Ready, scale down, resolving duplicate servers, admin API kubernetes authentication, status config maps and size overrides need access to kubernetes: %v", err)
+		}
+	}
+	var overrides *sizeOverrides
+	if opts.SizeOverrides != "" {
+		overrides, err = loadSizeOverrides(opts, kubeClient)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	config, err := loadConfig(opts.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := loadUserData(opts.ExtraUserData); err != nil {
+		return nil, err
+	}
+
+	notifier, err := newNotifier(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	r.m = &manager{
+		opts:          opts,
+		clientset:     &contextClientset{Clientset: clientset, ctx: rc},
+		selector:      selector,
+		config:        config,
+		kubeClient:    kubeClient,
+		notifier:      notifier,
+		maxDeletions:  maxDeletions,
+		started:       time.Now(),
+		ctx:           rc,
+		alerts:        newAlertScaler(),
+		sizeOverrides: overrides,
+	}
+	return r, nil
+}
+
+// RunOnce executes every managed cluster once and returns their results, sorted by cluster name.
+// A failed execution is reported in the Error of its result, not as error. When ctx is done the
+// remaining clusters are not executed, and the results so far are returned with the error of ctx.
+// The requests to OpenStack and kubernetes and the waits of the executions are cancelled with ctx.
+func (r *Reconciler) RunOnce(ctx context.Context) ([]*Result, error) {
+	r.m.ctx.set(ctx)
+	results := r.m.runOnce(ctx)
+	return results, ctx.Err()
+}
+
+// Run executes the clusters at their intervals, and serves the admin APIs when
+// Options.AdminAddress or Options.AdminGRPCAddress is set, until ctx is done. An execution
+// in progress is cancelled with ctx.
+func (r *Reconciler) Run(ctx context.Context) error {
+	r.m.ctx.set(ctx)
+	if r.credentials != nil {
+		go r.credentials.watch(ctx)
+	}
+	if r.vault != nil {
+		go r.vault.run(ctx)
+	}
+	if r.m.opts.PrometheusURL != "" {
+		go newMetricSizer(r.m).run(ctx)
+	}
+	if r.m.sizeOverrides != nil {
+		go r.m.sizeOverrides.watch(ctx, r.m)
+	}
+	if r.m.opts.AdminAddress != "" || r.m.opts.AdminGRPCAddress != "" {
+		admin, err := newAdminServer(r.m.opts, r.m)
+		if err != nil {
+			return err
+		}
+		if err := admin.start(); err != nil {
+			return err
+		}
+		defer admin.stop()
+	}
+	r.m.run(ctx)
+	return nil
+}
+
+// SetApplier replaces the kops-backed Applier of the clusters for which f returns one, e.g. with
+// an applier scoped to OpenStack resources or a fake in tests. It must be called before RunOnce or Run.
+func (r *Reconciler) SetApplier(f ApplierFunc) {
+	r.m.applier = f
+}
+
+// Failed returns true if the execution of the cluster failed
+func (r *Result) Failed() bool {
+	return r.Error != ""
+}
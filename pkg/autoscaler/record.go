@@ -0,0 +1,308 @@
+package autoscaler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// maxRecordedCalls limits the calls recorded in one execution, the later ones are only counted
+	maxRecordedCalls = 2000
+	// maxRecordedBody is the size from which the recorded request and response bodies are truncated
+	maxRecordedBody = 256 * 1024
+)
+
+// recordedHeaders are the headers kept in the recording, the others are dropped
+var recordedHeaders = []string{"Content-Type", "Openstack-Api-Version", "X-Openstack-Nova-Api-Version", "X-Openstack-Request-Id", "X-Compute-Request-Id", "Location", "Retry-After"}
+
+// recordedSecrets are the JSON fields replaced in the recorded bodies
+var recordedSecrets = map[string]bool{
+	"password":   true,
+	"secret":     true,
+	"user_data":  true,
+	"adminPass":  true,
+	"access_key": true,
+	"secret_key": true,
+	// the user data of a server, read for --replace-user-data-drift
+	"OS-EXT-SRV-ATTR:user_data": true,
+}
+
+// Recording is the bundle of the OpenStack API calls of a failed execution
+type Recording struct {
+	Cluster  string         `json:"cluster"`
+	Error    string         `json:"error"`
+	Recorded time.Time      `json:"recorded"`
+	Calls    []RecordedCall `json:"calls"`
+	// Dropped is the number of calls over the limit which are not in the recording
+	Dropped int `json:"dropped,omitempty"`
+}
+
+// RecordedCall is a single sanitized request and its response
+type RecordedCall struct {
+	Time            time.Time         `json:"time"`
+	Duration        string            `json:"duration"`
+	Method          string            `json:"method"`
+	URL             string            `json:"url"`
+	RequestHeaders  map[string]string `json:"requestHeaders,omitempty"`
+	RequestBody     string            `json:"requestBody,omitempty"`
+	Status          int               `json:"status,omitempty"`
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty"`
+	ResponseBody    string            `json:"responseBody,omitempty"`
+	Error           string            `json:"error,omitempty"`
+}
+
+// recorder collects the OpenStack API calls of the current execution of a cluster
+type recorder struct {
+	mu      sync.Mutex
+	calls   []RecordedCall
+	dropped int
+}
+
+// apiRecorder returns the recorder of the cluster, or nil if recording is not enabled
+func (osASG *openstackASG) apiRecorder() *recorder {
+	if osASG.opts.RecordDir == "" {
+		return nil
+	}
+	if osASG.apiCalls == nil {
+		osASG.apiCalls = &recorder{}
+	}
+	return osASG.apiCalls
+}
+
+// reset discards the calls of the previous execution
+func (r *recorder) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+	r.dropped = 0
+}
+
+func (r *recorder) add(call RecordedCall) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.calls) >= maxRecordedCalls {
+		r.dropped++
+		return
+	}
+	r.calls = append(r.calls, call)
+}
+
+// save writes the calls of the failed execution to a bundle in dir and removes the oldest bundles
+// of the cluster over keep
+func (r *recorder) save(dir string, keep int, cluster string, failure error) (string, error) {
+	r.mu.Lock()
+	recording := &Recording{
+		Cluster:  cluster,
+		Error:    scrubSecrets(failure.Error()),
+		Recorded: time.Now().UTC(),
+		Calls:    r.calls,
+		Dropped:  r.dropped,
+	}
+	data, err := json.MarshalIndent(recording, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	p := filepath.Join(dir, fmt.Sprintf("%s-%s.json", cluster, recording.Recorded.Format("20060102T150405Z")))
+	if err := ioutil.WriteFile(p, data, 0600); err != nil {
+		return "", err
+	}
+	if keep > 0 {
+		old, _ := filepath.Glob(filepath.Join(dir, cluster+"-*.json"))
+		sort.Strings(old)
+		for i := 0; i < len(old)-keep; i++ {
+			if err := os.Remove(old[i]); err != nil {
+				glog.Warningf("Error removing old recording %s: %v", old[i], err)
+			}
+		}
+	}
+	return p, nil
+}
+
+// saveRecording writes the recorded calls when the execution failed
+func (osASG *openstackASG) saveRecording(failure error) {
+	r := osASG.apiRecorder()
+	if r == nil || failure == nil {
+		return
+	}
+	p, err := r.save(osASG.opts.RecordDir, osASG.opts.RecordKeep, osASG.clusterName, failure)
+	if err != nil {
+		glog.Errorf("%s: error saving recording of OpenStack API calls: %v", osASG.clusterName, err)
+		return
+	}
+	glog.Infof("Saved recording of the OpenStack API calls of the failed execution of %s to %s\n", osASG.clusterName, p)
+}
+
+// recordingTransport records the requests and responses of the OpenStack clients of a cluster
+type recordingTransport struct {
+	next     http.RoundTripper
+	recorder *recorder
+}
+
+func newRecordingTransport(next http.RoundTripper, r *recorder) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &recordingTransport{
+		next:     next,
+		recorder: r,
+	}
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	call := RecordedCall{
+		Time:           time.Now().UTC(),
+		Method:         req.Method,
+		URL:            req.URL.String(),
+		RequestHeaders: recordHeaders(req.Header),
+	}
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		call.RequestBody = sanitizeBody(body)
+	}
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		call.Duration = time.Since(start).String()
+		call.Error = scrubSecrets(err.Error())
+		t.recorder.add(call)
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	call.Duration = time.Since(start).String()
+	call.Status = resp.StatusCode
+	call.ResponseHeaders = recordHeaders(resp.Header)
+	call.ResponseBody = sanitizeBody(body)
+	if err != nil {
+		call.Error = scrubSecrets(err.Error())
+	}
+	t.recorder.add(call)
+	return resp, err
+}
+
+func recordHeaders(h http.Header) map[string]string {
+	headers := make(map[string]string)
+	for _, name := range recordedHeaders {
+		if v := h.Get(name); v != "" {
+			headers[name] = v
+		}
+	}
+	return headers
+}
+
+// sanitizeBody replaces the secret fields of a JSON body and the registered secrets of any body
+func sanitizeBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err == nil {
+		if data, err := json.Marshal(redactFields(v)); err == nil {
+			body = data
+		}
+	}
+	s := string(body)
+	if len(s) > maxRecordedBody {
+		s = s[:maxRecordedBody] + "...(truncated)"
+	}
+	return scrubSecrets(s)
+}
+
+func redactFields(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if recordedSecrets[k] {
+				v[k] = redacted
+			} else if token, ok := field.(map[string]interface{}); ok && k == "token" && token["id"] != nil {
+				// the token of a token authentication request, the token responses of keystone have no id
+				token["id"] = redacted
+			} else {
+				v[k] = redactFields(field)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactFields(v[i])
+		}
+	}
+	return v
+}
+
+// ReadRecording reads a bundle written by --record-dir
+func ReadRecording(path string) (*Recording, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading recording %s: %v", path, err)
+	}
+	recording := &Recording{}
+	if err := json.Unmarshal(data, recording); err != nil {
+		return nil, fmt.Errorf("error parsing recording %s: %v", path, err)
+	}
+	return recording, nil
+}
+
+// ReplayTransport answers the requests from the recording, for tests. Each request gets the
+// response of the first call with the same method and URL which has not been replayed yet.
+func (r *Recording) ReplayTransport() http.RoundTripper {
+	return &replayTransport{calls: r.Calls, used: make([]bool, len(r.Calls))}
+}
+
+type replayTransport struct {
+	mu    sync.Mutex
+	calls []RecordedCall
+	used  []bool
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, call := range t.calls {
+		if t.used[i] || call.Method != req.Method || call.URL != req.URL.String() {
+			continue
+		}
+		t.used[i] = true
+		if call.Error != "" && call.Status == 0 {
+			return nil, fmt.Errorf("%s", call.Error)
+		}
+		header := make(http.Header)
+		for k, v := range call.ResponseHeaders {
+			header.Set(k, v)
+		}
+		return &http.Response{
+			Status:     fmt.Sprintf("%d %s", call.Status, http.StatusText(call.Status)),
+			StatusCode: call.Status,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     header,
+			Body:       ioutil.NopCloser(strings.NewReader(call.ResponseBody)),
+			Request:    req,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded call for %s %s", req.Method, req.URL)
+}
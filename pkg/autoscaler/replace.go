@@ -0,0 +1,32 @@
+package autoscaler
+
+import (
+	"github.com/golang/glog"
+	"k8s.io/kops/pkg/apis/kops"
+)
+
+// replaceOrReport adds the server drifted from its spec to the changes as replacement if replace
+// is set. Servers are replaced one at a time and only when nothing else is changing, following the
+// replacement policy of their instance group. Otherwise the drift is reported as ignored change.
+func (osASG *openstackASG) replaceOrReport(c Change, replace bool, reason string, changes []Change, ignored []Change) ([]Change, []Change) {
+	if replace && !osASG.opts.ScaleUpOnly && osASG.foreign[c.Name] == "" && osASG.replaceable(c.Name) && osASG.replaceNow(c, changes) {
+		glog.Infof("Replacing %s, %s\n", c.Name, reason)
+		c.Action = actionDelete
+		c.Kind = kindReplacement
+		return append(changes, c), ignored
+	}
+	c.Action = actionUpdate
+	c.Kind = kindDrift
+	return changes, append(ignored, c)
+}
+
+// replaceable returns true if the server can be replaced to fix drift, masters are never replaced
+func (osASG *openstackASG) replaceable(server string) bool {
+	group := osASG.instanceGroupFor(server)
+	for _, ig := range osASG.ApplyCmd.InstanceGroups {
+		if ig.ObjectMeta.Name == group {
+			return ig.Spec.Role != kops.InstanceGroupRoleMaster
+		}
+	}
+	return false
+}
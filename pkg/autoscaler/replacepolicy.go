@@ -0,0 +1,238 @@
+package autoscaler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+// annotationReplacementPolicy sets how the drifted servers of an instance group are replaced
+const annotationReplacementPolicy = annotationPrefix + "replacement-policy"
+
+const (
+	// replaceDeleteFirst deletes the drifted server and lets kops create it again with the same name
+	replaceDeleteFirst = "delete-first"
+	// replaceCreateFirst creates an additional server first and deletes the drifted server once the
+	// additional one is ready. The additional server is removed after the replacement is ready.
+	replaceCreateFirst = "create-first"
+	// replaceBlueGreen replaces all servers of the instance group with a parallel set of servers
+	// in a green copy of it
+	replaceBlueGreen = "blue-green"
+)
+
+// surge is a create-first replacement in progress in an instance group. The state is kept in
+// memory only.
+type surge struct {
+	// server is the drifted server and serverID its ID before the replacement
+	server   string
+	serverID string
+	// name is the additional server created before the drifted server is deleted
+	name string
+	// ready is set when the additional server is ready and replaced when the drifted server
+	// has been deleted
+	ready    bool
+	replaced bool
+	// seen is set when the drift of the server was found in the current execution
+	seen bool
+}
+
+// replacementPolicy returns the replacement policy set in the annotation of the instance group,
+// delete-first if it has none
+func replacementPolicy(ig *kops.InstanceGroup) (string, error) {
+	v, ok := ig.ObjectMeta.Annotations[annotationReplacementPolicy]
+	if !ok {
+		return replaceDeleteFirst, nil
+	}
+	switch v {
+	case replaceDeleteFirst, replaceCreateFirst, replaceBlueGreen:
+		return v, nil
+	}
+	return "", fmt.Errorf("invalid annotation %s %q, must be %s, %s or %s", annotationReplacementPolicy, v, replaceDeleteFirst, replaceCreateFirst, replaceBlueGreen)
+}
+
+// surgeGroups returns the instance groups with minSize increased by one in the instance groups
+// with a create-first replacement in progress, so that kops creates the additional server.
+// Replacements of instance groups which do not exist anymore are forgotten.
+func (osASG *openstackASG) surgeGroups(instanceGroups []*kops.InstanceGroup) []*kops.InstanceGroup {
+	if len(osASG.surges) == 0 {
+		return instanceGroups
+	}
+	var result []*kops.InstanceGroup
+	found := make(map[string]bool)
+	for _, ig := range instanceGroups {
+		name := ig.ObjectMeta.Name
+		if osASG.surges[name] == nil {
+			result = append(result, ig)
+			continue
+		}
+		found[name] = true
+		temporary := ig.DeepCopy()
+		temporary.Spec.MinSize = fi.Int32(fi.Int32Value(ig.Spec.MinSize) + 1)
+		result = append(result, temporary)
+	}
+	for name := range osASG.surges {
+		if !found[name] {
+			glog.Infof("Instance group %s was removed, forgetting the replacement of %s\n", name, osASG.surges[name].server)
+			delete(osASG.surges, name)
+		}
+	}
+	return result
+}
+
+// replaceNow returns true if the drifted server can be deleted for replacement now. With the
+// create-first policy the additional server is started first, and the drifted server is deleted
+// once it is ready. Each instance group replaces one server at a time. With the blue-green policy
+// the drift starts a rollout of the whole instance group instead.
+func (osASG *openstackASG) replaceNow(c Change, changes []Change) bool {
+	var group *kops.InstanceGroup
+	for _, ig := range osASG.ApplyCmd.InstanceGroups {
+		if ig.ObjectMeta.Name == osASG.instanceGroupFor(c.Name) {
+			group = ig
+		}
+	}
+	if group == nil {
+		return false
+	}
+	policy, err := replacementPolicy(group)
+	if err == nil && policy == replaceBlueGreen {
+		if stored := osASG.storedGroup(group.ObjectMeta.Name); stored != nil {
+			osASG.requestRollout(c, stored)
+		}
+		return false
+	}
+	if err != nil || policy != replaceCreateFirst || osASG.opts.CordonOnly {
+		return !instanceChanges(changes)
+	}
+
+	name := group.ObjectMeta.Name
+	s := osASG.surges[name]
+	if s == nil {
+		if instanceChanges(changes) {
+			return false
+		}
+		// the instance groups of ApplyCmd are not surged yet
+		minSize := fi.Int32Value(group.Spec.MinSize)
+		if group.Spec.MaxSize != nil && minSize >= *group.Spec.MaxSize {
+			glog.Warningf("Replacing %s delete-first, instance group %s is at its maxSize %d", c.Name, name, *group.Spec.MaxSize)
+			return true
+		}
+		if osASG.surges == nil {
+			osASG.surges = make(map[string]*surge)
+		}
+		s = &surge{
+			server:   c.Name,
+			serverID: c.serverID,
+			name:     strings.ToLower(fmt.Sprintf("%s-%s-%d", osASG.clusterName, name, minSize+1)),
+			seen:     true,
+		}
+		osASG.surges[name] = s
+		glog.Infof("Creating %s before replacing %s\n", s.name, c.Name)
+		osASG.record("creating %s before replacing %s", s.name, c.Name)
+		return false
+	}
+	if s.server != c.Name {
+		return false
+	}
+	s.seen = true
+	if !s.ready {
+		glog.Infof("Waiting for %s to be ready before replacing %s\n", s.name, c.Name)
+		return false
+	}
+	return !instanceChanges(changes)
+}
+
+// checkSurges updates the state of the create-first replacements from the servers of the cluster
+func (osASG *openstackASG) checkSurges(list []servers.Server) {
+	for _, s := range osASG.surges {
+		s.seen = false
+		s.ready = false
+		for _, server := range list {
+			switch server.Name {
+			case s.name:
+				s.ready = osASG.serverReady(server)
+			case s.server:
+				if server.ID != s.serverID {
+					s.replaced = true
+				}
+			}
+		}
+		if !s.replaced && !hasServer(list, s.server) {
+			s.replaced = true
+		}
+	}
+}
+
+// surgeDeletes returns the deletions of the additional servers whose replacement is ready, and of
+// those whose server has not drifted anymore in the current execution
+func (osASG *openstackASG) surgeDeletes(list []servers.Server) []Change {
+	var changes []Change
+	for _, s := range osASG.surges {
+		var additional, replacement *servers.Server
+		for i := range list {
+			switch list[i].Name {
+			case s.name:
+				additional = &list[i]
+			case s.server:
+				replacement = &list[i]
+			}
+		}
+		if additional == nil {
+			continue
+		}
+		switch {
+		case s.replaced && replacement != nil && replacement.ID != s.serverID && osASG.serverReady(*replacement):
+			glog.Infof("Replacement of %s is ready, removing %s\n", s.server, s.name)
+		case !s.replaced && !s.seen:
+			glog.Infof("Server %s has not drifted anymore, removing %s\n", s.server, s.name)
+		default:
+			continue
+		}
+		changes = append(changes, Change{
+			Key:      "Instance/" + s.name,
+			Type:     "Instance",
+			Name:     s.name,
+			Action:   actionDelete,
+			Kind:     kindScaleDown,
+			serverID: additional.ID,
+		})
+	}
+	return changes
+}
+
+// endSurge forgets the create-first replacement after its additional server has been deleted
+func (osASG *openstackASG) endSurge(server string) {
+	for name, s := range osASG.surges {
+		if s.name == server {
+			delete(osASG.surges, name)
+		}
+	}
+}
+
+// serverReady returns true if the server is active and, when the autoscaler has access to
+// kubernetes, its node is Ready
+func (osASG *openstackASG) serverReady(server servers.Server) bool {
+	if server.Status != "ACTIVE" {
+		return false
+	}
+	if osASG.kubeClient == nil {
+		return true
+	}
+	ready, err := osASG.nodeReady(server.Name)
+	if err != nil {
+		glog.Warningf("Error reading node %s: %v", server.Name, err)
+	}
+	return ready
+}
+
+func hasServer(list []servers.Server, name string) bool {
+	for _, s := range list {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package autoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+// Result is the outcome of a single execution of a cluster, printed in --once mode
+type Result struct {
+	Cluster string `json:"cluster"`
+	// Drift is true if the dry-run found changes
+	Drift          bool                           `json:"drift"`
+	PlanID         string                         `json:"planID,omitempty"`
+	Changes        []Change                       `json:"changes,omitempty"`
+	Actions        []string                       `json:"actions,omitempty"`
+	InstanceGroups map[string]*InstanceGroupCount `json:"instanceGroups,omitempty"`
+	// Partial is set when an apply failed after creating some of the instances
+	Partial *PartialApply `json:"partial,omitempty"`
+	Error   string        `json:"error,omitempty"`
+	// Err is the error of a failed execution, e.g. an ErrStateStoreUnavailable, ErrQuotaExceeded or
+	// ErrApplyFailed. Wrapped errors implement Cause like the errors of github.com/pkg/errors.
+	Err error `json:"-"`
+}
+
+// InstanceGroupCount compares the servers of an instance group against its size
+type InstanceGroupCount struct {
+	MinSize int `json:"minSize"`
+	MaxSize int `json:"maxSize"`
+	Servers int `json:"servers"`
+}
+
+// record adds an action taken in the current execution to the result
+func (osASG *openstackASG) record(format string, args ...interface{}) {
+	if osASG.result != nil {
+		osASG.result.Actions = append(osASG.result.Actions, fmt.Sprintf(format, args...))
+	}
+}
+
+// recordPlan adds the dry-run results to the result of the current execution
+func (osASG *openstackASG) recordPlan(plan *Plan) {
+	if osASG.result == nil {
+		return
+	}
+	osASG.result.Drift = len(plan.Changes) > 0 || len(plan.ignored) > 0 || len(plan.portFixes) > 0 || len(plan.tagFixes) > 0 || plan.poolFix != nil
+	if len(plan.Changes) > 0 {
+		osASG.result.PlanID = plan.ID
+	}
+	osASG.result.Changes = append(append([]Change{}, plan.Changes...), plan.ignored...)
+	for _, d := range plan.portFixes {
+		osASG.result.Changes = append(osASG.result.Changes, d.change())
+	}
+	for _, d := range plan.tagFixes {
+		osASG.result.Changes = append(osASG.result.Changes, d.change())
+	}
+	if plan.poolFix != nil {
+		osASG.result.Changes = append(osASG.result.Changes, plan.poolFix.changes()...)
+	}
+}
+
+// execute runs single check of the cluster and returns the result
+func (osASG *openstackASG) execute() *Result {
+	result := &Result{Cluster: osASG.clusterName}
+	osASG.result = result
+	defer func() {
+		osASG.result = nil
+	}()
+
+	if r := osASG.apiRecorder(); r != nil {
+		r.reset()
+	}
+	err := osASG.reconcile()
+	if err != nil {
+		osASG.logError(err)
+		result.Error = err.Error()
+		result.Err = err
+		osASG.saveRecording(err)
+		osASG.resetClients()
+	} else {
+		lastSuccessfulReconcile.WithLabelValues(osASG.clusterName).SetToCurrentTime()
+	}
+	osASG.writeStatus(err)
+	if osASG.ApplyCmd != nil && osASG.ApplyCmd.Cluster.ObjectMeta.Name == osASG.clusterName {
+		cloud, err := osASG.openstackCloud()
+		if err != nil {
+			glog.Errorf("%s: error counting servers: %v", osASG.clusterName, err)
+			return result
+		}
+		counts, err := serverCounts(cloud, osASG.ApplyCmd.Cluster, osASG.instanceGroups)
+		if err != nil {
+			glog.Errorf("%s: error counting servers: %v", osASG.clusterName, err)
+			return result
+		}
+		result.InstanceGroups = make(map[string]*InstanceGroupCount)
+		for _, ig := range osASG.instanceGroups {
+			result.InstanceGroups[ig.ObjectMeta.Name] = &InstanceGroupCount{
+				MinSize: int(fi.Int32Value(ig.Spec.MinSize)),
+				MaxSize: int(fi.Int32Value(ig.Spec.MaxSize)),
+				Servers: counts[ig.ObjectMeta.Name],
+			}
+		}
+	}
+	return result
+}
+
+// runOnce executes every managed cluster once, until ctx is done
+func (m *manager) runOnce(ctx context.Context) []*Result {
+	m.discover()
+	var names []string
+	for name := range m.workers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var results []*Result
+	for _, name := range names {
+		if ctx.Err() != nil {
+			break
+		}
+		glog.Infof("Executing %s...\n", name)
+		results = append(results, m.workers[name].execute())
+	}
+	return results
+}
+
+// once executes the clusters once and prints the results. It fails if any of the executions failed.
+func (m *manager) once(ctx context.Context) error {
+	results := m.runOnce(ctx)
+	if m.opts.Output != "" {
+		if err := writeResults(os.Stdout, m.opts.Output, results); err != nil {
+			return fmt.Errorf("error writing results: %v", err)
+		}
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Failed() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("execution failed for %d of %d clusters", failed, len(results))
+	}
+	return nil
+}
+
+// writeResults prints the results in the given format, json or yaml
+func writeResults(w io.Writer, format string, results []*Result) error {
+	out := struct {
+		Results []*Result `json:"results"`
+	}{results}
+	var data []byte
+	var err error
+	switch format {
+	case "json":
+		data, err = json.MarshalIndent(out, "", "  ")
+		data = append(data, '\n')
+	case "yaml":
+		data, err = yaml.Marshal(out)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
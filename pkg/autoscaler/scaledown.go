@@ -0,0 +1,147 @@
+package autoscaler
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/floatingips"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstacktasks"
+)
+
+// excessServers returns deletions for the servers of the managed instance groups which kops
+// does not build anymore, i.e. servers left over after minSize was decreased.
+// Servers of master instance groups are never removed, nor the servers of instance groups whose
+// tasks were not built.
+func (osASG *openstackASG) excessServers(list []servers.Server) ([]Change, error) {
+	expected := make(map[string]bool)
+	for _, t := range osASG.ApplyCmd.TaskMap {
+		if i, ok := t.(*openstacktasks.Instance); ok {
+			expected[taskName(i)] = true
+		}
+	}
+	roles := make(map[string]kops.InstanceGroupRole)
+	for _, ig := range osASG.ApplyCmd.InstanceGroups {
+		roles[ig.ObjectMeta.Name] = ig.Spec.Role
+	}
+
+	var changes []Change
+	for _, s := range list {
+		ig := osASG.instanceGroupFor(s.Name)
+		role, built := roles[ig]
+		if ig == "" || !built || expected[s.Name] || role == kops.InstanceGroupRoleMaster || !osASG.managedInstance(s.Name) {
+			continue
+		}
+		if osASG.opts.CordonOnly {
+			// already handled, waiting for someone to remove it
+			marked, err := osASG.markedForScaleDown(s.Name)
+			if err != nil {
+				return nil, fmt.Errorf("error reading node %s: %v", s.Name, err)
+			}
+			if marked {
+				continue
+			}
+		}
+		changes = append(changes, Change{
+			Key:      "Instance/" + s.Name,
+			Type:     "Instance",
+			Name:     s.Name,
+			Action:   actionDelete,
+			Kind:     kindScaleDown,
+			serverID: s.ID,
+		})
+	}
+	return changes, nil
+}
+
+// instanceDeletes returns the servers which the plan would delete
+func (p *Plan) instanceDeletes() []Change {
+	var deletes []Change
+	for _, c := range p.Changes {
+		if c.Type == "Instance" && c.Action == actionDelete && c.serverID != "" {
+			deletes = append(deletes, c)
+		}
+	}
+	sort.Slice(deletes, func(i, j int) bool {
+		return deletes[i].Name < deletes[j].Name
+	})
+	return deletes
+}
+
+// scaleDown drains the nodes of the deleted servers and deletes the servers with their ports
+// and floating IPs. With --cordon-only the nodes are only cordoned and annotated.
+func (osASG *openstackASG) scaleDown(plan *Plan) error {
+	deletes := plan.instanceDeletes()
+	if len(deletes) == 0 {
+		return nil
+	}
+	if osASG.opts.CordonOnly {
+		for _, c := range deletes {
+			if err := osASG.cordonAndAnnotate(c.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	cloud, err := osASG.openstackCloud()
+	if err != nil {
+		return err
+	}
+	for _, c := range deletes {
+		if osASG.kubeClient != nil {
+			if err := osASG.drain(c.Name); err != nil {
+				return fmt.Errorf("error draining %s: %v", c.Name, err)
+			}
+		}
+		if err := deleteServer(cloud, c.serverID, c.Name, osASG.opts.gc()); err != nil {
+			return err
+		}
+		osASG.endSurge(c.Name)
+	}
+	return nil
+}
+
+// deleteServer deletes the server, and the floating IPs and ports of it selected by gc
+func deleteServer(cloud openstack.OpenstackCloud, id string, name string, gc gcScope) error {
+	// floating IPs are disassociated when the server is deleted, find them first
+	var fips []floatingips.FloatingIP
+	if gc.floatingIPs {
+		var err error
+		fips, err = cloud.ListFloatingIPs()
+		if err != nil {
+			return fmt.Errorf("error listing floating IPs: %v", err)
+		}
+	}
+
+	glog.Infof("Deleting server %s\n", name)
+	if err := cloud.DeleteInstanceWithID(id); err != nil {
+		return fmt.Errorf("error deleting server %s: %v", name, err)
+	}
+
+	for _, fip := range fips {
+		if fip.InstanceID == id {
+			if err := cloud.DeleteFloatingIP(fip.ID); err != nil {
+				return fmt.Errorf("error deleting floating IP %s of %s: %v", fip.IP, name, err)
+			}
+		}
+	}
+	if !gc.ports {
+		return nil
+	}
+	for _, portName := range []string{"port-" + name, "port-" + name + providerPortSuffix} {
+		list, err := cloud.ListPorts(ports.ListOpts{Name: portName})
+		if err != nil {
+			return fmt.Errorf("error listing ports of %s: %v", name, err)
+		}
+		for _, port := range list {
+			if err := cloud.DeletePort(port.ID); err != nil {
+				return fmt.Errorf("error deleting port %s: %v", port.Name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package autoscaler
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// secretEnv are the environment variables whose values never appear in the output
+var secretEnv = []string{"S3_ACCESS_KEY_ID", "S3_SECRET_ACCESS_KEY", "OS_PASSWORD", "OS_APPLICATION_CREDENTIAL_SECRET", "OS_TOKEN"}
+
+var (
+	// userDataLine starts the user data of a server in the dry-run report of kops
+	userDataLine = regexp.MustCompile(`^(\s+UserData)\b`)
+	// reportLine is a line which ends the user data: the next field, task or section of the
+	// dry-run report, or the start of a plan or results printed by the autoscaler
+	reportLine = regexp.MustCompile(`^(  \t[A-Z]\w*\s|  [A-Z][A-Za-z]+/\S+$|Will |Plan |\[$|\{$|- cluster:)`)
+)
+
+var (
+	secretsMu sync.Mutex
+	secrets   []string
+)
+
+// isSecretEnv returns true if the value of the environment variable never appears in the output
+func isSecretEnv(name string) bool {
+	for _, n := range secretEnv {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// registerSecret adds a value which is replaced in all output
+func registerSecret(s string) {
+	if len(s) < 4 {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, secret := range secrets {
+		if secret == s {
+			return
+		}
+	}
+	secrets = append(secrets, s)
+}
+
+// scrubSecrets replaces the registered secrets in s
+func scrubSecrets(s string) string {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, secret := range secrets {
+		s = strings.Replace(s, secret, redacted, -1)
+	}
+	return s
+}
+
+// streamScrubber scrubs the lines written to one output stream
+type streamScrubber struct {
+	inUserData bool
+}
+
+// line returns the line with secrets replaced. The user data in dry-run reports, which contains
+// the bootstrap script of the servers, is replaced as a whole.
+func (s *streamScrubber) line(l string) string {
+	if s.inUserData {
+		if !reportLine.MatchString(l) {
+			return ""
+		}
+		s.inUserData = false
+	}
+	if m := userDataLine.FindStringSubmatch(l); m != nil {
+		s.inUserData = true
+		return m[1] + "\t" + redacted + "\n"
+	}
+	return scrubSecrets(l)
+}
+
+// scrubStream replaces *f with a pipe and copies the scrubbed output to the original file.
+// The returned function restores the file after the pending output has been copied.
+func scrubStream(f **os.File) (func(), error) {
+	out := *f
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	*f = w
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s := &streamScrubber{}
+		buf := make([]byte, 32*1024)
+		var pending string
+		for {
+			n, err := r.Read(buf)
+			pending += string(buf[:n])
+			for {
+				i := strings.IndexByte(pending, '\n')
+				if i < 0 {
+					break
+				}
+				out.WriteString(s.line(pending[:i+1]))
+				pending = pending[i+1:]
+			}
+			// a partial line which is not followed by more data, e.g. a prompt
+			if pending != "" && (n < len(buf) || err != nil) {
+				out.WriteString(s.line(pending))
+				pending = ""
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return func() {
+		*f = out
+		w.Close()
+		<-done
+	}, nil
+}
+
+// ScrubOutput removes S3 and OpenStack secrets and the user data of servers from everything
+// written to stdout and stderr, including the logs and dry-run reports of the embedded kops.
+// The returned function flushes the output and restores the original streams.
+func ScrubOutput(opts *Options) (func(), error) {
+	registerSecret(opts.SecretKey)
+	for _, name := range secretEnv {
+		registerSecret(os.Getenv(name))
+	}
+	restoreStdout, err := scrubStream(&os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	restoreStderr, err := scrubStream(&os.Stderr)
+	if err != nil {
+		restoreStdout()
+		return nil, err
+	}
+	return func() {
+		restoreStdout()
+		restoreStderr()
+	}, nil
+}
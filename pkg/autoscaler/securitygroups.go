@@ -0,0 +1,132 @@
+package autoscaler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	sg "github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstacktasks"
+)
+
+// portDrift is a server port which is missing security groups implied by kops
+type portDrift struct {
+	server string
+	port   ports.Port
+	// missing are the IDs and names of the missing security groups
+	missing      []string
+	missingNames []string
+}
+
+// change describes the drift as update of the port task
+func (d *portDrift) change() Change {
+	return Change{
+		Key:    "Port/" + d.port.Name,
+		Type:   "Port",
+		Name:   d.port.Name,
+		Action: actionUpdate,
+		Fields: []string{"SecurityGroups"},
+		Kind:   kindDrift,
+	}
+}
+
+// securityGroupDrift checks that the ports of the servers have the security group of their role
+// and the additionalSecurityGroups of their instance group
+func (osASG *openstackASG) securityGroupDrift(cloud openstack.OpenstackCloud) ([]*portDrift, error) {
+	groups, err := cloud.ListSecurityGroups(sg.ListOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing security groups: %v", err)
+	}
+	// security groups can be referred by ID or name
+	ids := make(map[string]string)
+	names := make(map[string]string)
+	for _, g := range groups {
+		ids[g.ID] = g.ID
+		ids[g.Name] = g.ID
+		names[g.ID] = g.Name
+	}
+
+	additional := make(map[string][]string)
+	for _, ig := range osASG.ApplyCmd.InstanceGroups {
+		additional[ig.ObjectMeta.Name] = ig.Spec.AdditionalSecurityGroups
+	}
+
+	allPorts, err := cloud.ListPorts(ports.ListOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing ports: %v", err)
+	}
+	portsByName := make(map[string][]ports.Port)
+	for _, port := range allPorts {
+		portsByName[port.Name] = append(portsByName[port.Name], port)
+	}
+
+	var drift []*portDrift
+	for _, t := range osASG.ApplyCmd.TaskMap {
+		instance, ok := t.(*openstacktasks.Instance)
+		if !ok || instance.Port == nil {
+			continue
+		}
+		server := taskName(instance)
+		if !osASG.managedInstance(server) || osASG.foreign[server] != "" {
+			continue
+		}
+		expected := make(map[string]bool)
+		for _, group := range instance.Port.SecurityGroups {
+			expected[fi.StringValue(group.Name)] = true
+		}
+		for _, group := range additional[osASG.instanceGroupFor(server)] {
+			expected[group] = true
+		}
+
+		portName := fi.StringValue(instance.Port.Name)
+		for _, port := range append(portsByName[portName], portsByName[portName+providerPortSuffix]...) {
+			attached := make(map[string]bool)
+			for _, id := range port.SecurityGroups {
+				attached[id] = true
+			}
+			d := &portDrift{server: server, port: port}
+			for group := range expected {
+				id, ok := ids[group]
+				if !ok {
+					glog.Warningf("Security group %s of %s not found", group, server)
+					continue
+				}
+				if !attached[id] {
+					d.missing = append(d.missing, id)
+					d.missingNames = append(d.missingNames, names[id])
+				}
+			}
+			if len(d.missing) > 0 {
+				sort.Strings(d.missingNames)
+				drift = append(drift, d)
+			}
+		}
+	}
+	sort.Slice(drift, func(i, j int) bool {
+		return drift[i].port.Name < drift[j].port.Name
+	})
+	return drift, nil
+}
+
+// fixSecurityGroups attaches the missing security groups to the ports. Other security
+// groups of the ports are left as they are.
+func (osASG *openstackASG) fixSecurityGroups(drift []*portDrift) error {
+	cloud, err := osASG.openstackCloud()
+	if err != nil {
+		return err
+	}
+	for _, d := range drift {
+		groups := append(append([]string{}, d.port.SecurityGroups...), d.missing...)
+		glog.Infof("Attaching security groups %s to port %s of %s\n", strings.Join(d.missingNames, ", "), d.port.Name, d.server)
+		_, err := ports.Update(cloud.NetworkingClient(), d.port.ID, ports.UpdateOpts{SecurityGroups: &groups}).Extract()
+		if err != nil {
+			return fmt.Errorf("error updating security groups of port %s: %v", d.port.Name, err)
+		}
+		osASG.record("attached security groups %s to %s", strings.Join(d.missingNames, ", "), d.port.Name)
+	}
+	return nil
+}
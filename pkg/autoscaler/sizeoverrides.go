@@ -0,0 +1,175 @@
+package autoscaler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+// sizeOverridesPollInterval is how often the size overrides config map is checked for changes
+const sizeOverridesPollInterval = 30 * time.Second
+
+// sizeOverrides reads the desired sizes of instance groups from a config map. The keys are
+// <cluster>_<instance group>, or <instance group> for the instance group in every cluster, and the
+// values are the sizes, optionally followed by the time the override expires, e.g. "5,2026-01-02T15:04:05Z".
+type sizeOverrides struct {
+	kubeClient kubernetes.Interface
+	namespace  string
+	name       string
+
+	mu     sync.Mutex
+	values map[string]string
+	// version is the resource version of the config map last read
+	version string
+}
+
+// loadSizeOverrides reads the config map given as namespace/name. A config map which does not
+// exist has no overrides.
+func loadSizeOverrides(opts *Options, kubeClient kubernetes.Interface) (*sizeOverrides, error) {
+	parts := strings.SplitN(opts.SizeOverrides, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid size overrides config map %q, must be namespace/name", opts.SizeOverrides)
+	}
+	o := &sizeOverrides{
+		kubeClient: kubeClient,
+		namespace:  parts[0],
+		name:       parts[1],
+	}
+	if _, err := o.load(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// load reads the config map and returns true if it has changed since it was last read
+func (o *sizeOverrides) load() (bool, error) {
+	values := make(map[string]string)
+	version := ""
+	cm, err := o.kubeClient.CoreV1().ConfigMaps(o.namespace).Get(o.name, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return false, fmt.Errorf("error reading size overrides %s/%s: %v", o.namespace, o.name, err)
+	}
+	if err == nil {
+		values = cm.Data
+		version = cm.ResourceVersion
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if version == o.version {
+		return false, nil
+	}
+	o.values = values
+	o.version = version
+	return true, nil
+}
+
+// watch polls the config map for changes until ctx is done, and executes the managed clusters
+// when it has changed
+func (o *sizeOverrides) watch(ctx context.Context, m *manager) {
+	for {
+		if sleepContext(ctx, sizeOverridesPollInterval) != nil {
+			return
+		}
+		changed, err := o.load()
+		if err != nil {
+			glog.Errorf("Error checking size overrides %v", err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		glog.Infof("Size overrides in %s/%s changed\n", o.namespace, o.name)
+		m.mu.Lock()
+		var names []string
+		for name := range m.workers {
+			names = append(names, name)
+		}
+		m.mu.Unlock()
+		for _, name := range names {
+			if err := m.trigger(name); err != nil {
+				glog.Warningf("Not executing %s after size overrides changed: %v", name, err)
+			}
+		}
+	}
+}
+
+// resourceVersion returns the resource version of the config map last read
+func (o *sizeOverrides) resourceVersion() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.version
+}
+
+// size returns the override of the instance group, if it has one which has not expired
+func (o *sizeOverrides) size(cluster string, ig string) (int32, bool, error) {
+	o.mu.Lock()
+	v, ok := o.values[cluster+"_"+ig]
+	if !ok {
+		v, ok = o.values[ig]
+	}
+	o.mu.Unlock()
+	if !ok {
+		return 0, false, nil
+	}
+	parts := strings.SplitN(v, ",", 2)
+	size, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 32)
+	if err != nil || size < 0 {
+		return 0, false, fmt.Errorf("invalid size override %q", v)
+	}
+	if len(parts) == 2 {
+		expires, err := time.Parse(time.RFC3339, strings.TrimSpace(parts[1]))
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid expiry of size override %q: %v", v, err)
+		}
+		if time.Now().After(expires) {
+			return 0, false, nil
+		}
+	}
+	return int32(size), true, nil
+}
+
+// overrideSizes returns the instance groups with minSize replaced by their size overrides, up to
+// their maxSize. The overrides are never written to the state store. Masters and bastions are
+// not overridden.
+func (osASG *openstackASG) overrideSizes(instanceGroups []*kops.InstanceGroup) []*kops.InstanceGroup {
+	if osASG.sizeOverrides == nil {
+		return instanceGroups
+	}
+	var result []*kops.InstanceGroup
+	for _, ig := range instanceGroups {
+		name := ig.ObjectMeta.Name
+		size, ok, err := osASG.sizeOverrides.size(osASG.clusterName, name)
+		if err != nil {
+			glog.Warningf("Not overriding size of instance group %s: %v", name, err)
+		}
+		if !ok || err != nil {
+			result = append(result, ig)
+			continue
+		}
+		if ig.Spec.Role != kops.InstanceGroupRoleNode {
+			glog.Warningf("Not overriding size of %s instance group %s", ig.Spec.Role, name)
+			result = append(result, ig)
+			continue
+		}
+		if ig.Spec.MaxSize != nil && size > *ig.Spec.MaxSize {
+			size = *ig.Spec.MaxSize
+		}
+		if size != fi.Int32Value(ig.Spec.MinSize) {
+			glog.Infof("Size of instance group %s overridden from %d to %d\n", name, fi.Int32Value(ig.Spec.MinSize), size)
+		}
+		temporary := ig.DeepCopy()
+		temporary.Spec.MinSize = fi.Int32(size)
+		result = append(result, temporary)
+	}
+	return result
+}
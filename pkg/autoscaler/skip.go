@@ -0,0 +1,66 @@
+package autoscaler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// skipMaxAge is how long executions are skipped at most. Drift which is not visible in the
+// fingerprint, e.g. in ports or volumes, is found by the next full execution.
+const skipMaxAge = time.Hour
+
+// fingerprint hashes the cluster and instance group specs together with the servers of the cluster
+func (osASG *openstackASG) fingerprint() (string, error) {
+	cloud, err := osASG.openstackCloud()
+	if err != nil {
+		return "", err
+	}
+	list, err := clusterServers(cloud, osASG.clusterName)
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+
+	cluster := osASG.ApplyCmd.Cluster
+	state := struct {
+		Annotations    map[string]string
+		Cluster        interface{}
+		InstanceGroups []interface{}
+		Servers        interface{}
+	}{
+		Annotations: cluster.ObjectMeta.Annotations,
+		Cluster:     cluster.Spec,
+		Servers:     list,
+	}
+	for _, ig := range osASG.ApplyCmd.InstanceGroups {
+		state.InstanceGroups = append(state.InstanceGroups, ig.ObjectMeta.Name, ig.Spec)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// unchanged returns true if the fingerprint matches the latest clean execution
+func (osASG *openstackASG) unchanged(fingerprint string) bool {
+	return osASG.cleanFingerprint != "" && osASG.cleanFingerprint == fingerprint &&
+		time.Since(osASG.cleanAt) < skipMaxAge
+}
+
+// markClean remembers the fingerprint of an execution which found nothing to do. Executions
+// with servers still booting are not clean, as the boots are tracked in the dry-run.
+func (osASG *openstackASG) markClean(fingerprint string, plan *Plan) {
+	if fingerprint == "" || len(plan.Changes) > 0 || len(plan.postponed) > 0 || len(plan.portFixes) > 0 || len(plan.tagFixes) > 0 || plan.poolFix != nil || len(osASG.boots) > 0 {
+		osASG.cleanFingerprint = ""
+		return
+	}
+	osASG.cleanFingerprint = fingerprint
+	osASG.cleanAt = time.Now()
+}
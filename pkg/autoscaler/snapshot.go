@@ -0,0 +1,124 @@
+package autoscaler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// version and kind of the config snapshots, the version changes when the format changes
+const (
+	SnapshotAPIVersion = "kops-autoscaler-openstack/v1"
+	SnapshotKind       = "ConfigSnapshot"
+)
+
+// Snapshot is the effective configuration of an autoscaler, exported for importing it to
+// another autoscaler
+type Snapshot struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Exported   time.Time `json:"exported"`
+	// Flags are the flags which differ from their defaults by flag name, without secrets
+	Flags map[string]string `json:"flags,omitempty"`
+	// Clusters are the per cluster settings of the annotations, overridden by the config file
+	Clusters map[string]ClusterConfig `json:"clusters,omitempty"`
+}
+
+// ExportSnapshot returns the snapshot of the flags and the per cluster settings. The annotations
+// are read from the --name cluster, or from the clusters found with --discover-all.
+func ExportSnapshot(opts *Options, flags map[string]string) (*Snapshot, error) {
+	config, err := loadConfig(opts.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{
+		APIVersion: SnapshotAPIVersion,
+		Kind:       SnapshotKind,
+		Exported:   time.Now().UTC(),
+		Flags:      flags,
+		Clusters:   make(map[string]ClusterConfig),
+	}
+
+	var names []string
+	if opts.ClusterName != "" || opts.DiscoverAll {
+		clientset, err := newClientset(opts)
+		if err != nil {
+			return nil, err
+		}
+		names = []string{opts.ClusterName}
+		if opts.DiscoverAll {
+			selector, err := labels.Parse(opts.ClusterSelector)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing cluster selector %q: %v", opts.ClusterSelector, err)
+			}
+			names, err = discoverClusters(clientset, selector)
+			if err != nil {
+				return nil, fmt.Errorf("error discovering clusters: %v", err)
+			}
+		}
+		for _, name := range names {
+			cluster, err := clientset.GetCluster(name)
+			if err != nil {
+				return nil, fmt.Errorf("error reading cluster %q: %v", name, err)
+			}
+			c, err := annotationConfig(cluster)
+			if err != nil {
+				return nil, fmt.Errorf("invalid annotations of cluster %s: %v", name, err)
+			}
+			s.Clusters[name] = c
+		}
+	}
+	for name, c := range config.Clusters {
+		s.Clusters[name] = s.Clusters[name].override(c)
+	}
+	for name, c := range s.Clusters {
+		if c.empty() {
+			delete(s.Clusters, name)
+		}
+	}
+	return s, nil
+}
+
+// empty returns true if the config does not set anything
+func (c ClusterConfig) empty() bool {
+	return c.Interval == "" && c.Paused == nil && c.InstanceGroups == nil && c.Project == "" && c.IgnoreFields == nil && c.Alerts == nil && c.Metrics == nil
+}
+
+// ReadSnapshot reads and validates the snapshot in the file
+func ReadSnapshot(path string) (*Snapshot, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot %s: %v", path, err)
+	}
+	s := &Snapshot{}
+	if err := yaml.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("error parsing snapshot %s: %v", path, err)
+	}
+	if s.Kind != SnapshotKind {
+		return nil, fmt.Errorf("%s is not a %s but %q", path, SnapshotKind, s.Kind)
+	}
+	if s.APIVersion != SnapshotAPIVersion {
+		return nil, fmt.Errorf("unsupported apiVersion %q of snapshot %s, supported is %s", s.APIVersion, path, SnapshotAPIVersion)
+	}
+	for name, c := range s.Clusters {
+		if _, err := c.apply(&clusterSettings{}); err != nil {
+			return nil, fmt.Errorf("invalid settings for cluster %s in snapshot %s: %v", name, path, err)
+		}
+	}
+	return s, nil
+}
+
+// WriteConfig writes the per cluster settings of the snapshot as --config file
+func (s *Snapshot) WriteConfig(path string) error {
+	data, err := yaml.Marshal(&Config{Clusters: s.Clusters})
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing config %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package autoscaler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+	"k8s.io/kops/pkg/apis/kops"
+)
+
+// annotationSubnetWeights weights the subnets of the instance group in --spread-subnets, e.g. "a=2,b=1"
+const annotationSubnetWeights = annotationPrefix + "subnet-weights"
+
+// subnetSequence returns the subnets of the instance group in the order the instances are spread
+// over them, instance N getting the subnet at (N-1) modulo the length. Without weights the
+// subnets take turns, with weights the smooth weighted round-robin interleaves them.
+func subnetSequence(ig *kops.InstanceGroup) ([]string, error) {
+	weights := make(map[string]int)
+	for _, subnet := range ig.Spec.Subnets {
+		weights[subnet] = 1
+	}
+	if v, ok := ig.ObjectMeta.Annotations[annotationSubnetWeights]; ok {
+		for _, pair := range splitList(v) {
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid annotation %s %q", annotationSubnetWeights, v)
+			}
+			subnet := strings.TrimSpace(parts[0])
+			if _, ok := weights[subnet]; !ok {
+				return nil, fmt.Errorf("annotation %s has subnet %q which is not a subnet of the instance group", annotationSubnetWeights, subnet)
+			}
+			weight, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+			if err != nil || weight < 0 {
+				return nil, fmt.Errorf("invalid weight %q of subnet %s in annotation %s", parts[1], subnet, annotationSubnetWeights)
+			}
+			weights[subnet] = weight
+		}
+	}
+
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("annotation %s gives no subnet a weight", annotationSubnetWeights)
+	}
+	current := make(map[string]int)
+	var sequence []string
+	for len(sequence) < total {
+		best := ""
+		for _, subnet := range ig.Spec.Subnets {
+			current[subnet] += weights[subnet]
+			if best == "" || current[subnet] > current[best] {
+				best = subnet
+			}
+		}
+		current[best] -= total
+		sequence = append(sequence, best)
+	}
+	return sequence, nil
+}
+
+// instanceNumber returns the index kops gives the server in its instance group, starting from 1
+func instanceNumber(server string) int {
+	n, err := strconv.Atoi(server[strings.LastIndex(server, "-")+1:])
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// createSpreadPort creates the port of the server in the subnet its index selects from the subnets of
+// the instance group. When the subnet has no free addresses, the other subnets are tried in turn.
+func (c *instanceCloud) createSpreadPort(o ports.CreateOpts, server string) (*ports.Port, error) {
+	var ig *kops.InstanceGroup
+	group := instanceGroupOf(c.clusterName, c.instanceGroups, server)
+	for _, g := range c.instanceGroups {
+		if g.ObjectMeta.Name == group {
+			ig = g
+		}
+	}
+	if !c.spreadSubnets || ig == nil || len(ig.Spec.Subnets) < 2 {
+		return c.OpenstackCloud.CreatePort(o)
+	}
+	sequence, err := subnetSequence(ig)
+	if err != nil {
+		return nil, err
+	}
+	start := (instanceNumber(server) - 1) % len(sequence)
+	tried := make(map[string]bool)
+	var lastErr error
+	for i := range sequence {
+		subnet := sequence[(start+i)%len(sequence)]
+		if tried[subnet] {
+			continue
+		}
+		tried[subnet] = true
+		id, err := c.subnetID(subnet)
+		if err != nil {
+			return nil, err
+		}
+		o.FixedIPs = []ports.IP{{SubnetID: id}}
+		glog.V(2).Infof("Creating port %s in subnet %s\n", o.Name, subnet)
+		port, err := c.OpenstackCloud.CreatePort(o)
+		if err == nil || !strings.Contains(err.Error(), "IpAddressGenerationFailure") {
+			return port, err
+		}
+		glog.Warningf("Subnet %s has no free addresses for port %s, trying the next subnet", subnet, o.Name)
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// subnetID returns the ID of the subnet kops created for the cluster subnet
+func (c *instanceCloud) subnetID(subnet string) (string, error) {
+	c.subnetsMu.Lock()
+	defer c.subnetsMu.Unlock()
+	if id, ok := c.subnetIDs[subnet]; ok {
+		return id, nil
+	}
+	name := subnet + "." + c.clusterName
+	list, err := c.ListSubnets(subnets.ListOpts{Name: name})
+	if err != nil {
+		return "", fmt.Errorf("error finding subnet %s: %v", name, err)
+	}
+	if len(list) != 1 {
+		return "", fmt.Errorf("found %d subnets named %s", len(list), name)
+	}
+	if c.subnetIDs == nil {
+		c.subnetIDs = make(map[string]string)
+	}
+	c.subnetIDs[subnet] = list[0].ID
+	return list[0].ID, nil
+}
@@ -0,0 +1,51 @@
+package autoscaler
+
+import (
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstacktasks"
+)
+
+// keypairName returns the name of the OpenStack keypair kops creates for the SSH key
+func keypairName(sshKey string) string {
+	name := strings.Replace(sshKey, ".", "-", -1)
+	return strings.Replace(name, ":", "_", -1)
+}
+
+// checkSSHKey checks the SSHKey field of an instance update. The embedded kops compares the
+// keypair of the server against the SSH key name without the OpenStack naming, so every server
+// is reported changed. The field is removed unless the server really has a different keypair.
+// Returns true if the keypair differs.
+func checkSSHKey(c Change, list []servers.Server) (Change, bool) {
+	if c.Type != "Instance" || c.Action != actionUpdate {
+		return c, false
+	}
+	instance, ok := c.task.(*openstacktasks.Instance)
+	if !ok {
+		return c, false
+	}
+	var fields []string
+	for _, f := range c.Fields {
+		if f != "SSHKey" {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == len(c.Fields) {
+		return c, false
+	}
+	expected := keypairName(fi.StringValue(instance.SSHKey))
+	for _, s := range list {
+		if s.Name != c.Name || s.KeyName == expected {
+			continue
+		}
+		glog.Warningf("Server %s has keypair %s, cluster SSH key is %s", s.Name, s.KeyName, expected)
+		// the other changed fields of the server are kept with SSHKey
+		c.serverID = s.ID
+		return c, true
+	}
+	c.Fields = fields
+	return c, false
+}
@@ -0,0 +1,63 @@
+package autoscaler
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/client/clientset_generated/clientset/typed/kops/internalversion"
+	"k8s.io/kops/pkg/client/simple"
+)
+
+// instrumentedClientset records metrics of the state store operations made through the clientset
+type instrumentedClientset struct {
+	simple.Clientset
+	backend string
+}
+
+func (c *instrumentedClientset) GetCluster(name string) (*kops.Cluster, error) {
+	start := time.Now()
+	cluster, err := c.Clientset.GetCluster(name)
+	observeStateStore(c.backend, "get_cluster", start, err)
+	return cluster, err
+}
+
+func (c *instrumentedClientset) ListClusters(options v1.ListOptions) (*kops.ClusterList, error) {
+	start := time.Now()
+	list, err := c.Clientset.ListClusters(options)
+	observeStateStore(c.backend, "list_clusters", start, err)
+	return list, err
+}
+
+func (c *instrumentedClientset) InstanceGroupsFor(cluster *kops.Cluster) internalversion.InstanceGroupInterface {
+	return &instrumentedInstanceGroups{
+		InstanceGroupInterface: c.Clientset.InstanceGroupsFor(cluster),
+		backend:                c.backend,
+	}
+}
+
+type instrumentedInstanceGroups struct {
+	internalversion.InstanceGroupInterface
+	backend string
+}
+
+func (c *instrumentedInstanceGroups) Get(name string, options v1.GetOptions) (*kops.InstanceGroup, error) {
+	start := time.Now()
+	ig, err := c.InstanceGroupInterface.Get(name, options)
+	observeStateStore(c.backend, "get_instancegroup", start, err)
+	return ig, err
+}
+
+func (c *instrumentedInstanceGroups) List(options v1.ListOptions) (*kops.InstanceGroupList, error) {
+	start := time.Now()
+	list, err := c.InstanceGroupInterface.List(options)
+	observeStateStore(c.backend, "list_instancegroups", start, err)
+	return list, err
+}
+
+func (c *instrumentedInstanceGroups) Update(ig *kops.InstanceGroup) (*kops.InstanceGroup, error) {
+	start := time.Now()
+	ig, err := c.InstanceGroupInterface.Update(ig)
+	observeStateStore(c.backend, "update_instancegroup", start, err)
+	return ig, err
+}
@@ -0,0 +1,285 @@
+package autoscaler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+// statusPrefix is the prefix of the names of the status config maps, followed by the cluster name
+const statusPrefix = "kops-autoscaler-status-"
+
+// ClusterStatus is the state of a cluster written to its status config map and returned by the
+// status endpoint of the admin API
+type ClusterStatus struct {
+	Cluster                 string                         `json:"cluster"`
+	LastReconcile           *time.Time                     `json:"lastReconcile,omitempty"`
+	LastSuccessfulReconcile *time.Time                     `json:"lastSuccessfulReconcile,omitempty"`
+	LastApply               *time.Time                     `json:"lastApply,omitempty"`
+	Paused                  bool                           `json:"paused"`
+	Error                   string                         `json:"error,omitempty"`
+	InstanceGroups          map[string]*InstanceGroupCount `json:"instanceGroups,omitempty"`
+	Conditions              []StatusCondition              `json:"conditions,omitempty"`
+	// History are the latest executions, only returned by the admin API
+	History []Execution `json:"history,omitempty"`
+}
+
+// historySize is the number of executions kept per cluster for the status endpoint
+const historySize = 20
+
+// Execution summarizes a past execution of a cluster
+type Execution struct {
+	Started  time.Time `json:"started"`
+	Duration string    `json:"duration"`
+	PlanID   string    `json:"planID,omitempty"`
+	Changes  int       `json:"changes"`
+	Actions  []string  `json:"actions,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// condition types of the status, following the kubernetes conventions
+const (
+	conditionReady         = "Ready"
+	conditionDegraded      = "Degraded"
+	conditionPaused        = "Paused"
+	conditionQuotaExceeded = "QuotaExceeded"
+)
+
+// StatusCondition is a condition of the cluster with the time its status last changed
+type StatusCondition struct {
+	Type               string    `json:"type"`
+	Status             string    `json:"status"`
+	Reason             string    `json:"reason"`
+	Message            string    `json:"message,omitempty"`
+	LastTransitionTime time.Time `json:"lastTransitionTime"`
+}
+
+// statusTimes are the times of the latest executions of a cluster
+type statusTimes struct {
+	reconciled time.Time
+	succeeded  time.Time
+	applied    time.Time
+}
+
+// status returns the state of the cluster after the execution which returned err
+func (osASG *openstackASG) status(err error) *ClusterStatus {
+	now := time.Now().UTC()
+	osASG.statusTimes.reconciled = now
+	if err == nil {
+		osASG.statusTimes.succeeded = now
+	}
+	s := &ClusterStatus{
+		Cluster:                 osASG.clusterName,
+		LastReconcile:           timePtr(osASG.statusTimes.reconciled),
+		LastSuccessfulReconcile: timePtr(osASG.statusTimes.succeeded),
+		LastApply:               timePtr(osASG.statusTimes.applied),
+		Paused:                  osASG.paused || (osASG.settings != nil && osASG.settings.paused),
+	}
+	if err != nil {
+		s.Error = scrubSecrets(err.Error())
+	}
+	osASG.updateConditions(err, now)
+	s.Conditions = append([]StatusCondition{}, osASG.conditions...)
+	if len(osASG.instanceGroups) > 0 {
+		s.InstanceGroups = make(map[string]*InstanceGroupCount)
+		for _, ig := range osASG.instanceGroups {
+			s.InstanceGroups[ig.ObjectMeta.Name] = &InstanceGroupCount{
+				MinSize: int(fi.Int32Value(ig.Spec.MinSize)),
+				MaxSize: int(fi.Int32Value(ig.Spec.MaxSize)),
+				Servers: osASG.serverCounts[ig.ObjectMeta.Name],
+			}
+		}
+	}
+	return s
+}
+
+// updateConditions sets the conditions of the cluster after the execution which returned err
+func (osASG *openstackASG) updateConditions(err error, now time.Time) {
+	if err != nil {
+		osASG.setCondition(conditionReady, false, "ReconcileFailed", scrubSecrets(err.Error()), now)
+	} else {
+		osASG.setCondition(conditionReady, true, "ReconcileSucceeded", "", now)
+	}
+
+	var sizes []string
+	for _, ig := range osASG.instanceGroups {
+		name := ig.ObjectMeta.Name
+		if count, ok := osASG.serverCounts[name]; ok && count != int(fi.Int32Value(ig.Spec.MinSize)) {
+			sizes = append(sizes, fmt.Sprintf("%s has %d servers, minSize %d", name, count, fi.Int32Value(ig.Spec.MinSize)))
+		}
+	}
+	var invalid []string
+	for name := range osASG.invalidGroups {
+		invalid = append(invalid, name)
+	}
+	sort.Strings(invalid)
+	switch {
+	case osASG.applyFailures > 0:
+		osASG.setCondition(conditionDegraded, true, "ApplyFailed", fmt.Sprintf("%d consecutive applies failed", osASG.applyFailures), now)
+	case len(invalid) > 0:
+		osASG.setCondition(conditionDegraded, true, "InvalidInstanceGroups", strings.Join(invalid, ", "), now)
+	case len(sizes) > 0:
+		osASG.setCondition(conditionDegraded, true, "InstanceGroupsNotAtSize", strings.Join(sizes, ", "), now)
+	default:
+		osASG.setCondition(conditionDegraded, false, "AsExpected", "", now)
+	}
+
+	switch {
+	case osASG.paused:
+		osASG.setCondition(conditionPaused, true, "PausedByAdmin", "", now)
+	case osASG.settings != nil && osASG.settings.paused:
+		osASG.setCondition(conditionPaused, true, "PausedBySettings", "", now)
+	default:
+		osASG.setCondition(conditionPaused, false, "NotPaused", "", now)
+	}
+
+	switch {
+	case osASG.quotaError != "":
+		osASG.setCondition(conditionQuotaExceeded, true, "CreateRejected", scrubSecrets(osASG.quotaError), now)
+	case quotaExceeded(err):
+		osASG.setCondition(conditionQuotaExceeded, true, "ReconcileFailed", scrubSecrets(err.Error()), now)
+	default:
+		osASG.setCondition(conditionQuotaExceeded, false, "WithinQuota", "", now)
+	}
+}
+
+// setCondition sets the condition, keeping its transition time while its status stays the same
+func (osASG *openstackASG) setCondition(conditionType string, status bool, reason string, message string, now time.Time) {
+	c := StatusCondition{
+		Type:               conditionType,
+		Status:             "False",
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: now,
+	}
+	if status {
+		c.Status = "True"
+	}
+	for i, existing := range osASG.conditions {
+		if existing.Type != conditionType {
+			continue
+		}
+		if existing.Status == c.Status {
+			c.LastTransitionTime = existing.LastTransitionTime
+		}
+		osASG.conditions[i] = c
+		return
+	}
+	osASG.conditions = append(osASG.conditions, c)
+}
+
+// conditionStatus returns the status of the condition, or Unknown
+func (s *ClusterStatus) conditionStatus(conditionType string) string {
+	for _, c := range s.Conditions {
+		if c.Type == conditionType {
+			return c.Status
+		}
+	}
+	return "Unknown"
+}
+
+// conditionReason returns the reason of the condition, or empty if it is not set
+func (s *ClusterStatus) conditionReason(conditionType string) string {
+	for _, c := range s.Conditions {
+		if c.Type == conditionType {
+			return c.Reason
+		}
+	}
+	return ""
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// newExecution summarizes the execution started at started with the result and error
+func newExecution(started time.Time, result *Result, err error) Execution {
+	e := Execution{
+		Started:  started.UTC(),
+		Duration: time.Since(started).Round(time.Millisecond).String(),
+		PlanID:   result.PlanID,
+		Changes:  len(result.Changes),
+		Actions:  result.Actions,
+	}
+	if err != nil {
+		e.Error = scrubSecrets(err.Error())
+	}
+	return e
+}
+
+// addExecution adds the execution to the history of the cluster, dropping the oldest ones
+func (osASG *openstackASG) addExecution(e Execution) {
+	osASG.history = append(osASG.history, e)
+	if len(osASG.history) > historySize {
+		osASG.history = osASG.history[len(osASG.history)-historySize:]
+	}
+}
+
+// writeStatus writes the state of the cluster to its config map in --status-namespace, so that it
+// can be followed with kubectl. Errors are only logged. The state is returned for the admin API.
+func (osASG *openstackASG) writeStatus(err error) *ClusterStatus {
+	if osASG.opts.StatusNamespace == "" || osASG.kubeClient == nil {
+		return osASG.status(err)
+	}
+	client := osASG.kubeClient.CoreV1().ConfigMaps(osASG.opts.StatusNamespace)
+	name := statusPrefix + osASG.clusterName
+	cm, getErr := client.Get(name, metav1.GetOptions{})
+	if getErr == nil && osASG.conditions == nil {
+		// the transition times of the conditions are kept over restarts
+		previous := &ClusterStatus{}
+		if json.Unmarshal([]byte(cm.Data["status.json"]), previous) == nil {
+			osASG.conditions = previous.Conditions
+		}
+	}
+
+	s := osASG.status(err)
+	data, jsonErr := json.MarshalIndent(s, "", "  ")
+	if jsonErr != nil {
+		glog.Errorf("Error encoding status of %s: %v", osASG.clusterName, jsonErr)
+		return s
+	}
+	values := map[string]string{
+		"cluster":     s.Cluster,
+		"status.json": string(data),
+		"error":       s.Error,
+		"ready":       s.conditionStatus(conditionReady),
+		"degraded":    s.conditionStatus(conditionDegraded),
+	}
+	if s.LastReconcile != nil {
+		values["lastReconcile"] = s.LastReconcile.Format(time.RFC3339)
+	}
+	if s.LastSuccessfulReconcile != nil {
+		values["lastSuccessfulReconcile"] = s.LastSuccessfulReconcile.Format(time.RFC3339)
+	}
+	if s.LastApply != nil {
+		values["lastApply"] = s.LastApply.Format(time.RFC3339)
+	}
+	if errors.IsNotFound(getErr) {
+		_, getErr = client.Create(&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Labels:      map[string]string{"app": "kops-autoscaler-openstack"},
+				Annotations: map[string]string{annotationPrefix + "cluster": osASG.clusterName},
+			},
+			Data: values,
+		})
+	} else if getErr == nil {
+		cm.Data = values
+		_, getErr = client.Update(cm)
+	}
+	if getErr != nil {
+		glog.Warningf("Error writing status of %s to config map %s/%s: %v", osASG.clusterName, osASG.opts.StatusNamespace, name, getErr)
+	}
+	return s
+}
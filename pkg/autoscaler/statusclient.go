@@ -0,0 +1,158 @@
+package autoscaler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ghodss/yaml"
+)
+
+// StatusList is the response of the status endpoint of the admin API
+type StatusList struct {
+	Clusters []*ClusterStatus `json:"clusters"`
+}
+
+// FetchStatus reads the status of the cluster, or of every managed cluster if cluster is empty,
+// from the admin API of a running autoscaler, e.g. http://localhost:8080. The CA file is used
+// to verify the certificate of a TLS admin API.
+func FetchStatus(server string, cluster string, caFile string) (*StatusList, error) {
+	u, err := url.Parse(strings.TrimSuffix(server, "/") + "/status")
+	if err != nil {
+		return nil, fmt.Errorf("invalid server %q: %v", server, err)
+	}
+	if cluster != "" {
+		u.RawQuery = url.Values{"cluster": []string{cluster}}.Encode()
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	if caFile != "" {
+		data, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA file %s: %v", caFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}
+	}
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("error reading status from %s: %v", server, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading status from %s: %v", server, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error reading status from %s: %s: %s", server, resp.Status, strings.TrimSpace(string(body)))
+	}
+	list := &StatusList{}
+	if err := json.Unmarshal(body, list); err != nil {
+		return nil, fmt.Errorf("error parsing status from %s: %v", server, err)
+	}
+	return list, nil
+}
+
+// PrintStatus prints the statuses as table, json or yaml. The table includes the executions of
+// each cluster when history is set, json and yaml always include them.
+func PrintStatus(w io.Writer, format string, list *StatusList, history bool) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	case "yaml":
+		data, err := yaml.Marshal(list)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case "table":
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLUSTER\tREADY\tDEGRADED\tPAUSED\tQUOTA EXCEEDED\tLAST RECONCILE\tLAST APPLY\tINSTANCE GROUPS")
+	for _, s := range list.Clusters {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%s\t%s\t%s\t%s\n", s.Cluster, s.conditionStatus(conditionReady),
+			s.conditionStatus(conditionDegraded), s.Paused, s.conditionStatus(conditionQuotaExceeded),
+			formatAge(s.LastReconcile), formatAge(s.LastApply), formatGroups(s.InstanceGroups))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, s := range list.Clusters {
+		if s.Error != "" {
+			fmt.Fprintf(w, "\n%s: %s\n", s.Cluster, s.Error)
+		}
+	}
+	if !history {
+		return nil
+	}
+	for _, s := range list.Clusters {
+		fmt.Fprintf(w, "\nExecutions of %s:\n", s.Cluster)
+		tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "STARTED\tDURATION\tPLAN\tCHANGES\tACTIONS\tERROR")
+		for i := len(s.History) - 1; i >= 0; i-- {
+			e := s.History[i]
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\n", e.Started.Local().Format(time.RFC3339), e.Duration,
+				dash(e.PlanID), e.Changes, len(e.Actions), dash(firstLine(e.Error)))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatAge returns how long ago the time was, or - if it is not set
+func formatAge(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return time.Since(*t).Round(time.Second).String() + " ago"
+}
+
+// formatGroups returns the servers and the minSize of the instance groups, e.g. nodes=3/3
+func formatGroups(groups map[string]*InstanceGroupCount) string {
+	var names []string
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var list []string
+	for _, name := range names {
+		list = append(list, fmt.Sprintf("%s=%d/%d", name, groups[name].Servers, groups[name].MinSize))
+	}
+	return dash(strings.Join(list, ","))
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func firstLine(s string) string {
+	return strings.SplitN(s, "\n", 2)[0]
+}
@@ -0,0 +1,272 @@
+package autoscaler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/kops/pkg/acls"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/apis/kops/registry"
+	"k8s.io/kops/pkg/client/simple"
+	"k8s.io/kops/upup/pkg/fi"
+	kopssecrets "k8s.io/kops/upup/pkg/fi/secrets"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// storeDirs are the directories of the keystore and the secretstore under the config base
+var storeDirs = []string{"pki", "secrets"}
+
+// cachingClientset keeps the files of the keystore and the secretstore of each cluster in
+// memory between executions. The cache is dropped when the ETags of the files change.
+type cachingClientset struct {
+	simple.Clientset
+	allowList bool
+
+	mu     sync.Mutex
+	caches map[string]*fileCache
+}
+
+// fileCache contains the files read from the keystore and the secretstore of a cluster
+type fileCache struct {
+	mu    sync.Mutex
+	etags string
+	files map[string]cachedFile
+	dirs  map[string][]vfs.Path
+}
+
+type cachedFile struct {
+	data []byte
+	err  error
+}
+
+func (c *cachingClientset) KeyStore(cluster *kops.Cluster) (fi.CAStore, error) {
+	basedir, err := c.storeDir(cluster, "pki")
+	if err != nil {
+		return nil, err
+	}
+	return fi.NewVFSCAStore(cluster, basedir, c.allowList), nil
+}
+
+func (c *cachingClientset) SecretStore(cluster *kops.Cluster) (fi.SecretStore, error) {
+	basedir, err := c.storeDir(cluster, "secrets")
+	if err != nil {
+		return nil, err
+	}
+	return kopssecrets.NewVFSSecretStore(cluster, basedir), nil
+}
+
+func (c *cachingClientset) SSHCredentialStore(cluster *kops.Cluster) (fi.SSHCredentialStore, error) {
+	basedir, err := c.storeDir(cluster, "pki")
+	if err != nil {
+		return nil, err
+	}
+	return fi.NewVFSSSHCredentialStore(cluster, basedir), nil
+}
+
+// storeDir returns the directory of the store under the config base of the cluster, reading
+// through the cache of the cluster. The cache is refreshed first.
+func (c *cachingClientset) storeDir(cluster *kops.Cluster, dir string) (vfs.Path, error) {
+	configBase, err := registry.ConfigBase(cluster)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	cache := c.caches[configBase.Path()]
+	if cache == nil {
+		cache = &fileCache{}
+		c.caches[configBase.Path()] = cache
+	}
+	c.mu.Unlock()
+
+	cache.refresh(configBase)
+	return &cachedPath{path: configBase.Join(dir), cache: cache, cluster: cluster}, nil
+}
+
+// refresh drops the cached files when the ETags of the store files have changed. When the
+// ETags can not be listed, nothing is cached until they can.
+func (f *fileCache) refresh(configBase vfs.Path) {
+	etags, err := storeETags(configBase)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err != nil {
+		glog.V(2).Infof("Not caching keystore and secretstore of %s: %v\n", configBase.Path(), err)
+		f.etags = ""
+		f.files = nil
+		f.dirs = nil
+		return
+	}
+	if etags != f.etags || f.files == nil {
+		f.etags = etags
+		f.files = make(map[string]cachedFile)
+		f.dirs = make(map[string][]vfs.Path)
+	}
+}
+
+// invalidate drops the cached files after a write, the ETags are listed again on next refresh
+func (f *fileCache) invalidate() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.etags = ""
+	f.files = nil
+	f.dirs = nil
+}
+
+// storeETags lists the files of the keystore and the secretstore and returns their ETags
+func storeETags(configBase vfs.Path) (string, error) {
+	var etags []string
+	for _, dir := range storeDirs {
+		p := configBase.Join(dir)
+		start := time.Now()
+		files, err := p.ReadTree()
+		if err != nil && os.IsNotExist(err) {
+			err = nil
+		}
+		observeStateStore(backendOf(p), "poll_store_etags", start, err)
+		if err != nil {
+			return "", fmt.Errorf("error listing %s: %v", p.Path(), err)
+		}
+		for _, file := range files {
+			etag, err := fileETag(file)
+			if err != nil {
+				return "", err
+			}
+			etags = append(etags, etag)
+		}
+	}
+	sort.Strings(etags)
+	return strings.Join(etags, "\n"), nil
+}
+
+// cachedPath reads the files and directory listings of a store through the cache. Writes go
+// to the state store and drop the cache.
+type cachedPath struct {
+	path    vfs.Path
+	cache   *fileCache
+	cluster *kops.Cluster
+}
+
+func (p *cachedPath) Join(relativePath ...string) vfs.Path {
+	return &cachedPath{path: p.path.Join(relativePath...), cache: p.cache, cluster: p.cluster}
+}
+
+func (p *cachedPath) Base() string {
+	return p.path.Base()
+}
+
+func (p *cachedPath) Path() string {
+	return p.path.Path()
+}
+
+func (p *cachedPath) ReadFile() ([]byte, error) {
+	key := p.path.Path()
+	p.cache.mu.Lock()
+	if p.cache.files != nil {
+		if f, ok := p.cache.files[key]; ok {
+			p.cache.mu.Unlock()
+			return append([]byte(nil), f.data...), f.err
+		}
+	}
+	p.cache.mu.Unlock()
+
+	data, err := p.path.ReadFile()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	p.cache.mu.Lock()
+	if p.cache.files != nil {
+		p.cache.files[key] = cachedFile{data: append([]byte(nil), data...), err: err}
+	}
+	p.cache.mu.Unlock()
+	return data, err
+}
+
+func (p *cachedPath) WriteTo(out io.Writer) (int64, error) {
+	data, err := p.ReadFile()
+	if err != nil {
+		return 0, err
+	}
+	return io.Copy(out, bytes.NewReader(data))
+}
+
+func (p *cachedPath) ReadDir() ([]vfs.Path, error) {
+	key := p.path.Path()
+	p.cache.mu.Lock()
+	if p.cache.dirs != nil {
+		if files, ok := p.cache.dirs[key]; ok {
+			p.cache.mu.Unlock()
+			return files, nil
+		}
+	}
+	p.cache.mu.Unlock()
+
+	list, err := p.path.ReadDir()
+	if err != nil {
+		return nil, err
+	}
+	var files []vfs.Path
+	for _, f := range list {
+		files = append(files, &cachedPath{path: f, cache: p.cache, cluster: p.cluster})
+	}
+	p.cache.mu.Lock()
+	if p.cache.dirs != nil {
+		p.cache.dirs[key] = files
+	}
+	p.cache.mu.Unlock()
+	return files, nil
+}
+
+func (p *cachedPath) ReadTree() ([]vfs.Path, error) {
+	list, err := p.path.ReadTree()
+	if err != nil {
+		return nil, err
+	}
+	var files []vfs.Path
+	for _, f := range list {
+		files = append(files, &cachedPath{path: f, cache: p.cache, cluster: p.cluster})
+	}
+	return files, nil
+}
+
+// WriteFile writes the file to the state store. The stores computed the ACL from the cached
+// path, which the ACL plugins do not recognize, so it is computed again from the real path.
+func (p *cachedPath) WriteFile(data io.ReadSeeker, acl vfs.ACL) error {
+	defer p.cache.invalidate()
+	acl, err := p.acl(acl)
+	if err != nil {
+		return err
+	}
+	return p.path.WriteFile(data, acl)
+}
+
+func (p *cachedPath) CreateFile(data io.ReadSeeker, acl vfs.ACL) error {
+	defer p.cache.invalidate()
+	acl, err := p.acl(acl)
+	if err != nil {
+		return err
+	}
+	return p.path.CreateFile(data, acl)
+}
+
+func (p *cachedPath) Remove() error {
+	defer p.cache.invalidate()
+	return p.path.Remove()
+}
+
+// IsClusterReadable tells kops whether the store can be read by the nodes, as it does for the real path
+func (p *cachedPath) IsClusterReadable() bool {
+	return vfs.IsClusterReadable(p.path)
+}
+
+func (p *cachedPath) acl(acl vfs.ACL) (vfs.ACL, error) {
+	if acl != nil {
+		return acl, nil
+	}
+	return acls.GetACL(p.path, p.cluster)
+}
@@ -0,0 +1,42 @@
+package autoscaler
+
+import (
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+// lbTypes are the task types of the API load balancer, skipped with --skip-lb-reconcile
+var lbTypes = map[string]bool{
+	"LB":              true,
+	"LBListener":      true,
+	"LBPool":          true,
+	"PoolAssociation": true,
+}
+
+// skippedType returns true if the task type belongs to a subsystem skipped with the --skip flags.
+// Changes of skipped types are not detected nor reported and their tasks are never executed.
+func (opts *Options) skippedType(taskType string) bool {
+	return (opts.SkipLBReconcile && lbTypes[taskType]) || (opts.SkipFIPReconcile && taskType == "FloatingIP")
+}
+
+// skippedTask returns true if the task is of a skipped type
+func (osASG *openstackASG) skippedTask(task fi.Task) bool {
+	return osASG.opts.skippedType(fi.TypeNameForTask(task))
+}
+
+// gcScope selects the resources of deleted servers which are removed together with them
+type gcScope struct {
+	floatingIPs bool
+	ports       bool
+}
+
+// gcAll removes the floating IPs and the ports of the deleted servers
+var gcAll = gcScope{floatingIPs: true, ports: true}
+
+// gc returns the resources removed together with the servers the autoscaler deletes. With
+// --skip-gc nothing is, and with --skip-fip-reconcile the floating IPs are left as they are.
+func (opts *Options) gc() gcScope {
+	if opts.SkipGC {
+		return gcScope{}
+	}
+	return gcScope{floatingIPs: !opts.SkipFIPReconcile, ports: true}
+}
@@ -0,0 +1,78 @@
+package autoscaler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+)
+
+// countServers returns the number of servers per instance group
+func (osASG *openstackASG) countServers(list []servers.Server) map[string]int {
+	counts := make(map[string]int)
+	for _, s := range list {
+		if ig := osASG.instanceGroupFor(s.Name); ig != "" {
+			counts[ig]++
+		}
+	}
+	return counts
+}
+
+// summary describes the changes of the plan per instance group for notifications, e.g.
+// "nodes-az1: 3→5 instances; masters: no change; infrastructure: 2 changes"
+func (osASG *openstackASG) summary(changes []Change) string {
+	type groupChanges struct {
+		delta, replaced, drifted int
+	}
+	groups := make(map[string]*groupChanges)
+	var names []string
+	for _, ig := range osASG.ApplyCmd.InstanceGroups {
+		groups[ig.ObjectMeta.Name] = &groupChanges{}
+		names = append(names, ig.ObjectMeta.Name)
+	}
+	sort.Strings(names)
+
+	infrastructure := 0
+	for _, c := range changes {
+		g := groups[osASG.instanceGroupFor(changeInstance(c))]
+		if g == nil {
+			infrastructure++
+			continue
+		}
+		switch c.Kind {
+		case kindScaleUp:
+			g.delta++
+		case kindScaleDown:
+			g.delta--
+		case kindReplacement:
+			g.replaced++
+		default:
+			g.drifted++
+		}
+	}
+
+	var parts []string
+	for _, name := range names {
+		g := groups[name]
+		current := osASG.serverCounts[name]
+		var details []string
+		if g.delta != 0 {
+			details = append(details, fmt.Sprintf("%d→%d instances", current, current+g.delta))
+		}
+		if g.replaced > 0 {
+			details = append(details, fmt.Sprintf("%d replaced", g.replaced))
+		}
+		if g.drifted > 0 {
+			details = append(details, fmt.Sprintf("%d changed", g.drifted))
+		}
+		if len(details) == 0 {
+			details = append(details, "no change")
+		}
+		parts = append(parts, name+": "+strings.Join(details, ", "))
+	}
+	if infrastructure > 0 {
+		parts = append(parts, fmt.Sprintf("infrastructure: %d changes", infrastructure))
+	}
+	return strings.Join(parts, "; ")
+}
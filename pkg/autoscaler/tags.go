@@ -0,0 +1,132 @@
+package autoscaler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+// metadataDrift is a server of the cluster which is missing metadata expected by kops
+type metadataDrift struct {
+	server servers.Server
+	// missing are the missing metadata keys with their expected values
+	missing map[string]string
+}
+
+// change describes the drift as update of the instance task
+func (d *metadataDrift) change() Change {
+	return Change{
+		Key:    "Instance/" + d.server.Name,
+		Type:   "Instance",
+		Name:   d.server.Name,
+		Action: actionUpdate,
+		Fields: []string{"Metadata"},
+		Kind:   kindDrift,
+	}
+}
+
+func (d *metadataDrift) keys() []string {
+	var keys []string
+	for k := range d.missing {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// expectedMetadata returns the metadata the servers of the instance group should have. Kops tags
+// the servers of other roles than bastion to the cluster, the role is tagged like in other clouds.
+func expectedMetadata(clusterName string, ig *kops.InstanceGroup) map[string]string {
+	metadata := map[string]string{
+		openstack.TagNameRolePrefix + strings.ToLower(string(ig.Spec.Role)): "1",
+	}
+	if ig.Spec.Role != kops.InstanceGroupRoleBastion {
+		metadata[openstack.TagClusterName] = clusterName
+	}
+	return metadata
+}
+
+// serverGroupMembers returns the instance groups of the servers in the server groups of the
+// cluster by server ID. Unlike metadata, the server group of a server can not be changed.
+func serverGroupMembers(cloud openstack.OpenstackCloud, clusterName string, instanceGroups []*kops.InstanceGroup) (map[string]*kops.InstanceGroup, error) {
+	groups, err := cloud.ListServerGroups()
+	if err != nil {
+		return nil, fmt.Errorf("error listing server groups: %v", err)
+	}
+	byName := make(map[string]*kops.InstanceGroup)
+	for _, ig := range instanceGroups {
+		byName[clusterName+"-"+ig.ObjectMeta.Name] = ig
+	}
+	members := make(map[string]*kops.InstanceGroup)
+	for _, g := range groups {
+		ig, ok := byName[g.Name]
+		if !ok {
+			continue
+		}
+		for _, id := range g.Members {
+			members[id] = ig
+		}
+	}
+	return members, nil
+}
+
+// metadataDrift checks that the servers in the server groups of the cluster have the cluster
+// and role metadata. Servers without the cluster metadata are not found by the cloud provider.
+func (osASG *openstackASG) metadataDrift(cloud openstack.OpenstackCloud) ([]*metadataDrift, error) {
+	members, err := serverGroupMembers(cloud, osASG.clusterName, osASG.ApplyCmd.InstanceGroups)
+	if err != nil {
+		return nil, err
+	}
+	list, err := cloud.ListInstances(servers.ListOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing servers: %v", err)
+	}
+	var drift []*metadataDrift
+	for _, s := range list {
+		ig, ok := members[s.ID]
+		if !ok || !osASG.managedInstance(s.Name) || osASG.foreign[s.Name] != "" {
+			continue
+		}
+		d := &metadataDrift{server: s, missing: make(map[string]string)}
+		for k, v := range expectedMetadata(osASG.clusterName, ig) {
+			if osASG.fieldIgnored("Instance", "Metadata", k) {
+				continue
+			}
+			if actual, ok := s.Metadata[k]; !ok {
+				d.missing[k] = v
+			} else if actual != v {
+				glog.Warningf("Server %s has metadata %s=%s, expected %s", s.Name, k, actual, v)
+			}
+		}
+		if len(d.missing) > 0 {
+			drift = append(drift, d)
+		}
+	}
+	sort.Slice(drift, func(i, j int) bool {
+		return drift[i].server.Name < drift[j].server.Name
+	})
+	return drift, nil
+}
+
+// fixMetadata adds the missing metadata to the servers. Other metadata is left as it is.
+func (osASG *openstackASG) fixMetadata(drift []*metadataDrift) error {
+	cloud, err := osASG.openstackCloud()
+	if err != nil {
+		return err
+	}
+	for _, d := range drift {
+		keys := strings.Join(d.keys(), ", ")
+		glog.Infof("Adding metadata %s to server %s\n", keys, d.server.Name)
+		_, err := servers.UpdateMetadata(cloud.ComputeClient(), d.server.ID, servers.MetadataOpts(d.missing)).Extract()
+		if err != nil {
+			return fmt.Errorf("error updating metadata of server %s: %v", d.server.Name, err)
+		}
+		osASG.record("added metadata %s to %s", keys, d.server.Name)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package autoscaler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+// MetricTarget sizes an instance group from a Prometheus query: the minSize is set to the value
+// of the query divided by Target, rounded up, between MinSize (default 1) and the maxSize of the
+// instance group
+type MetricTarget struct {
+	Query   string  `json:"query"`
+	Target  float64 `json:"target"`
+	MinSize *int32  `json:"minSize,omitempty"`
+}
+
+func validateMetricTargets(targets map[string]MetricTarget, alerts map[string]AlertAction) error {
+	for ig, t := range targets {
+		if t.Query == "" {
+			return fmt.Errorf("metric target of instance group %s has no query", ig)
+		}
+		if t.Target <= 0 {
+			return fmt.Errorf("target of instance group %s must be positive", ig)
+		}
+		if t.MinSize != nil && *t.MinSize < 0 {
+			return fmt.Errorf("minSize of instance group %s can not be negative", ig)
+		}
+		for name, a := range alerts {
+			if a.InstanceGroup == ig {
+				return fmt.Errorf("instance group %s is scaled by both metric target and alert %s", ig, name)
+			}
+		}
+	}
+	return nil
+}
+
+var metricDesiredSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "kops_autoscaler",
+	Name:      "metric_desired_size",
+	Help:      "Size of the instance group computed from its metric target in the latest query.",
+}, []string{"cluster", "instance_group"})
+
+func init() {
+	prometheus.MustRegister(metricDesiredSize)
+}
+
+// metricSizer sets the minSize of the instance groups with metric targets at every interval. The
+// executions of the clusters create and delete the servers.
+type metricSizer struct {
+	m      *manager
+	url    string
+	client *http.Client
+	// lowSince is the time since the desired size of the instance group has been lower than its minSize
+	lowSince map[string]time.Time
+}
+
+func newMetricSizer(m *manager) *metricSizer {
+	return &metricSizer{
+		m:        m,
+		url:      strings.TrimSuffix(m.opts.PrometheusURL, "/"),
+		client:   &http.Client{Timeout: 30 * time.Second},
+		lowSince: make(map[string]time.Time),
+	}
+}
+
+// run sizes the instance groups until ctx is done
+func (s *metricSizer) run(ctx context.Context) {
+	interval := s.m.opts.MetricsInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	for {
+		s.sizeAll(ctx)
+		if sleepContext(ctx, interval) != nil {
+			return
+		}
+	}
+}
+
+func (s *metricSizer) sizeAll(ctx context.Context) {
+	var clusters []string
+	for cluster, c := range s.m.config.Clusters {
+		if len(c.Metrics) > 0 {
+			clusters = append(clusters, cluster)
+		}
+	}
+	sort.Strings(clusters)
+	for _, cluster := range clusters {
+		changed := false
+		for ig, t := range s.m.config.Clusters[cluster].Metrics {
+			ok, err := s.size(ctx, cluster, ig, t)
+			if err != nil {
+				glog.Warningf("Error sizing instance group %s of %s from metrics: %v", ig, cluster, err)
+				continue
+			}
+			changed = changed || ok
+		}
+		if changed {
+			if err := s.m.trigger(cluster); err != nil {
+				glog.Warningf("Not executing %s after metric sizing: %v", cluster, err)
+			}
+		}
+	}
+}
+
+// size queries the metric of the instance group and sets its minSize. Returns true if the minSize
+// was changed. Sizes lower than the current minSize are set only after they have been lower for
+// the scale down delay.
+func (s *metricSizer) size(ctx context.Context, clusterName string, igName string, t MetricTarget) (bool, error) {
+	value, err := s.query(ctx, t.Query)
+	if err != nil {
+		return false, err
+	}
+	cluster, err := s.m.clientset.GetCluster(clusterName)
+	if err != nil {
+		return false, fmt.Errorf("error reading cluster: %v", err)
+	}
+	if cluster == nil {
+		return false, fmt.Errorf("cluster not found")
+	}
+	igs := s.m.clientset.InstanceGroupsFor(cluster)
+	ig, err := igs.Get(igName, metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("error reading instance group: %v", err)
+	}
+	if ig == nil {
+		return false, fmt.Errorf("instance group not found")
+	}
+
+	desired, err := t.desiredSize(value, ig.Spec.MaxSize)
+	if err != nil {
+		return false, err
+	}
+	metricDesiredSize.WithLabelValues(clusterName, igName).Set(float64(desired))
+
+	key := clusterName + "/" + igName
+	current := fi.Int32Value(ig.Spec.MinSize)
+	if desired >= current {
+		delete(s.lowSince, key)
+	}
+	if desired == current {
+		return false, nil
+	}
+	if desired < current {
+		since, ok := s.lowSince[key]
+		if !ok {
+			s.lowSince[key] = time.Now()
+			return false, nil
+		}
+		if time.Since(since) < s.m.opts.MetricsScaleDownDelay {
+			return false, nil
+		}
+		delete(s.lowSince, key)
+	}
+
+	updated := ig.DeepCopy()
+	updated.Spec.MinSize = fi.Int32(desired)
+	if _, err := igs.Update(updated); err != nil {
+		return false, fmt.Errorf("error updating instance group: %v", err)
+	}
+	glog.Infof("Metric %g of instance group %s of %s with target %g, changed minSize from %d to %d\n", value, igName, clusterName, t.Target, current, desired)
+	return true, nil
+}
+
+// desiredSize returns the size of the instance group for the value of the query, between MinSize
+// and maxSize
+func (t MetricTarget) desiredSize(value float64, maxSize *int32) (int32, error) {
+	ratio := math.Ceil(value / t.Target)
+	if math.IsNaN(ratio) {
+		return 0, fmt.Errorf("query result %v is not a number", value)
+	}
+	min := int32(1)
+	if t.MinSize != nil {
+		min = *t.MinSize
+	}
+	max := int32(math.MaxInt32)
+	if maxSize != nil {
+		max = *maxSize
+	}
+	// the ratio is clamped before the conversion, it may be infinite or out of the range of int32
+	desired := min
+	switch {
+	case ratio >= float64(max):
+		desired = max
+	case ratio > float64(min):
+		desired = int32(ratio)
+	}
+	if desired > max {
+		desired = max
+	}
+	return desired, nil
+}
+
+// prometheusResponse is the response of the Prometheus instant query API
+type prometheusResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// query returns the value of the query. The values of a vector result are summed.
+func (s *metricSizer) query(ctx context.Context, query string) (float64, error) {
+	req, err := http.NewRequest(http.MethodGet, s.url+"/api/v1/query?query="+url.QueryEscape(query), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, fmt.Errorf("error querying %s: %v", s.url, err)
+	}
+	defer resp.Body.Close()
+	result := &prometheusResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return 0, fmt.Errorf("error parsing response of %s (%s): %v", s.url, resp.Status, err)
+	}
+	if result.Status != "success" {
+		return 0, fmt.Errorf("query %q failed: %s", query, result.Error)
+	}
+
+	var samples [][]interface{}
+	switch result.Data.ResultType {
+	case "scalar":
+		var sample []interface{}
+		if err := json.Unmarshal(result.Data.Result, &sample); err != nil {
+			return 0, err
+		}
+		samples = append(samples, sample)
+	case "vector":
+		var vector []struct {
+			Value []interface{} `json:"value"`
+		}
+		if err := json.Unmarshal(result.Data.Result, &vector); err != nil {
+			return 0, err
+		}
+		if len(vector) == 0 {
+			return 0, fmt.Errorf("query %q returned no series", query)
+		}
+		for _, v := range vector {
+			samples = append(samples, v.Value)
+		}
+	default:
+		return 0, fmt.Errorf("query %q returned %s, not scalar or vector", query, result.Data.ResultType)
+	}
+
+	sum := 0.0
+	for _, sample := range samples {
+		if len(sample) != 2 {
+			return 0, fmt.Errorf("invalid sample %v", sample)
+		}
+		v, ok := sample[1].(string)
+		if !ok {
+			return 0, fmt.Errorf("invalid sample %v", sample)
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid sample value %q", v)
+		}
+		sum += f
+	}
+	if math.IsNaN(sum) || math.IsInf(sum, 0) {
+		return 0, fmt.Errorf("query %q returned %g", query, sum)
+	}
+	return sum, nil
+}
@@ -0,0 +1,42 @@
+package autoscaler
+
+import (
+	"math"
+	"testing"
+
+	"k8s.io/kops/upup/pkg/fi"
+)
+
+func TestDesiredSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   float64
+		minSize *int32
+		maxSize *int32
+		want    int32
+		wantErr bool
+	}{
+		{name: "rounded up", value: 25, want: 3},
+		{name: "below default minSize", value: 0, want: 1},
+		{name: "below minSize", value: 5, minSize: fi.Int32(2), want: 2},
+		{name: "over maxSize", value: 1000, maxSize: fi.Int32(5), want: 5},
+		{name: "minSize over maxSize", value: 5, minSize: fi.Int32(8), maxSize: fi.Int32(5), want: 5},
+		{name: "over int32 without maxSize", value: 1e12, want: math.MaxInt32},
+		{name: "over int32 with maxSize", value: 1e12, maxSize: fi.Int32(10), want: 10},
+		{name: "positive infinity", value: math.Inf(1), maxSize: fi.Int32(10), want: 10},
+		{name: "negative infinity", value: math.Inf(-1), minSize: fi.Int32(2), want: 2},
+		{name: "negative", value: -1e12, want: 1},
+		{name: "not a number", value: math.NaN(), wantErr: true},
+	}
+	for _, tt := range tests {
+		target := MetricTarget{Query: "q", Target: 10, MinSize: tt.minSize}
+		got, err := target.desiredSize(tt.value, tt.maxSize)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package autoscaler
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// throttleRetryBase is the wait before the first retry of a throttled request without Retry-After,
+// doubled on every consecutive throttled request to the same service
+const throttleRetryBase = time.Second
+
+var throttledRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "kops_autoscaler",
+	Name:      "openstack_throttled_requests_total",
+	Help:      "Number of OpenStack API requests answered with 429 or 409 and retried.",
+}, []string{"service", "code"})
+
+func init() {
+	prometheus.MustRegister(throttledRequests)
+}
+
+// throttles is the backoff state of the OpenStack services, shared by all clusters
+var throttles = &serviceThrottles{
+	services: make(map[string]*serviceThrottle),
+	rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+}
+
+type serviceThrottles struct {
+	mu       sync.Mutex
+	services map[string]*serviceThrottle
+	rand     *rand.Rand
+}
+
+// serviceThrottle holds back the requests to a service until the backoff has passed
+type serviceThrottle struct {
+	failures int
+	until    time.Time
+}
+
+// wait sleeps until the backoff of the service has passed, or until ctx is done
+func (t *serviceThrottles) wait(ctx context.Context, service string) error {
+	t.mu.Lock()
+	s := t.services[service]
+	var until time.Time
+	if s != nil {
+		until = s.until
+	}
+	t.mu.Unlock()
+	if d := time.Until(until); d > 0 {
+		return sleepContext(ctx, d)
+	}
+	return nil
+}
+
+// backoff returns the time to wait before retrying a throttled request to the service. The
+// Retry-After of the response is honored, otherwise the wait grows exponentially with jitter.
+func (t *serviceThrottles) backoff(service string, retryAfter time.Duration, maxWait time.Duration) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.services[service]
+	if s == nil {
+		s = &serviceThrottle{}
+		t.services[service] = s
+	}
+	s.failures++
+	wait := retryAfter
+	if wait <= 0 {
+		base := throttleRetryBase << uint(s.failures-1)
+		if base <= 0 || base > maxWait {
+			base = maxWait
+		}
+		// random wait between half and all of the backoff spreads the retries of concurrent tasks
+		wait = base/2 + time.Duration(t.rand.Int63n(int64(base/2)+1))
+	}
+	if wait > maxWait {
+		wait = maxWait
+	}
+	s.until = time.Now().Add(wait)
+	return wait
+}
+
+// success resets the backoff of the service
+func (t *serviceThrottles) success(service string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.services, service)
+}
+
+// throttleTransport retries the OpenStack API requests answered with 429 Too Many Requests or
+// 409 Conflict, instead of failing the task and the execution
+type throttleTransport struct {
+	next    http.RoundTripper
+	retries int
+	maxWait time.Duration
+}
+
+func newThrottleTransport(next http.RoundTripper, opts *Options) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &throttleTransport{
+		next:    next,
+		retries: opts.APIRetries,
+		maxWait: opts.APIRetryMaxWait,
+	}
+}
+
+func (t *throttleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	service := req.URL.Host
+	// requests whose body can not be read again are sent once
+	retries := t.retries
+	if req.Body != nil && req.GetBody == nil {
+		retries = 0
+	}
+	for attempt := 0; ; attempt++ {
+		if err := throttles.wait(req.Context(), service); err != nil {
+			return nil, err
+		}
+		r := req
+		if attempt > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.WithContext(req.Context())
+			r.Body = body
+		}
+		resp, err := t.next.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusConflict {
+			throttles.success(service)
+			return resp, nil
+		}
+		if attempt >= retries {
+			return resp, nil
+		}
+		wait := throttles.backoff(service, retryAfterOf(resp), t.maxWait)
+		throttledRequests.WithLabelValues(service, strconv.Itoa(resp.StatusCode)).Inc()
+		glog.Warningf("%s answered %s to %s %s, retrying in %v", service, resp.Status, req.Method, req.URL.Path, wait)
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+// retryAfterOf returns the wait requested in the Retry-After header of the response, in seconds
+// or as HTTP date, or zero
+func retryAfterOf(resp *http.Response) time.Duration {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
@@ -0,0 +1,111 @@
+package autoscaler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+)
+
+// userDataPart is a cloud-init part appended to the user data of created servers
+type userDataPart struct {
+	filename    string
+	contentType string
+	content     []byte
+}
+
+// loadUserData reads the extra user data parts from comma separated list of files
+func loadUserData(files string) ([]userDataPart, error) {
+	var parts []userDataPart
+	for _, file := range splitList(files) {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading user data %s: %v", file, err)
+		}
+		parts = append(parts, userDataPart{
+			filename:    filepath.Base(file),
+			contentType: userDataContentType(content),
+			content:     content,
+		})
+	}
+	return parts, nil
+}
+
+// userDataContentType returns the cloud-init content type of the user data
+func userDataContentType(content []byte) string {
+	s := string(content)
+	switch {
+	case strings.HasPrefix(s, "#!"):
+		return "text/x-shellscript"
+	case strings.HasPrefix(s, "#cloud-config"):
+		return "text/cloud-config"
+	case strings.HasPrefix(s, "#include"):
+		return "text/x-include-url"
+	case strings.HasPrefix(s, "#cloud-boothook"):
+		return "text/cloud-boothook"
+	case strings.HasPrefix(s, "Content-Type: multipart/"):
+		return "multipart/mixed"
+	}
+	return "text/plain"
+}
+
+// multipartUserData combines the user data of kops and the extra parts to MIME multipart
+// message, which cloud-init processes part by part
+func multipartUserData(original []byte, parts []userDataPart) ([]byte, error) {
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	fmt.Fprintf(&b, "Content-Type: multipart/mixed; boundary=%q\r\nMIME-Version: 1.0\r\n\r\n", w.Boundary())
+	all := parts
+	if len(original) > 0 {
+		all = append([]userDataPart{{filename: "kops", contentType: userDataContentType(original), content: original}}, parts...)
+	}
+	for _, part := range all {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType+"; charset=\"us-ascii\"")
+		header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", part.filename))
+		pw, err := w.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := pw.Write(part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// userDataOpts appends the extra parts to the user data of the server create request
+type userDataOpts struct {
+	servers.CreateOptsBuilder
+	parts []userDataPart
+}
+
+func (opts *userDataOpts) ToServerCreateMap() (map[string]interface{}, error) {
+	m, err := opts.CreateOptsBuilder.ToServerCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	server := m["server"].(map[string]interface{})
+	var original []byte
+	if encoded, ok := server["user_data"].(string); ok {
+		original, err = base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding user data: %v", err)
+		}
+	}
+	userData, err := multipartUserData(original, opts.parts)
+	if err != nil {
+		return nil, fmt.Errorf("error building user data: %v", err)
+	}
+	server["user_data"] = base64.StdEncoding.EncodeToString(userData)
+	return m, nil
+}
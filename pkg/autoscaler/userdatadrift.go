@@ -0,0 +1,230 @@
+package autoscaler
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"regexp"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"k8s.io/kops/pkg/diff"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstacktasks"
+)
+
+// userDataMicroversion is the compute microversion from which servers show their user data
+const userDataMicroversion = "2.3"
+
+var (
+	// secretAssignment is a line of the user data setting a password, token or key
+	secretAssignment = regexp.MustCompile(`(?i)^(\s*(?:export\s+)?[\w.-]*(?:password|passwd|secret|token|access_key|private_key)[\w.-]*\s*[=:]\s*)(.+)$`)
+	// privateKeyBlock is a PEM encoded private key in the user data
+	privateKeyBlock = regexp.MustCompile(`(?s)-----BEGIN ([A-Z ]*)PRIVATE KEY-----.*?-----END ([A-Z ]*)PRIVATE KEY-----`)
+	// maskKey keys the hashes of the masked secrets, so that they can not be guessed from the hash
+	maskKey = make([]byte, 32)
+)
+
+func init() {
+	if _, err := rand.Read(maskKey); err != nil {
+		panic(err)
+	}
+}
+
+// checkUserData checks the UserData field of an instance update. The embedded kops does not read
+// the user data of servers, so every server is reported changed. The field is removed and the user
+// data of the server is compared against the one kops renders instead. Returns true with a diff
+// of the user data in the change if it differs.
+func (osASG *openstackASG) checkUserData(cloud openstack.OpenstackCloud, c Change, list []servers.Server) (Change, bool) {
+	if c.Type != "Instance" || c.Action != actionUpdate {
+		return c, false
+	}
+	instance, ok := c.task.(*openstacktasks.Instance)
+	if !ok {
+		return c, false
+	}
+	var fields []string
+	for _, f := range c.Fields {
+		if f != "UserData" {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == len(c.Fields) {
+		return c, false
+	}
+	c.Fields = fields
+	if caps := osASG.features(); caps != nil && !caps.supportsCompute(userDataMicroversion) {
+		return c, false
+	}
+	var server *servers.Server
+	for i := range list {
+		if list[i].Name == c.Name {
+			server = &list[i]
+		}
+	}
+	if server == nil {
+		return c, false
+	}
+
+	expected, err := osASG.expectedUserData(fi.StringValue(instance.UserData))
+	if err != nil {
+		glog.Warningf("Error rendering user data of %s: %v", c.Name, err)
+		return c, false
+	}
+	// the user data of a server does not change, only its hash is kept between executions
+	if h, ok := osASG.userDataHashes[server.ID]; ok && h == hashUserData(expected) {
+		return c, false
+	}
+	actual, found, err := serverUserData(cloud, server.ID)
+	if err != nil {
+		glog.Warningf("Error reading user data of %s: %v", c.Name, err)
+		return c, false
+	}
+	if !found {
+		glog.V(2).Infof("User data of %s is not visible, needs compute microversion %s and the permission to see it\n", c.Name, userDataMicroversion)
+		return c, false
+	}
+	actualText, err := userDataText(actual)
+	if err != nil {
+		glog.Warningf("Error parsing user data of %s: %v", c.Name, err)
+		return c, false
+	}
+	if osASG.userDataHashes == nil {
+		osASG.userDataHashes = make(map[string]string)
+	}
+	osASG.userDataHashes[server.ID] = hashUserData(actualText)
+	if actualText == expected {
+		return c, false
+	}
+	c.Fields = []string{"UserData"}
+	c.serverID = server.ID
+	c.Diff = userDataDiff(actualText, expected)
+	glog.Warningf("User data of %s differs from instance group:\n%s", c.Name, c.Diff)
+	return c, true
+}
+
+// expectedUserData returns the user data kops renders with the extra parts of --extra-user-data
+func (osASG *openstackASG) expectedUserData(rendered string) (string, error) {
+	parts, err := loadUserData(osASG.opts.ExtraUserData)
+	if err != nil {
+		return "", err
+	}
+	if len(parts) == 0 {
+		return rendered, nil
+	}
+	data, err := multipartUserData([]byte(rendered), parts)
+	if err != nil {
+		return "", err
+	}
+	return userDataText(data)
+}
+
+// serverUserData reads the user data of the server. Returns false if the server does not show it,
+// which needs the compute microversion 2.3 and by default admin permissions.
+func serverUserData(cloud openstack.OpenstackCloud, id string) ([]byte, bool, error) {
+	client := *cloud.ComputeClient()
+	client.Microversion = userDataMicroversion
+	var body struct {
+		Server map[string]interface{} `json:"server"`
+	}
+	_, err := client.Get(client.ServiceURL("servers", id), &body, &gophercloud.RequestOpts{OkCodes: []int{200}})
+	if err != nil {
+		return nil, false, err
+	}
+	encoded, ok := body.Server["OS-EXT-SRV-ATTR:user_data"].(string)
+	if !ok {
+		return nil, false, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, false, fmt.Errorf("error decoding user data: %v", err)
+	}
+	return data, true, nil
+}
+
+// userDataText returns the user data as text. The parts of a MIME multipart message, created with
+// --extra-user-data, are listed one after another with their names, so that their boundaries do not
+// show up as changes.
+func userDataText(data []byte) (string, error) {
+	header := strings.SplitN(string(data), "\r\n", 2)[0]
+	if !strings.HasPrefix(header, "Content-Type: multipart/") {
+		return string(data), nil
+	}
+	_, params, err := mime.ParseMediaType(strings.TrimPrefix(header, "Content-Type: "))
+	if err != nil {
+		return "", err
+	}
+	r := multipart.NewReader(bytes.NewReader(data), params["boundary"])
+	var b strings.Builder
+	for {
+		part, err := r.NextPart()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return "", err
+		}
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "### part %s (%s)\n%s\n", part.FileName(), part.Header.Get("Content-Type"), content)
+	}
+	return b.String(), nil
+}
+
+func hashUserData(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+// userDataDiff renders the differences between the user data of the server and the one of the
+// instance group, with passwords, tokens and keys masked
+func userDataDiff(actual string, expected string) string {
+	return fmt.Sprintf("--- server\n+++ instance group\n%s", diff.FormatDiff(maskUserData(actual), maskUserData(expected)))
+}
+
+// maskUserData replaces the secrets in the user data. A masked value is followed by a short keyed
+// hash, so that a changed secret still shows up in the diff without revealing it.
+func maskUserData(s string) string {
+	s = privateKeyBlock.ReplaceAllStringFunc(s, func(block string) string {
+		return redacted + " private key " + maskHash(block)
+	})
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if m := secretAssignment.FindStringSubmatch(l); m != nil {
+			lines[i] = m[1] + redacted + " " + maskHash(m[2])
+		}
+	}
+	return scrubSecrets(strings.Join(lines, "\n"))
+}
+
+func maskHash(secret string) string {
+	h := hmac.New(sha256.New, maskKey)
+	h.Write([]byte(secret))
+	return hex.EncodeToString(h.Sum(nil))[:8]
+}
+
+// pruneUserDataHashes forgets the user data of the servers which no longer exist
+func (osASG *openstackASG) pruneUserDataHashes(list []servers.Server) {
+	existing := make(map[string]bool)
+	for _, s := range list {
+		existing[s.ID] = true
+	}
+	for id := range osASG.userDataHashes {
+		if !existing[id] {
+			delete(osASG.userDataHashes, id)
+		}
+	}
+}
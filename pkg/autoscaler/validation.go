@@ -0,0 +1,142 @@
+package autoscaler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/images"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/apis/kops/validation"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+// validateInstanceGroups validates the instance groups like kops does and checks that their
+// flavors, images and provider networks exist, as kops finds them by name. The result of each instance group is
+// exported as metric and invalid instance groups are notified once per error.
+func (osASG *openstackASG) validateInstanceGroups(cluster *kops.Cluster, instanceGroups []*kops.InstanceGroup) error {
+	cloud, err := osASG.cloudFor(cluster)
+	if err != nil {
+		return err
+	}
+	// the images API of compute is not available in newer microversions, the checks are
+	// skipped if listing fails
+	flavorCounts, err := flavorNames(cloud)
+	if err != nil {
+		glog.Warningf("Not checking flavors of instance groups: %v", err)
+	}
+	imageCounts, err := imageNames(cloud)
+	if err != nil {
+		glog.Warningf("Not checking images of instance groups: %v", err)
+	}
+
+	if osASG.invalidGroups == nil {
+		osASG.invalidGroups = make(map[string]string)
+	}
+	osASG.providerNetworks = make(map[string]*providerNetwork)
+	var invalid []string
+	for _, ig := range instanceGroups {
+		name := ig.ObjectMeta.Name
+		var problems []string
+		if err := validation.CrossValidateInstanceGroup(ig, cluster, false); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if _, err := subnetSequence(ig); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if _, err := groupInterval(ig); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if _, err := groupCooldown(ig); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if _, err := churnBudget(ig); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if _, err := replacementPolicy(ig); err != nil {
+			problems = append(problems, err.Error())
+		}
+		pn, problem := resolveProviderNetwork(cloud, cluster, ig)
+		if problem != "" {
+			problems = append(problems, problem)
+		} else if pn != nil {
+			osASG.providerNetworks[name] = pn
+		}
+		if problem := checkUnique("flavor", ig.Spec.MachineType, flavorCounts); problem != "" {
+			problems = append(problems, problem)
+		}
+		if problem := checkUnique("image", ig.Spec.Image, imageCounts); problem != "" {
+			problems = append(problems, problem)
+		}
+
+		if len(problems) == 0 {
+			instanceGroupValid.WithLabelValues(osASG.clusterName, name).Set(1)
+			delete(osASG.invalidGroups, name)
+			continue
+		}
+		instanceGroupValid.WithLabelValues(osASG.clusterName, name).Set(0)
+		message := strings.Join(problems, ", ")
+		if osASG.invalidGroups[name] != message {
+			osASG.invalidGroups[name] = message
+			osASG.notifier.notify(osASG.clusterName, "InvalidInstanceGroup", fmt.Sprintf("instance group %s: %s", name, message))
+		}
+		invalid = append(invalid, name+": "+message)
+	}
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		return fmt.Errorf("invalid instance groups: %s", strings.Join(invalid, "; "))
+	}
+	return nil
+}
+
+// flavorNames returns the number of flavors by name
+func flavorNames(cloud openstack.OpenstackCloud) (map[string]int, error) {
+	page, err := flavors.ListDetail(cloud.ComputeClient(), flavors.ListOpts{}).AllPages()
+	if err != nil {
+		return nil, fmt.Errorf("error listing flavors: %v", err)
+	}
+	list, err := flavors.ExtractFlavors(page)
+	if err != nil {
+		return nil, fmt.Errorf("error listing flavors: %v", err)
+	}
+	names := make(map[string]int)
+	for _, f := range list {
+		names[f.Name]++
+	}
+	return names, nil
+}
+
+// imageNames returns the number of images by name
+func imageNames(cloud openstack.OpenstackCloud) (map[string]int, error) {
+	page, err := images.ListDetail(cloud.ComputeClient(), images.ListOpts{}).AllPages()
+	if err != nil {
+		return nil, fmt.Errorf("error listing images: %v", err)
+	}
+	list, err := images.ExtractImages(page)
+	if err != nil {
+		return nil, fmt.Errorf("error listing images: %v", err)
+	}
+	names := make(map[string]int)
+	for _, i := range list {
+		names[i.Name]++
+	}
+	return names, nil
+}
+
+// checkUnique returns description of the problem if the name does not match exactly one
+// resource. Nothing is checked if the resources could not be listed.
+func checkUnique(kind string, name string, names map[string]int) string {
+	switch {
+	case names == nil:
+		return ""
+	case name == "":
+		return fmt.Sprintf("%s is not set", kind)
+	case names[name] == 0:
+		return fmt.Sprintf("%s %q not found", kind, name)
+	case names[name] > 1:
+		return fmt.Sprintf("%d %ss named %q", names[name], kind, name)
+	}
+	return ""
+}
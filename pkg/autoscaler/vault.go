@@ -0,0 +1,248 @@
+package autoscaler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// serviceAccountToken is the token used to log in to Vault with the kubernetes auth method
+const serviceAccountToken = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// vaultRetryInterval is the time between retries of failed Vault requests
+const vaultRetryInterval = time.Minute
+
+// vaultSecret is the response of Vault to reads and logins
+type vaultSecret struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+// vaultLease is a secret read from Vault and the time it must be renewed or read again
+type vaultLease struct {
+	path      string
+	leaseID   string
+	renewable bool
+	refresh   time.Time
+}
+
+// vaultCredentials fetches S3 and OpenStack credentials from Vault and renews them before they expire
+type vaultCredentials struct {
+	address    string
+	role       string
+	stateStore string
+	client     *http.Client
+
+	token        string
+	tokenRefresh time.Time
+	renewToken   bool
+	leases       []*vaultLease
+}
+
+// loadVaultCredentials logs in to Vault and sets the S3_ and OS_ keys of the secrets at the
+// comma separated paths as environment variables
+func loadVaultCredentials(opts *Options) (*vaultCredentials, error) {
+	v := &vaultCredentials{
+		address:    strings.TrimSuffix(opts.VaultAddress, "/"),
+		role:       opts.VaultRole,
+		stateStore: opts.StateStore,
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}
+	if err := v.login(); err != nil {
+		return nil, err
+	}
+	for _, path := range splitList(opts.VaultSecrets) {
+		lease := &vaultLease{path: path}
+		if _, err := v.read(lease); err != nil {
+			return nil, err
+		}
+		v.leases = append(v.leases, lease)
+	}
+	return v, nil
+}
+
+// login gets the Vault token with the kubernetes auth method when a role is set, otherwise from VAULT_TOKEN
+func (v *vaultCredentials) login() error {
+	if v.role == "" {
+		v.token = os.Getenv("VAULT_TOKEN")
+		if v.token == "" {
+			return fmt.Errorf("VAULT_TOKEN or Vault role is required")
+		}
+		return nil
+	}
+	jwt, err := ioutil.ReadFile(serviceAccountToken)
+	if err != nil {
+		return fmt.Errorf("error reading service account token: %v", err)
+	}
+	secret := &vaultSecret{}
+	err = v.request(http.MethodPost, "auth/kubernetes/login", map[string]string{"role": v.role, "jwt": string(jwt)}, secret)
+	if err != nil {
+		return fmt.Errorf("error logging in to Vault: %v", err)
+	}
+	if secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return fmt.Errorf("error logging in to Vault: no token in response")
+	}
+	v.setToken(secret)
+	return nil
+}
+
+func (v *vaultCredentials) setToken(secret *vaultSecret) {
+	v.token = secret.Auth.ClientToken
+	registerSecret(v.token)
+	v.renewToken = secret.Auth.Renewable
+	v.tokenRefresh = refreshTime(secret.Auth.LeaseDuration)
+}
+
+// read reads the secret of the lease and sets its credentials, returning the changed variables
+func (v *vaultCredentials) read(lease *vaultLease) ([]string, error) {
+	secret := &vaultSecret{}
+	if err := v.request(http.MethodGet, lease.path, nil, secret); err != nil {
+		return nil, fmt.Errorf("error reading Vault secret %s: %v", lease.path, err)
+	}
+	data := secret.Data
+	// kv version 2 nests the values
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+	values := make(map[string]string)
+	for k, value := range data {
+		if s, ok := value.(string); ok {
+			values[k] = s
+		}
+	}
+	lease.leaseID = secret.LeaseID
+	lease.renewable = secret.Renewable
+	lease.refresh = refreshTime(secret.LeaseDuration)
+	return setCredentials(values)
+}
+
+// renew extends the lease of the secret, or reads the secret again if it can not be renewed
+func (v *vaultCredentials) renew(lease *vaultLease) ([]string, error) {
+	if lease.renewable && lease.leaseID != "" {
+		secret := &vaultSecret{}
+		err := v.request(http.MethodPut, "sys/leases/renew", map[string]string{"lease_id": lease.leaseID}, secret)
+		if err == nil && secret.LeaseDuration > 0 {
+			lease.refresh = refreshTime(secret.LeaseDuration)
+			return nil, nil
+		}
+		glog.Warningf("Error renewing Vault lease of %s, reading it again: %v", lease.path, err)
+	}
+	return v.read(lease)
+}
+
+// run renews the token and the leases before they expire, until ctx is done
+func (v *vaultCredentials) run(ctx context.Context) {
+	for {
+		if sleepContext(ctx, time.Until(v.nextRefresh())) != nil {
+			return
+		}
+		if err := v.refresh(); err != nil {
+			glog.Errorf("Error refreshing Vault credentials %v", err)
+			if sleepContext(ctx, vaultRetryInterval) != nil {
+				return
+			}
+		}
+	}
+}
+
+// nextRefresh returns the earliest time the token or a lease needs to be refreshed
+func (v *vaultCredentials) nextRefresh() time.Time {
+	next := v.tokenRefresh
+	for _, lease := range v.leases {
+		if !lease.refresh.IsZero() && (next.IsZero() || lease.refresh.Before(next)) {
+			next = lease.refresh
+		}
+	}
+	if next.IsZero() {
+		// nothing expires, check again later
+		next = time.Now().Add(time.Hour)
+	}
+	return next
+}
+
+func (v *vaultCredentials) refresh() error {
+	now := time.Now()
+	if !v.tokenRefresh.IsZero() && !now.Before(v.tokenRefresh) {
+		secret := &vaultSecret{}
+		err := fmt.Errorf("token is not renewable")
+		if v.renewToken {
+			err = v.request(http.MethodPost, "auth/token/renew-self", map[string]string{}, secret)
+		}
+		if err == nil && secret.Auth != nil {
+			v.setToken(secret)
+		} else if err := v.login(); err != nil {
+			return err
+		}
+	}
+	for _, lease := range v.leases {
+		if lease.refresh.IsZero() || now.Before(lease.refresh) {
+			continue
+		}
+		changed, err := v.renew(lease)
+		if err != nil {
+			return err
+		}
+		if len(changed) > 0 {
+			glog.Infof("Credentials rotated in Vault secret %s: %s\n", lease.path, strings.Join(changed, ", "))
+			credentialsRotated(v.stateStore, changed)
+		}
+	}
+	return nil
+}
+
+func (v *vaultCredentials) request(method string, path string, body interface{}, out *vaultSecret) error {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, v.address+"/v1/"+strings.TrimPrefix(path, "/"), reader)
+	if err != nil {
+		return err
+	}
+	if v.token != "" {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && resp.StatusCode < 300 {
+		return fmt.Errorf("error parsing response: %v", err)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Vault returned %s %s", resp.Status, strings.Join(out.Errors, ", "))
+	}
+	return nil
+}
+
+// refreshTime returns the time a lease of the given seconds is refreshed, at two thirds of its
+// duration, or zero time for secrets without lease
+func refreshTime(seconds int) time.Time {
+	if seconds <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(seconds) * time.Second * 2 / 3)
+}
@@ -0,0 +1,136 @@
+package autoscaler
+
+import (
+	"fmt"
+
+	"github.com/blang/semver"
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kopsversion "k8s.io/kops"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/pkg/apis/kops/registry"
+	"k8s.io/kops/pkg/apis/kops/util"
+	"k8s.io/kops/pkg/kopscodecs"
+	"k8s.io/kops/util/pkg/vfs"
+)
+
+// checkVersionSkew refuses to operate on clusters running a newer kubernetes version than
+// the embedded kops supports. With --allow-version-skew the skew is only logged.
+func (osASG *openstackASG) checkVersionSkew(cluster *kops.Cluster) error {
+	err := versionSkew(cluster)
+	if err == nil {
+		return nil
+	}
+	if osASG.opts.AllowVersionSkew {
+		glog.Warningf("VERSION SKEW in cluster %s, results may be wrong: %v", cluster.ObjectMeta.Name, err)
+		return nil
+	}
+	return fmt.Errorf("refusing to operate on cluster %s: %v", cluster.ObjectMeta.Name, err)
+}
+
+func versionSkew(cluster *kops.Cluster) error {
+	kopsVersion, err := semver.ParseTolerant(kopsversion.Version)
+	if err != nil {
+		return fmt.Errorf("error parsing kops version %q: %v", kopsversion.Version, err)
+	}
+	kubernetesVersion, err := util.ParseKubernetesVersion(cluster.Spec.KubernetesVersion)
+	if err != nil {
+		return fmt.Errorf("error parsing kubernetesVersion %q: %v", cluster.Spec.KubernetesVersion, err)
+	}
+	if kubernetesVersion.Major > kopsVersion.Major ||
+		(kubernetesVersion.Major == kopsVersion.Major && kubernetesVersion.Minor > kopsVersion.Minor) {
+		return fmt.Errorf("kubernetesVersion %s is newer than supported by embedded kops %s", cluster.Spec.KubernetesVersion, kopsversion.Version)
+	}
+	return nil
+}
+
+// unsupportedSpecError is returned when the stored specs use an api version which the embedded
+// kops can not read. It does not change until the specs or the autoscaler are upgraded.
+type unsupportedSpecError struct {
+	message string
+}
+
+func (e *unsupportedSpecError) Error() string {
+	return e.message
+}
+
+// schemaSkew checks whether the stored cluster or instance group specs use an api version which
+// the embedded kops can not read. It is used to explain errors reading the cluster.
+func schemaSkew(registryBase vfs.Path, clusterName string) error {
+	if err := specSkew(registryBase.Join(clusterName, registry.PathCluster), "cluster spec"); err != nil {
+		return err
+	}
+	igs, err := registryBase.Join(clusterName, "instancegroup").ReadDir()
+	if err != nil {
+		return nil
+	}
+	for _, p := range igs {
+		if err := specSkew(p, "instance group "+p.Base()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func specSkew(p vfs.Path, what string) error {
+	data, err := p.ReadFile()
+	if err != nil {
+		return nil
+	}
+	meta := struct {
+		APIVersion string `json:"apiVersion"`
+	}{}
+	if err := yaml.Unmarshal(data, &meta); err != nil || meta.APIVersion == "" {
+		return nil
+	}
+	gv, err := schema.ParseGroupVersion(meta.APIVersion)
+	if err != nil {
+		return &unsupportedSpecError{fmt.Sprintf("%s has invalid apiVersion %q", what, meta.APIVersion)}
+	}
+	if !kopscodecs.Scheme.IsVersionRegistered(gv) {
+		return &unsupportedSpecError{fmt.Sprintf("unsupported spec version: %s apiVersion %s is not supported by embedded kops %s", what, meta.APIVersion, kopsversion.Version)}
+	}
+	return nil
+}
+
+// specError explains the error reading the specs of the cluster. If the specs use an unsupported
+// api version, the cluster is marked unsupported and notified once.
+func (osASG *openstackASG) specError(err error) error {
+	registryBase, perr := vfs.Context.BuildVfsPath(osASG.opts.StateStore)
+	if perr != nil {
+		return err
+	}
+	skew := schemaSkew(registryBase, osASG.clusterName)
+	if skew == nil {
+		return err
+	}
+	unsupportedSpec.WithLabelValues(osASG.clusterName).Set(1)
+	if osASG.unsupportedSpec != skew.Error() {
+		osASG.unsupportedSpec = skew.Error()
+		osASG.notifier.notify(osASG.clusterName, "UnsupportedSpecVersion", skew.Error())
+	}
+	return skew
+}
+
+// specSupported clears the unsupported state after the specs have been read
+func (osASG *openstackASG) specSupported() {
+	unsupportedSpec.WithLabelValues(osASG.clusterName).Set(0)
+	osASG.unsupportedSpec = ""
+	osASG.loggedError = ""
+}
+
+// logError logs the error of an execution, counts it by class and sends it to the event sink. Unsupported spec
+// versions are logged only once, as they do not change on their own.
+func (osASG *openstackASG) logError(err error) {
+	reconcileErrors.WithLabelValues(osASG.clusterName, errorClass(err)).Inc()
+	if _, ok := err.(*unsupportedSpecError); ok {
+		if osASG.loggedError == err.Error() {
+			glog.V(2).Infof("%s: %v", osASG.clusterName, err)
+			return
+		}
+		osASG.loggedError = err.Error()
+	}
+	glog.Errorf("%s: %v", osASG.clusterName, err)
+	osASG.notifier.event(eventReconcileFailed, osASG.clusterName, &eventData{Error: scrubSecrets(err.Error())})
+}
@@ -0,0 +1,152 @@
+package autoscaler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/golang/glog"
+	cinder "github.com/gophercloud/gophercloud/openstack/blockstorage/v2/volumes"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+const (
+	// annotationVolumeBoot enables boot from volume for the instance group, the same annotations
+	// are used by later kops versions
+	annotationVolumeBoot = "openstack.kops.io/osVolumeBoot"
+	// annotationVolumeSize overrides the rootVolumeSize of the instance group
+	annotationVolumeSize = "openstack.kops.io/osVolumeSize"
+)
+
+// rootVolume describes the Cinder root volume of servers booting from volume
+type rootVolume struct {
+	size       int
+	volumeType string
+}
+
+// rootVolumeFor returns the root volume of the instance group, or nil if it boots from image
+func rootVolumeFor(ig *kops.InstanceGroup) (*rootVolume, error) {
+	if ig.ObjectMeta.Annotations[annotationVolumeBoot] != "true" {
+		return nil, nil
+	}
+	volume := &rootVolume{
+		size:       int(fi.Int32Value(ig.Spec.RootVolumeSize)),
+		volumeType: fi.StringValue(ig.Spec.RootVolumeType),
+	}
+	if v, ok := ig.ObjectMeta.Annotations[annotationVolumeSize]; ok {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid annotation %s %q in instance group %s", annotationVolumeSize, v, ig.ObjectMeta.Name)
+		}
+		volume.size = size
+	}
+	if volume.size <= 0 {
+		return nil, fmt.Errorf("instance group %s boots from volume but has no rootVolumeSize", ig.ObjectMeta.Name)
+	}
+	return volume, nil
+}
+
+// volumeBootOpts adds the root volume to the server create request
+type volumeBootOpts struct {
+	servers.CreateOptsBuilder
+	volume *rootVolume
+}
+
+func (opts *volumeBootOpts) ToServerCreateMap() (map[string]interface{}, error) {
+	m, err := opts.CreateOptsBuilder.ToServerCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	server := m["server"].(map[string]interface{})
+	image, _ := server["imageRef"].(string)
+	if image == "" {
+		return nil, fmt.Errorf("image of server %v not found", server["name"])
+	}
+	device := map[string]interface{}{
+		"boot_index":       0,
+		"uuid":             image,
+		"source_type":      "image",
+		"destination_type": "volume",
+		"volume_size":      opts.volume.size,
+		// the volume is removed together with the server when it is deleted or replaced
+		"delete_on_termination": true,
+	}
+	if opts.volume.volumeType != "" {
+		device["volume_type"] = opts.volume.volumeType
+	}
+	server["block_device_mapping_v2"] = []map[string]interface{}{device}
+	delete(server, "imageRef")
+	return m, nil
+}
+
+// rootVolumeDrift compares the root volumes of the servers against the instance group specs and
+// returns an update describing each mismatch. The update can be applied only by replacing the server.
+func (osASG *openstackASG) rootVolumeDrift(cloud openstack.OpenstackCloud, list []servers.Server) ([]Change, error) {
+	volumes := make(map[string]*rootVolume)
+	for _, ig := range osASG.ApplyCmd.InstanceGroups {
+		volume, err := rootVolumeFor(ig)
+		if err != nil {
+			return nil, err
+		}
+		if volume != nil {
+			volumes[ig.ObjectMeta.Name] = volume
+		}
+	}
+	if len(volumes) == 0 {
+		return nil, nil
+	}
+
+	attached, err := cloud.ListVolumes(cinder.ListOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing volumes: %v", err)
+	}
+	roots := make(map[string]cinder.Volume)
+	for _, v := range attached {
+		if v.Bootable != "true" {
+			continue
+		}
+		for _, a := range v.Attachments {
+			roots[a.ServerID] = v
+		}
+	}
+
+	var changes []Change
+	for _, s := range list {
+		spec := volumes[osASG.instanceGroupFor(s.Name)]
+		if spec == nil {
+			continue
+		}
+		var fields []string
+		root, ok := roots[s.ID]
+		switch {
+		case !ok:
+			fields = append(fields, "RootVolume")
+		case root.Size != spec.size:
+			fields = append(fields, "RootVolumeSize")
+			glog.Warningf("Root volume of %s is %d GB, instance group has %d GB", s.Name, root.Size, spec.size)
+		}
+		if ok && spec.volumeType != "" && root.VolumeType != spec.volumeType {
+			fields = append(fields, "RootVolumeType")
+			glog.Warningf("Root volume of %s has type %s, instance group has %s", s.Name, root.VolumeType, spec.volumeType)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		changes = append(changes, Change{
+			Key:      "Instance/" + s.Name,
+			Type:     "Instance",
+			Name:     s.Name,
+			Action:   actionUpdate,
+			Fields:   fields,
+			Kind:     kindDrift,
+			serverID: s.ID,
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes, nil
+}
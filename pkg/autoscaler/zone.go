@@ -0,0 +1,115 @@
+package autoscaler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	az "github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/availabilityzones"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"k8s.io/kops/pkg/apis/kops"
+	"k8s.io/kops/upup/pkg/fi"
+	"k8s.io/kops/upup/pkg/fi/cloudup/openstack"
+)
+
+// zoneServer is a server together with its availability zone
+type zoneServer struct {
+	servers.Server
+	az.ServerAvailabilityZoneExt
+}
+
+// unavailableZones returns the compute availability zones which are not available, and
+// whether any zone is still available
+func unavailableZones(cloud openstack.OpenstackCloud) (map[string]bool, bool, error) {
+	zones, err := cloud.ListAvailabilityZones(cloud.ComputeClient())
+	if err != nil {
+		return nil, false, fmt.Errorf("error listing availability zones: %v", err)
+	}
+	unavailable := make(map[string]bool)
+	available := false
+	for _, zone := range zones {
+		if zone.ZoneState.Available {
+			available = true
+		} else {
+			unavailable[zone.ZoneName] = true
+		}
+	}
+	return unavailable, available, nil
+}
+
+// rebalanceZones returns the instance groups with minSize temporarily increased by the number of
+// servers in unavailable zones, so that kops creates replacements which are scheduled to the surviving
+// zones. Once the zone recovers the instance groups are returned as they are. Master instance groups
+// are never changed and minSize is not increased over maxSize.
+func (osASG *openstackASG) rebalanceZones(cluster *kops.Cluster, instanceGroups []*kops.InstanceGroup) ([]*kops.InstanceGroup, error) {
+	cloud, err := osASG.cloudFor(cluster)
+	if err != nil {
+		return nil, err
+	}
+	unavailable, available, err := unavailableZones(cloud)
+	if err != nil {
+		return nil, err
+	}
+
+	lost := make(map[string]int)
+	if len(unavailable) > 0 && available {
+		pages, err := servers.List(cloud.ComputeClient(), servers.ListOpts{}).AllPages()
+		if err != nil {
+			return nil, fmt.Errorf("error listing servers: %v", err)
+		}
+		var list []zoneServer
+		if err := servers.ExtractServersInto(pages, &list); err != nil {
+			return nil, fmt.Errorf("error listing servers: %v", err)
+		}
+		for _, s := range list {
+			if s.Metadata[openstack.TagClusterName] == cluster.ObjectMeta.Name && unavailable[s.AvailabilityZone] {
+				lost[instanceGroupOf(cluster.ObjectMeta.Name, instanceGroups, s.Name)]++
+			}
+		}
+	}
+
+	var result []*kops.InstanceGroup
+	var rebalanced []string
+	for _, ig := range instanceGroups {
+		count := lost[ig.ObjectMeta.Name]
+		if count == 0 || ig.Spec.Role == kops.InstanceGroupRoleMaster {
+			result = append(result, ig)
+			continue
+		}
+		minSize := fi.Int32Value(ig.Spec.MinSize)
+		size := minSize + int32(count)
+		if ig.Spec.MaxSize != nil && size > *ig.Spec.MaxSize {
+			size = *ig.Spec.MaxSize
+		}
+		if size <= minSize {
+			result = append(result, ig)
+			continue
+		}
+		temporary := ig.DeepCopy()
+		temporary.Spec.MinSize = fi.Int32(size)
+		result = append(result, temporary)
+		rebalanced = append(rebalanced, fmt.Sprintf("%s minSize %d -> %d", ig.ObjectMeta.Name, minSize, size))
+	}
+	sort.Strings(rebalanced)
+
+	description := strings.Join(rebalanced, ", ")
+	if description != osASG.rebalanced {
+		if description != "" {
+			osASG.notifier.notify(osASG.clusterName, "ZoneRebalance", fmt.Sprintf("zones %s are unavailable, temporarily replacing their servers: %s", strings.Join(sortedKeys(unavailable), ", "), description))
+		} else {
+			glog.Infof("Availability zones of %s have recovered, restoring instance group sizes\n", osASG.clusterName)
+		}
+		osASG.rebalanced = description
+	}
+	return result, nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
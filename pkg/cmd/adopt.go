@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/zetaab/kops-autoscaler-openstack/pkg/autoscaler"
+)
+
+func newAdoptCmd(options *autoscaler.Options) *cobra.Command {
+	var instanceGroup string
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "adopt",
+		Short: "Adopt manually created servers into the instance groups of the cluster",
+		Long:  `Give the servers which are not tagged to any cluster, but match the image, flavor and subnets of an instance group with less servers than its minSize, the names and the metadata kops expects, so that they are counted instead of created again. Pause the cluster in the running autoscaler first.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if options.ClusterName == "" {
+				fmt.Fprintf(os.Stderr, "\n%v\n", fmt.Errorf("Please set NAME to env variable or as start flag"))
+				os.Exit(1)
+				return
+			}
+			adoptions, err := autoscaler.Adopt(options, options.ClusterName, instanceGroup, dryRun)
+			for _, a := range adoptions {
+				switch {
+				case a.Adopted:
+					fmt.Printf("Adopted %s\n", a)
+				case dryRun:
+					fmt.Printf("Would adopt %s\n", a)
+				}
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\n%v\n", err)
+				os.Exit(1)
+				return
+			}
+			if len(adoptions) == 0 {
+				fmt.Printf("No servers to adopt in cluster %s\n", options.ClusterName)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&instanceGroup, "instance-group", "", "Adopt servers only to this instance group")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only show the servers which would be adopted")
+	return cmd
+}
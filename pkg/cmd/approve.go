@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/zetaab/kops-autoscaler-openstack/pkg/autoscaler"
+)
+
+func newApproveCmd(options *autoscaler.Options) *cobra.Command {
+	var planID string
+	var show bool
+	cmd := &cobra.Command{
+		Use:   "approve",
+		Short: "Approve the pending plan of the cluster",
+		Long:  `Approve the pending plan of the cluster, used together with --require-approval`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := validate(options)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\n%v\n", err)
+				os.Exit(1)
+				return
+			}
+
+			if show {
+				plan, err := autoscaler.PendingPlan(options, options.ClusterName)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "\n%v\n", err)
+					os.Exit(1)
+					return
+				}
+				if plan == nil {
+					fmt.Printf("No pending plan for cluster %s\n", options.ClusterName)
+					return
+				}
+				fmt.Print(plan.String())
+				return
+			}
+
+			plan, err := autoscaler.Approve(options, options.ClusterName, planID, os.Getenv("USER"))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\n%v\n", err)
+				os.Exit(1)
+				return
+			}
+			fmt.Print(plan.String())
+			fmt.Printf("Plan %s approved\n", plan.ID)
+		},
+	}
+
+	cmd.Flags().StringVar(&planID, "id", "", "Id of the reviewed plan, approval fails if the pending plan differs")
+	cmd.Flags().BoolVar(&show, "show", false, "Only show the pending plan")
+	return cmd
+}
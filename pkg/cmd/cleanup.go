@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zetaab/kops-autoscaler-openstack/pkg/autoscaler"
+)
+
+func newCleanupCmd(options *autoscaler.Options) *cobra.Command {
+	var instanceGroup string
+	var dryRun bool
+	var yes bool
+	cmd := &cobra.Command{
+		Use:   "cleanup",
+		Short: "Delete the servers of the cluster or an instance group with their resources",
+		Long:  `Find the servers of the cluster, or of the instance group, with their floating IPs, ports and API load balancer pool members, and the ports left behind by deleted servers, and delete them after confirmation. Stop or pause the autoscaler first, otherwise it creates the servers again.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if options.ClusterName == "" {
+				fmt.Fprintf(os.Stderr, "\n%v\n", fmt.Errorf("Please set NAME to env variable or as start flag"))
+				os.Exit(1)
+				return
+			}
+			confirm := func(resources []*autoscaler.CleanupResource) bool {
+				for _, r := range resources {
+					fmt.Println(r)
+				}
+				if dryRun {
+					return false
+				}
+				if yes {
+					return true
+				}
+				fmt.Printf("Delete these %d resources? Type the name of the cluster to confirm: ", len(resources))
+				answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+				return err == nil && strings.TrimSpace(answer) == options.ClusterName
+			}
+			resources, err := autoscaler.Cleanup(options, options.ClusterName, instanceGroup, confirm)
+			deleted := 0
+			for _, r := range resources {
+				if r.Deleted {
+					deleted++
+				}
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\n%v\n", err)
+				fmt.Fprintf(os.Stderr, "Deleted %d of %d resources\n", deleted, len(resources))
+				os.Exit(1)
+				return
+			}
+			switch {
+			case len(resources) == 0:
+				fmt.Printf("No resources found for cluster %s\n", options.ClusterName)
+			case deleted > 0:
+				fmt.Printf("Deleted %d resources\n", deleted)
+			case !dryRun:
+				fmt.Println("Nothing deleted")
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&instanceGroup, "instance-group", "", "Delete only the servers of this instance group, which may already be removed from the cluster spec")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only list the resources")
+	cmd.Flags().BoolVar(&yes, "yes", false, "Delete without confirmation")
+	return cmd
+}
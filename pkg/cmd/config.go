@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/zetaab/kops-autoscaler-openstack/pkg/autoscaler"
+)
+
+// snapshotExcludedFlags are the flags left out of config snapshots, as they contain secrets, are
+// replaced by the snapshot itself or are meant for test environments only
+var snapshotExcludedFlags = map[string]bool{
+	"config":           true,
+	"once":             true,
+	"output":           true,
+	"chaos":            true,
+	"notify-webhook":   true,
+	"cloudevents-sink": true,
+	"event-bus":        true,
+}
+
+func newConfigCmd(options *autoscaler.Options, rootFlags *pflag.FlagSet) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Export and import the autoscaler configuration",
+		Long:  `Export the effective autoscaler configuration to a versioned snapshot and import it to another autoscaler`,
+	}
+	cmd.AddCommand(newConfigExportCmd(options, rootFlags))
+	cmd.AddCommand(newConfigImportCmd(rootFlags))
+	return cmd
+}
+
+func newConfigExportCmd(options *autoscaler.Options, rootFlags *pflag.FlagSet) *cobra.Command {
+	var output string
+	var names []string
+	rootFlags.VisitAll(func(f *pflag.Flag) {
+		if !snapshotExcludedFlags[f.Name] {
+			names = append(names, f.Name)
+		}
+	})
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Print the effective configuration as snapshot",
+		Long:  `Print the flags which differ from their defaults, also when set from OS_ASG_ environment variables, and the per cluster settings of the cluster annotations and --config as snapshot. Takes the same flags as the autoscaler. Secrets are not exported.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			flags := make(map[string]string)
+			for _, name := range names {
+				if f := cmd.Flags().Lookup(name); f != nil && f.Value.String() != f.DefValue {
+					flags[name] = f.Value.String()
+				}
+			}
+			snapshot, err := autoscaler.ExportSnapshot(options, flags)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\n%v\n", err)
+				os.Exit(1)
+				return
+			}
+			var data []byte
+			switch output {
+			case "yaml":
+				data, err = yaml.Marshal(snapshot)
+			case "json":
+				data, err = json.MarshalIndent(snapshot, "", "  ")
+				data = append(data, '\n')
+			default:
+				err = fmt.Errorf("--output must be json or yaml")
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\n%v\n", err)
+				os.Exit(1)
+				return
+			}
+			os.Stdout.Write(data)
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "yaml", "Output format: json or yaml")
+	cmd.Flags().AddFlagSet(rootFlags)
+	return cmd
+}
+
+func newConfigImportCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	var file string
+	var configOut string
+	var envOut string
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Write the config file and the environment of a snapshot",
+		Long:  `Validate a snapshot and write its per cluster settings as --config file and its flags as OS_ASG_ environment variables, e.g. for a config map used with envFrom`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := importSnapshot(rootFlags, file, configOut, envOut)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\n%v\n", err)
+				os.Exit(1)
+				return
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "Snapshot file written by config export")
+	cmd.Flags().StringVar(&configOut, "config-out", "", "File to write the per cluster settings to, used as --config")
+	cmd.Flags().StringVar(&envOut, "env-out", "", "File to write the flags to as OS_ASG_ environment variables, printed if empty")
+	return cmd
+}
+
+// importSnapshot checks the flags of the snapshot against the flags of this version before
+// writing anything, so that a snapshot of a newer version is not imported partially
+func importSnapshot(rootFlags *pflag.FlagSet, file string, configOut string, envOut string) error {
+	if file == "" {
+		return fmt.Errorf("--file is required")
+	}
+	snapshot, err := autoscaler.ReadSnapshot(file)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	for name, value := range snapshot.Flags {
+		f := rootFlags.Lookup(name)
+		if f == nil || snapshotExcludedFlags[name] {
+			return fmt.Errorf("unknown flag %q in snapshot %s", name, file)
+		}
+		if err := f.Value.Set(value); err != nil {
+			return fmt.Errorf("invalid value %q of flag %s in snapshot %s: %v", value, name, file, err)
+		}
+		if strings.ContainsAny(value, "\n\r") {
+			return fmt.Errorf("value of flag %s in snapshot %s contains a line break", name, file)
+		}
+		lines = append(lines, envPrefix+strings.ToUpper(strings.Replace(name, "-", "_", -1))+"="+value+"\n")
+	}
+	sort.Strings(lines)
+
+	if len(snapshot.Clusters) > 0 {
+		if configOut == "" {
+			return fmt.Errorf("snapshot %s has per cluster settings, --config-out is required", file)
+		}
+		if err := snapshot.WriteConfig(configOut); err != nil {
+			return err
+		}
+	}
+	if envOut == "" {
+		fmt.Print(strings.Join(lines, ""))
+		return nil
+	}
+	if err := ioutil.WriteFile(envOut, []byte(strings.Join(lines, "")), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %v", envOut, err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/zetaab/kops-autoscaler-openstack/pkg/autoscaler"
+)
+
+func newGetCmd(options *autoscaler.Options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get",
+		Short: "Get information from a running autoscaler",
+		Long:  `Get information from the admin API of a running autoscaler`,
+	}
+	cmd.AddCommand(newGetStatusCmd(options))
+	return cmd
+}
+
+func newGetStatusCmd(options *autoscaler.Options) *cobra.Command {
+	var server string
+	var caFile string
+	var output string
+	var history bool
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the status of the managed clusters",
+		Long:  `Show the status and the latest executions of the clusters managed by a running autoscaler, read from its admin API. Only the --name cluster is shown if it is set.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			list, err := autoscaler.FetchStatus(server, options.ClusterName, caFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\n%v\n", err)
+				os.Exit(1)
+				return
+			}
+			if err := autoscaler.PrintStatus(os.Stdout, output, list, history); err != nil {
+				fmt.Fprintf(os.Stderr, "\n%v\n", err)
+				os.Exit(1)
+				return
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&server, "server", "http://localhost:8080", "URL of the admin API of the autoscaler")
+	cmd.Flags().StringVar(&caFile, "ca-file", "", "CA certificate file for verifying the admin API served over TLS")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table, json or yaml")
+	cmd.Flags().BoolVar(&history, "history", false, "Show the latest executions of each cluster in the table")
+	return cmd
+}
@@ -1,16 +1,25 @@
 package cmd
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/zetaab/kops-autoscaler-openstack/pkg/autoscaler"
 )
 
+// envPrefix is the prefix of the environment variables setting the flags, e.g. OS_ASG_SCALE_DOWN=true
+const envPrefix = "OS_ASG_"
+
 // Execute will execute basically the whole application
 func Execute() {
 	options := &autoscaler.Options{}
@@ -21,6 +30,13 @@ func Execute() {
 		Use:   "kops-autoscaling-openstack",
 		Short: "Provide autoscaling capability to kops openstack",
 		Long:  `Provide autoscaling capability to kops openstack`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := applyEnv(cmd.Flags()); err != nil {
+				return err
+			}
+			setProxyEnv(options)
+			return nil
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			err := validate(options)
 			if err != nil {
@@ -29,33 +45,223 @@ func Execute() {
 				return
 			}
 
-			err = autoscaler.Run(options)
+			restore, err := autoscaler.ScrubOutput(options)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\n%v\n", err)
+				os.Exit(1)
+				return
+			}
+			err = autoscaler.Run(signalContext(), options)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "\n%v\n", err)
+				restore()
 				os.Exit(1)
 				return
 			}
+			restore()
 		},
 	}
 
 	rootCmd.Flags().IntVar(&options.Sleep, "sleep", 45, "Sleep between executions")
-	rootCmd.Flags().StringVar(&options.StateStore, "state-store", os.Getenv("KOPS_STATE_STORE"), "KOPS State store")
-	rootCmd.Flags().StringVar(&options.AccessKey, "access-id", os.Getenv("S3_ACCESS_KEY_ID"), "S3 access key")
-	rootCmd.Flags().StringVar(&options.SecretKey, "secret-key", os.Getenv("S3_SECRET_ACCESS_KEY"), "S3 secret key")
-	rootCmd.Flags().StringVar(&options.CustomEndpoint, "custom-endpoint", os.Getenv("S3_ENDPOINT"), "S3 custom endpoint")
-	rootCmd.Flags().StringVar(&options.ClusterName, "name", os.Getenv("NAME"), "Name of the kubernetes kops cluster")
+	rootCmd.Flags().BoolVar(&options.RequireApproval, "require-approval", false, "Store detected changes as pending plan and apply them only after approval")
+	rootCmd.Flags().BoolVar(&options.ConfirmDrift, "confirm-drift", false, "Apply changes only if they are found in two consecutive executions")
+	rootCmd.Flags().BoolVar(&options.Canary, "canary", false, "When creating multiple instances, create one first and wait until it is Ready (needs in-cluster kubernetes access)")
+	rootCmd.Flags().DurationVar(&options.CanaryTimeout, "canary-timeout", 10*time.Minute, "Time to wait for canary instance to become Ready")
+	rootCmd.Flags().DurationVar(&options.BlueGreenTimeout, "blue-green-timeout", 30*time.Minute, "Time to wait for the servers of a blue/green rollout to become ready before rolling it back")
+	rootCmd.Flags().StringVar(&options.NotifyWebhook, "notify-webhook", os.Getenv("NOTIFY_WEBHOOK"), "Webhook URL where alerts are posted")
+	rootCmd.Flags().StringVar(&options.CloudEventsSink, "cloudevents-sink", os.Getenv("K_SINK"), "URL where scaling events, failures and alerts are posted as CloudEvents, e.g. a Knative broker")
+	rootCmd.Flags().StringVar(&options.CloudEventsSource, "cloudevents-source", "kops-autoscaler-openstack", "Source of the CloudEvents, also on --event-bus")
+	rootCmd.Flags().StringVar(&options.EventBus, "event-bus", "", "NATS server (nats://host:4222) or Kafka REST proxy (kafka+http://host:8082) where the events are published, credentials in the URL")
+	rootCmd.Flags().StringVar(&options.EventBusTopic, "event-bus-topic", "kops-autoscaler.events", "NATS subject or Kafka topic of --event-bus")
+	rootCmd.Flags().BoolVar(&options.ManageInfrastructure, "manage-infrastructure", false, "Allow applies to modify networks, routers, security groups and other cluster infrastructure")
+	rootCmd.Flags().StringVar(&options.MaxDeletions, "max-deletions", "", "Number or percentage (e.g. 20%) of servers in an instance group that can be deleted without approval")
+	rootCmd.Flags().StringVar(&options.AdminAddress, "admin-address", "", "Address of the admin API, e.g. :8080. Disabled if empty")
+	rootCmd.Flags().BoolVar(&options.Interactive, "interactive", false, "Print the changes and ask for confirmation before applying them")
+	rootCmd.Flags().BoolVar(&options.DiscoverAll, "discover-all", false, "Manage all openstack clusters in the state store instead of --name")
+	rootCmd.Flags().StringVar(&options.ClusterSelector, "cluster-selector", "", "Label selector for clusters managed with --discover-all")
+	rootCmd.Flags().StringVar(&options.ConfigFile, "config", "", "Config file with per cluster settings")
+	rootCmd.Flags().StringVar(&options.SpecCacheDir, "spec-cache-dir", "", "Directory for cached cluster specs, used for reporting drift when state store is not available")
+	rootCmd.Flags().DurationVar(&options.SpecCacheMaxAge, "spec-cache-max-age", 24*time.Hour, "Cached specs older than this are not used, 0 means no limit")
+	rootCmd.Flags().BoolVar(&options.AllowVersionSkew, "allow-version-skew", false, "Operate on clusters with a newer kubernetes version than supported by the embedded kops, only logging a warning")
+	rootCmd.Flags().BoolVar(&options.ScaleDown, "scale-down", false, "Drain and delete servers over the instance group size (needs in-cluster kubernetes access)")
+	rootCmd.Flags().IntVar(&options.DrainGracePeriod, "drain-grace-period", -1, "Termination grace period in seconds for pods evicted in drain, negative uses the grace period of the pod")
+	rootCmd.Flags().DurationVar(&options.MaxTaskDuration, "max-task-duration", 10*time.Minute, "Time a failing task is retried in an apply before the execution fails")
+	rootCmd.Flags().DurationVar(&options.TaskRetryInterval, "task-retry-interval", 10*time.Second, "Time to wait before retrying when none of the tasks of an apply succeeded")
+	rootCmd.Flags().IntVar(&options.CreateConcurrency, "create-concurrency", 10, "Maximum number of server create requests sent to Nova at the same time, 0 is unlimited")
+	rootCmd.Flags().IntVar(&options.CreateRetries, "create-retries", 3, "Times a server create request rejected with 429 or 503 is retried with backoff")
+	rootCmd.Flags().DurationVar(&options.ServerActiveTimeout, "server-active-timeout", 10*time.Minute, "Time a created server may take to become ACTIVE, after which it is deleted and created again")
+	rootCmd.Flags().StringVar(&options.UserDomain, "os-user-domain", "", "Keystone domain name of the OpenStack user, overrides OS_DOMAIN_NAME and OS_DOMAIN_ID")
+	rootCmd.Flags().StringVar(&options.Project, "os-project", "", "Keystone project name the clusters are in, overrides the project of the credentials. Can be set per cluster")
+	rootCmd.Flags().StringVar(&options.ProjectDomain, "os-project-domain", "", "Keystone domain name of --os-project or of the project of the credentials, defaults to the user domain")
+	rootCmd.Flags().StringVar(&options.AuthURLFallbacks, "os-auth-url-fallbacks", "", "Comma separated keystone URLs tried in order when the OS_AUTH_URL of the credentials is unreachable")
+	rootCmd.Flags().StringVar(&options.EndpointFallbacks, "os-endpoint-fallbacks", "", "Comma separated interfaces of the service catalog, e.g. internal,admin, tried in order when the compute, network, volume or load balancer endpoint is unreachable")
+	rootCmd.Flags().StringVar(&options.LBProvider, "lb-provider", "auto", "Load balancer service of the API load balancer: octavia, neutron (LBaaS v2) or auto to use octavia when the service catalog has it")
+	rootCmd.Flags().IntVar(&options.APIRetries, "api-retries", 5, "Times an OpenStack API request answered with 429 or 409 is retried, honoring Retry-After. 0 disables")
+	rootCmd.Flags().DurationVar(&options.APIRetryMaxWait, "api-retry-max-wait", time.Minute, "Maximum wait before retrying a throttled OpenStack API request")
+	rootCmd.Flags().BoolVar(&options.SpreadSubnets, "spread-subnets", false, "Spread the ports of new instances over the subnets of their instance group instead of letting Neutron fill one subnet first")
+	rootCmd.Flags().BoolVar(&options.CheckCapacity, "check-capacity", false, "Check the free capacity of the hypervisors before large scale-ups (needs access to the hypervisors API)")
+	rootCmd.Flags().IntVar(&options.CapacityMinCreates, "capacity-min-creates", 5, "Number of new servers from which --check-capacity checks the scale-up")
+	rootCmd.Flags().StringVar(&options.CapacityPolicy, "capacity-policy", "warn", "What to do when a scale-up does not fit: warn, or split to spread the servers which fit over the zones and defer the rest")
+	rootCmd.Flags().Float64Var(&options.CPUAllocationRatio, "capacity-cpu-allocation-ratio", 16, "CPU allocation ratio of Nova used in --check-capacity")
+	rootCmd.Flags().Float64Var(&options.RAMAllocationRatio, "capacity-ram-allocation-ratio", 1.5, "RAM allocation ratio of Nova used in --check-capacity")
+	rootCmd.Flags().StringVar(&options.StatusNamespace, "status-namespace", "", "Kubernetes namespace to write the status of each cluster to, as config map kops-autoscaler-status-<cluster>")
+	rootCmd.Flags().StringVar(&options.RecordDir, "record-dir", "", "Directory to write the sanitized OpenStack API requests and responses of failed executions to, for bug reports")
+	rootCmd.Flags().IntVar(&options.RecordKeep, "record-keep", 10, "Number of recordings kept per cluster in --record-dir")
+	rootCmd.Flags().Float64Var(&options.Chaos, "chaos", 0, "Probability of failing each OpenStack request and state store call on purpose, for test environments only")
+	rootCmd.Flags().MarkHidden("chaos")
+	rootCmd.Flags().IntVar(&options.CreateBatchSize, "create-batch-size", 0, "Create new instances in batches of this size, waiting for each batch to become ACTIVE before the next. 0 creates all at once")
+	rootCmd.Flags().BoolVar(&options.CreateBatchWaitReady, "create-batch-wait-ready", false, "Wait also for the nodes of each batch to become Ready, up to --canary-timeout (needs in-cluster kubernetes access)")
+	rootCmd.Flags().DurationVar(&options.DrainTimeout, "drain-timeout", 5*time.Minute, "Time to wait for pods to be evicted in drain")
+	rootCmd.Flags().BoolVar(&options.DrainForce, "drain-force", false, "Delete pods which are still running or stuck terminating after --drain-timeout without grace period")
+	rootCmd.Flags().BoolVar(&options.CordonOnly, "cordon-only", false, "In scale down, only cordon and annotate the nodes to remove, leaving drain and deletion to someone else")
+	rootCmd.Flags().BoolVar(&options.ScaleUpOnly, "scale-up-only", false, "Only create missing instances, never delete or replace existing servers")
+	rootCmd.Flags().BoolVar(&options.Once, "once", false, "Execute the clusters once and exit")
+	rootCmd.Flags().StringVar(&options.Output, "output", "", "Print the results of --once as json or yaml")
+	rootCmd.Flags().StringVar(&options.ForeignMetadataKeys, "foreign-metadata-keys", "metering.stack,metering.server_group,metering.AutoScalingGroupName", "Comma separated server metadata keys which mark servers managed by Heat or other orchestration, these are never replaced or deleted")
+	rootCmd.Flags().BoolVar(&options.ZoneRebalance, "zone-rebalance", false, "Temporarily replace servers of unavailable availability zones in the surviving zones (requires --scale-down)")
+	rootCmd.Flags().DurationVar(&options.SlowActiveThreshold, "slow-active-threshold", 5*time.Minute, "Alert when a new server takes longer than this to become ACTIVE, 0 disables")
+	rootCmd.Flags().DurationVar(&options.SlowReadyThreshold, "slow-ready-threshold", 10*time.Minute, "Alert when a new server takes longer than this to become Ready node, 0 disables")
+	rootCmd.Flags().StringVar(&options.ComputeMicroversion, "compute-microversion", "", "Nova API microversion, e.g. 2.52 or latest. Default is the base version")
+	rootCmd.Flags().StringVar(&options.NetworkMicroversion, "network-microversion", "", "Neutron API microversion. Default is the base version")
+	rootCmd.Flags().BoolVar(&options.ReplaceVolumeDrift, "replace-volume-drift", false, "Replace servers whose root volume size or type differs from the instance group, one at a time")
+	rootCmd.Flags().BoolVar(&options.ReconcileSecurityGroups, "reconcile-security-groups", false, "Attach missing role and additionalSecurityGroups security groups to server ports")
+	rootCmd.Flags().StringVar(&options.IgnoreFields, "ignore-fields", "", "Comma separated task fields ignored in change detection, as Type.Field or Instance.Metadata.key")
+	rootCmd.Flags().BoolVar(&options.ReplaceUserDataDrift, "replace-user-data-drift", false, "Replace servers whose user data differs from the one rendered for their instance group, one at a time")
+	rootCmd.Flags().BoolVar(&options.ReplaceSSHKeyDrift, "replace-ssh-key-drift", false, "Replace servers whose keypair differs from the cluster SSH key, one at a time")
+	rootCmd.Flags().StringVar(&options.ExtraUserData, "extra-user-data", "", "Comma separated list of files appended as cloud-init parts to the user data of created servers")
+	rootCmd.Flags().BoolVar(&options.ResolveDuplicates, "resolve-duplicates", false, "When several servers have the same name, keep the one registered as Ready node and delete the others (needs in-cluster kubernetes access)")
+	rootCmd.Flags().BoolVar(&options.ReconcileTags, "reconcile-tags", false, "Add missing cluster and role metadata to the servers in the server groups of the cluster")
+	rootCmd.Flags().BoolVar(&options.ReconcileAPIPool, "reconcile-api-pool", false, "Add masters missing from the API load balancer pool and remove the members of replaced masters")
+	rootCmd.Flags().BoolVar(&options.SkipLBReconcile, "skip-lb-reconcile", false, "Never check nor change the API load balancer, its listeners, pools and members")
+	rootCmd.Flags().BoolVar(&options.SkipFIPReconcile, "skip-fip-reconcile", false, "Never check, create nor delete floating IPs")
+	rootCmd.Flags().BoolVar(&options.SkipGC, "skip-gc", false, "Leave the ports and floating IPs of deleted servers for other controllers to remove")
+	rootCmd.Flags().StringVar(&options.PolicyPlugins, "policy-plugin", "", "Comma separated executables and http(s) URLs which get the plan as JSON before each apply and allow, deny or modify it")
+	rootCmd.Flags().DurationVar(&options.PolicyTimeout, "policy-timeout", 30*time.Second, "Time each policy plugin has to answer")
+	rootCmd.Flags().StringVar(&options.PrometheusURL, "prometheus-url", "", "Prometheus where the metric targets of the instance groups in --config are queried from, e.g. http://prometheus:9090")
+	rootCmd.Flags().DurationVar(&options.MetricsInterval, "metrics-interval", time.Minute, "Time between the queries of the metric targets")
+	rootCmd.Flags().DurationVar(&options.MetricsScaleDownDelay, "metrics-scale-down-delay", 5*time.Minute, "Time the size computed from a metric target must stay lower before the instance group is scaled down")
+	rootCmd.Flags().StringVar(&options.SizeOverrides, "size-overrides", "", "Config map as namespace/name with desired sizes of node instance groups, which override their minSize without changing the state store")
+	rootCmd.Flags().StringVar(&options.AdminGRPCAddress, "admin-grpc-address", "", "Address of the gRPC admin API, e.g. :8081. Disabled if empty")
+	rootCmd.Flags().StringVar(&options.UnreachableAPI, "unreachable-api", "apply", "When the API server does not respond before an apply: apply, cloud-only to apply without canary, drain, deletions or changes to existing instances, or abort")
+	rootCmd.Flags().BoolVar(&options.AllowUnsafeMasterCount, "allow-unsafe-master-count", false, "Apply plans which would leave fewer masters than etcd quorum needs or an even number of masters")
+	rootCmd.Flags().BoolVar(&options.SkipUnchanged, "skip-unchanged", false, "Skip the dry-run while the cluster specs and servers are unchanged since the latest execution which found nothing to do")
+	rootCmd.Flags().DurationVar(&options.FullInterval, "full-interval", 0, "Between executions only poll the ETags of the specs in state store, and run full execution when they change or this time has passed. 0 runs full execution every time")
+	rootCmd.Flags().DurationVar(&options.TaskBuildInterval, "task-build-interval", 0, "Between kops task builds only compare the server counts against the instance group minSize, and build the tasks when they differ or this time has passed. 0 builds the tasks every execution")
+	rootCmd.Flags().BoolVar(&options.IncrementalTaskBuild, "incremental-task-build", false, "When the server count of only one instance group differs, build and apply the tasks only for it, the masters and one node instance group")
+	rootCmd.Flags().BoolVar(&options.CacheStores, "cache-stores", true, "Keep the keystore and secretstore files in memory between executions, reading them again when their ETags in state store change")
+	rootCmd.Flags().DurationVar(&options.InitialDelay, "initial-delay", 0, "Do not apply changes until this long after startup, dry-runs are executed normally")
+	rootCmd.Flags().DurationVar(&options.InitialSplay, "initial-splay", 0, "Add random delay up to this long per cluster to --initial-delay")
+	rootCmd.Flags().StringVar(&options.AssetsContainerRegistry, "assets-container-registry", "", "Container registry mirror used instead of assets.containerRegistry of the clusters")
+	rootCmd.Flags().StringVar(&options.AssetsFileRepository, "assets-file-repository", "", "File repository mirror used instead of assets.fileRepository of the clusters, e.g. for nodeup")
+	rootCmd.Flags().StringVar(&options.AdminTLSCertFile, "admin-tls-cert-file", "", "Certificate file for serving the admin API over TLS, reloaded when changed")
+	rootCmd.Flags().StringVar(&options.AdminTLSKeyFile, "admin-tls-key-file", "", "Private key file of --admin-tls-cert-file")
+	rootCmd.Flags().StringVar(&options.AdminTokenFile, "admin-token-file", "", "File containing the bearer token required by the mutating admin API endpoints")
+	rootCmd.Flags().StringVar(&options.AdminClientCAFile, "admin-client-ca-file", "", "CA of the client certificates accepted by the mutating admin API endpoints, requires --admin-tls-cert-file")
+	rootCmd.Flags().BoolVar(&options.AdminKubeAuth, "admin-kube-auth", false, "Accept kubernetes bearer tokens in the mutating admin API endpoints, authorized with SubjectAccessReview")
+	rootCmd.Flags().StringVar(&options.AuditLog, "audit-log", "", "File the admin API actions are appended to as hash chained JSON lines")
+	rootCmd.Flags().DurationVar(&options.ReconcileCallerInterval, "reconcile-caller-interval", time.Minute, "Minimum time between executions triggered from the admin API by the same caller, 0 disables")
+	rootCmd.Flags().DurationVar(&options.ReconcileGlobalInterval, "reconcile-global-interval", 10*time.Second, "Minimum time between executions triggered from the admin API by any caller, 0 disables")
+	rootCmd.PersistentFlags().StringVar(&options.StateStore, "state-store", os.Getenv("KOPS_STATE_STORE"), "KOPS State store")
+	rootCmd.PersistentFlags().StringVar(&options.AccessKey, "access-id", os.Getenv("S3_ACCESS_KEY_ID"), "S3 access key")
+	rootCmd.PersistentFlags().StringVar(&options.SecretKey, "secret-key", os.Getenv("S3_SECRET_ACCESS_KEY"), "S3 secret key")
+	rootCmd.PersistentFlags().StringVar(&options.AccessKeyFile, "access-key-file", "", "File containing the S3 access key, overrides --access-id")
+	rootCmd.PersistentFlags().StringVar(&options.SecretKeyFile, "secret-key-file", "", "File containing the S3 secret key, overrides --secret-key")
+	rootCmd.Flags().StringVar(&options.CredentialsSecrets, "credentials-secrets", "", "Comma separated list of namespace/name of kubernetes secrets whose S3_* and OS_* keys are used as credentials, watched for rotation")
+	rootCmd.Flags().StringVar(&options.VaultAddress, "vault-address", os.Getenv("VAULT_ADDR"), "Address of Vault the credentials are fetched from")
+	rootCmd.Flags().StringVar(&options.VaultRole, "vault-role", "", "Vault role for logging in with the kubernetes auth method, VAULT_TOKEN is used if empty")
+	rootCmd.Flags().StringVar(&options.VaultSecrets, "vault-secrets", "", "Comma separated list of Vault paths whose S3_* and OS_* keys are used as credentials, e.g. secret/data/kops")
+	rootCmd.PersistentFlags().StringVar(&options.CustomEndpoint, "custom-endpoint", os.Getenv("S3_ENDPOINT"), "S3 custom endpoint")
+	rootCmd.PersistentFlags().StringVar(&options.ClusterName, "name", os.Getenv("NAME"), "Name of the kubernetes kops cluster")
+	rootCmd.PersistentFlags().StringVar(&options.HTTPProxy, "http-proxy", "", "Proxy for HTTP connections, overrides HTTP_PROXY")
+	rootCmd.PersistentFlags().StringVar(&options.HTTPSProxy, "https-proxy", "", "Proxy for HTTPS connections, overrides HTTPS_PROXY")
+	rootCmd.PersistentFlags().StringVar(&options.NoProxy, "no-proxy", "", "Comma separated list of hosts connected without proxy, overrides NO_PROXY")
+	rootCmd.AddCommand(newApproveCmd(options))
+	rootCmd.AddCommand(newGetCmd(options))
+	rootCmd.AddCommand(newAdoptCmd(options))
+	rootCmd.AddCommand(newCleanupCmd(options))
+	rootCmd.AddCommand(newConfigCmd(options, rootCmd.Flags()))
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
 
-func validate(options *autoscaler.Options) error {
-	if options.ClusterName == "" {
-		return fmt.Errorf("Please set NAME to env variable or as start flag")
+// applyEnv sets the flags which are not given on the command line from OS_ASG_ environment variables
+func applyEnv(flags *pflag.FlagSet) error {
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Changed || err != nil {
+			return
+		}
+		name := envPrefix + strings.ToUpper(strings.Replace(f.Name, "-", "_", -1))
+		if v, ok := os.LookupEnv(name); ok {
+			if serr := flags.Set(f.Name, v); serr != nil {
+				err = fmt.Errorf("invalid %s %q: %v", name, v, serr)
+			}
+		}
+	})
+	return err
+}
+
+// setProxyEnv sets the proxy environment variables from the flags. All clients of the autoscaler,
+// OpenStack, S3, Swift and kubernetes, read the proxy from the environment on first request.
+func setProxyEnv(options *autoscaler.Options) {
+	for name, v := range map[string]string{
+		"HTTP_PROXY":  options.HTTPProxy,
+		"HTTPS_PROXY": options.HTTPSProxy,
+		"NO_PROXY":    options.NoProxy,
+	} {
+		if v != "" {
+			os.Setenv(name, v)
+		}
 	}
-	if options.StateStore == "" {
-		return fmt.Errorf("Please set KOPS_STATE_STORE to env variable or as start flag")
+}
+
+// signalContext returns a context which is cancelled on SIGINT or SIGTERM, so that the execution in
+// progress stops and the admin API is shut down. A second signal exits immediately.
+func signalContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		s := <-signals
+		glog.Infof("Received %v, stopping\n", s)
+		cancel()
+		<-signals
+		os.Exit(1)
+	}()
+	return ctx
+}
+
+// readCredentialFiles reads the S3 credentials from the files given in --access-key-file and
+// --secret-key-file, which override the flags and the environment variables
+func readCredentialFiles(options *autoscaler.Options) error {
+	for _, c := range []struct {
+		file  string
+		value *string
+	}{
+		{options.AccessKeyFile, &options.AccessKey},
+		{options.SecretKeyFile, &options.SecretKey},
+	} {
+		if c.file == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(c.file)
+		if err != nil {
+			return fmt.Errorf("error reading credentials: %v", err)
+		}
+		*c.value = strings.TrimSpace(string(data))
+		if *c.value == "" {
+			return fmt.Errorf("credentials file %s is empty", c.file)
+		}
+	}
+	return nil
+}
+
+func validate(options *autoscaler.Options) error {
+	options.SetDefaults()
+	if err := options.Validate(); err != nil {
+		return err
 	}
 	// set env variable, needed by kops libraries
 	if os.Getenv("KOPS_STATE_STORE") == "" && options.StateStore != "" {
@@ -65,12 +271,17 @@ func validate(options *autoscaler.Options) error {
 		}
 	}
 
-	if strings.HasPrefix(options.StateStore, "s3://") || strings.HasPrefix(options.StateStore, "do://") {
+	if err := readCredentialFiles(options); err != nil {
+		return err
+	}
+
+	// the credentials are read from the secrets at startup
+	if options.CredentialsSecrets == "" && options.VaultSecrets == "" && (strings.HasPrefix(options.StateStore, "s3://") || strings.HasPrefix(options.StateStore, "do://")) {
 		if options.AccessKey == "" {
 			return fmt.Errorf("Please set S3_ACCESS_KEY_ID to env variable or as start flag")
 		}
 
-		if os.Getenv("S3_ACCESS_KEY_ID") == "" && options.AccessKey != "" {
+		if (os.Getenv("S3_ACCESS_KEY_ID") == "" || options.AccessKeyFile != "") && options.AccessKey != "" {
 			err := os.Setenv("S3_ACCESS_KEY_ID", options.AccessKey)
 			if err != nil {
 				return err
@@ -81,7 +292,7 @@ func validate(options *autoscaler.Options) error {
 			return fmt.Errorf("Please set S3_SECRET_ACCESS_KEY to env variable or as start flag")
 		}
 
-		if os.Getenv("S3_SECRET_ACCESS_KEY") == "" && options.SecretKey != "" {
+		if (os.Getenv("S3_SECRET_ACCESS_KEY") == "" || options.SecretKeyFile != "") && options.SecretKey != "" {
 			err := os.Setenv("S3_SECRET_ACCESS_KEY", options.SecretKey)
 			if err != nil {
 				return err